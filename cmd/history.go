@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tamcore/ephemeron/internal/admin"
+	"github.com/tamcore/ephemeron/internal/audit"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+func historyCmd() *cobra.Command {
+	var (
+		limit  int64
+		output string
+	)
+	cmd := &cobra.Command{
+		Use:   "history <repo:tag>",
+		Short: "Show the lifecycle history of an image, including reaped images",
+		Long: `Show who pushed an image and every change to its tracking, oldest first.
+Once an image is gone, the last entry tells when and why, for as long as
+AUDIT_RETENTION keeps it.`,
+		Example: `  ephemeron history api:2h
+  ephemeron history api:2h -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			image := args[0]
+			if !strings.Contains(image, ":") {
+				return fmt.Errorf("image must be given as repo:tag")
+			}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, got %q", output)
+			}
+			cfg := newConfig()
+			if cfg.AuditRetention <= 0 {
+				return fmt.Errorf("image history is disabled (AUDIT_RETENTION=0)")
+			}
+
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				entries, err := newHistory(cfg, rdb, slog.Default()).History(ctx, image, limit)
+				if err != nil {
+					return fmt.Errorf("reading history of %s: %w", image, err)
+				}
+				_, err = rdb.GetImage(ctx, image)
+				if err != nil && !errors.Is(err, redisclient.ErrNotTracked) {
+					return fmt.Errorf("reading %s: %w", image, err)
+				}
+				resp := admin.HistoryResponse{
+					Image:     image,
+					Tracked:   err == nil,
+					Tombstone: audit.Tombstone(entries),
+					Entries:   entries,
+				}
+
+				if output == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(resp)
+				}
+				return printHistory(resp)
+			})
+		},
+	}
+	cmd.Flags().Int64Var(&limit, "limit", 100, "show at most this many of the newest entries")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func printHistory(resp admin.HistoryResponse) error {
+	if len(resp.Entries) == 0 {
+		if resp.Tracked {
+			fmt.Printf("%s is tracked but has no history yet\n", resp.Image)
+		} else {
+			fmt.Printf("no history for %s\n", resp.Image)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tACTION\tACTOR\tDIGEST\tSIZE\tEXPIRES\tREASON")
+	for _, e := range resp.Entries {
+		reason := e.Reason
+		if e.Error != "" {
+			reason = strings.TrimSpace(reason + " " + e.Error)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Format(time.RFC3339),
+			e.Action,
+			orDash(e.Actor),
+			shortDigest(e.Digest),
+			formatBytes(e.SizeBytes),
+			formatTime(e.ExpiresAt),
+			orDash(reason),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if tomb := resp.Tombstone; tomb != nil {
+		fmt.Printf("\n%s is gone: %s at %s (reason %s), digest %s, %s\n",
+			resp.Image, tomb.Action, tomb.Time.Format(time.RFC3339), orDash(tomb.Reason),
+			orDash(tomb.Digest), formatBytes(tomb.SizeBytes))
+	}
+	return nil
+}
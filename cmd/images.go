@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tamcore/ephemeron/internal/admin"
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+	"github.com/tamcore/ephemeron/internal/registry"
+)
+
+// imagesScanBatch is the number of index entries read per round trip by
+// images ls.
+const imagesScanBatch = 500
+
+func imagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List and operate on tracked images in Redis",
+	}
+	cmd.AddCommand(imagesLsCmd())
+	cmd.AddCommand(imagesInspectCmd())
+	cmd.AddCommand(imagesDigestsCmd())
+	cmd.AddCommand(imagesExpireCmd())
+	cmd.AddCommand(imagesExtendCmd())
+	cmd.AddCommand(imagesForgetCmd())
+	return cmd
+}
+
+func imagesLsCmd() *cobra.Command {
+	var prefix, tagGlob, sortBy, output string
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List tracked images",
+		Example: `  ephemeron images ls --sort size
+  ephemeron images ls --prefix ci/ --tag 'pr-*' -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sortBy != "expiry" && sortBy != "size" {
+				return fmt.Errorf("--sort must be expiry or size, got %q", sortBy)
+			}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, got %q", output)
+			}
+			if _, err := path.Match(tagGlob, ""); err != nil {
+				return fmt.Errorf("invalid --tag pattern %q", tagGlob)
+			}
+
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				images, err := listImages(ctx, rdb, prefix, tagGlob)
+				if err != nil {
+					return err
+				}
+				if sortBy == "size" {
+					sort.SliceStable(images, func(i, j int) bool {
+						return images[i].SizeBytes > images[j].SizeBytes
+					})
+				}
+
+				now := time.Now()
+				resp := make([]admin.ImageResponse, 0, len(images))
+				for _, img := range images {
+					resp = append(resp, admin.NewImageResponse(img, now))
+				}
+				if output == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(resp)
+				}
+				return printImageTable(resp)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&prefix, "prefix", "", "only repositories starting with this prefix")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "only tags matching this glob")
+	cmd.Flags().StringVar(&sortBy, "sort", "expiry", "sort order: expiry (soonest first) or size (largest first)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+// listImages reads the records of every tracked image matching the filters,
+// soonest expiry first.
+func listImages(ctx context.Context, store redisclient.Store, prefix, tagGlob string) ([]redisclient.Image, error) {
+	var images []redisclient.Image
+	var offset int64
+	for {
+		batch, err := store.ListImagesByExpiry(ctx, offset, imagesScanBatch)
+		if err != nil {
+			return nil, fmt.Errorf("listing images: %w", err)
+		}
+		offset += int64(len(batch))
+
+		for _, name := range batch {
+			repo, tag, _ := strings.Cut(name, ":")
+			if !strings.HasPrefix(repo, prefix) {
+				continue
+			}
+			if tagGlob != "" {
+				if ok, _ := path.Match(tagGlob, tag); !ok {
+					continue
+				}
+			}
+			img, err := store.GetImage(ctx, name)
+			if errors.Is(err, redisclient.ErrNotTracked) {
+				// Reaped between the index read and now.
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", name, err)
+			}
+			images = append(images, img)
+		}
+
+		if len(batch) < imagesScanBatch {
+			return images, nil
+		}
+	}
+}
+
+func printImageTable(images []admin.ImageResponse) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "IMAGE\tEXPIRES\tREMAINING\tSIZE\tPINNED\tDIGEST")
+	for _, img := range images {
+		pinned := "-"
+		if img.Pinned {
+			pinned = "yes"
+			if !img.PinnedUntil.IsZero() {
+				pinned = "until " + img.PinnedUntil.Format(time.RFC3339)
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			img.Image,
+			img.Expires.Format(time.RFC3339),
+			img.Remaining,
+			formatBytes(img.SizeBytes),
+			pinned,
+			shortDigest(img.Digest),
+		)
+	}
+	return tw.Flush()
+}
+
+func imagesInspectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect <repo:tag>",
+		Short: "Compare the tracking record of an image with the registry",
+		Long: `Show the Redis record of an image next to a live lookup of its manifest
+in the registry. Fields that disagree are marked with "!".`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			image := args[0]
+			repo, tag, ok := strings.Cut(image, ":")
+			if !ok {
+				return fmt.Errorf("image must be given as repo:tag")
+			}
+
+			cfg := newConfig()
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				img, err := rdb.GetImage(ctx, image)
+				tracked := err == nil
+				if err != nil && !errors.Is(err, redisclient.ErrNotTracked) {
+					return fmt.Errorf("reading %s: %w", image, err)
+				}
+
+				info, err := registry.New(cfg.RegistryURL).GetImageManifestInfo(ctx, repo, tag)
+				inRegistry := err == nil
+				if err != nil && !errors.Is(err, registry.ErrManifestNotFound) {
+					return fmt.Errorf("looking up %s in the registry: %w", image, err)
+				}
+
+				drift := printInspect(image, img, tracked, info, inRegistry)
+				if drift > 0 {
+					fmt.Printf("\n%d fields differ between Redis and the registry\n", drift)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// printInspect prints the Redis record next to the registry manifest and
+// returns the number of fields that differ.
+func printInspect(image string, img redisclient.Image, tracked bool, info *registry.ManifestInfo, inRegistry bool) int {
+	drift := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row := func(field, stored, live string, differs bool) {
+		mark := " "
+		if differs {
+			mark = "!"
+			drift++
+		}
+		_, _ = fmt.Fprintf(tw, "%s %s\t%s\t%s\n", mark, field, stored, live)
+	}
+
+	storedState, liveState := "tracked", "present"
+	if !tracked {
+		storedState = "not tracked"
+	}
+	if !inRegistry {
+		liveState = "missing"
+	}
+	_, _ = fmt.Fprintf(tw, "  %s\tREDIS\tREGISTRY\n", image)
+	row("state", storedState, liveState, tracked != inRegistry)
+
+	storedDigest, liveDigest, storedSize, liveSize := "-", "-", "-", "-"
+	if tracked {
+		storedDigest, storedSize = orDash(img.Digest), formatBytes(img.SizeBytes)
+	}
+	if inRegistry {
+		liveDigest, liveSize = info.Digest, formatBytes(info.SizeBytes)
+	}
+	both := tracked && inRegistry
+	// Records written before digests were tracked have no digest to compare.
+	row("digest", storedDigest, liveDigest, both && img.Digest != "" && img.Digest != info.Digest)
+	row("size", storedSize, liveSize, both && img.SizeBytes != info.SizeBytes)
+	if inRegistry {
+		row("media type", "-", info.MediaType, false)
+	}
+
+	if tracked {
+		now := time.Now()
+		resp := admin.NewImageResponse(img, now)
+		row("created", formatTime(img.Created), "-", false)
+		row("expires", fmt.Sprintf("%s (in %s)", formatTime(img.Expires), resp.Remaining), "-", false)
+		row("last pulled", formatTime(img.LastPulled), "-", false)
+		pinned := "no"
+		if resp.Pinned {
+			pinned = "yes"
+			if !img.PinnedUntil.IsZero() {
+				pinned = "until " + formatTime(img.PinnedUntil)
+			}
+		}
+		row("pinned", pinned, "-", false)
+	}
+	_ = tw.Flush()
+	return drift
+}
+
+func imagesDigestsCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "digests <repo:tag>",
+		Short: "Show the digests a tag pointed at, newest first",
+		Long: `Show the digest history of a tag with the time it moved to each digest.
+To restore a previous digest, re-tag its reference, e.g. with
+"crane tag <reference> <tag>". The registry may have garbage collected the
+manifest of a digest that is no longer tagged.`,
+		Example: "  ephemeron images digests myapp:latest",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			image := args[0]
+			if !strings.Contains(image, ":") {
+				return fmt.Errorf("image must be given as repo:tag")
+			}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, got %q", output)
+			}
+
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				digests, err := rdb.TagDigests(ctx, image)
+				if err != nil {
+					return fmt.Errorf("reading digests of %s: %w", image, err)
+				}
+				var tracked *redisclient.Image
+				img, err := rdb.GetImage(ctx, image)
+				switch {
+				case err == nil:
+					tracked = &img
+				case !errors.Is(err, redisclient.ErrNotTracked):
+					return fmt.Errorf("reading %s: %w", image, err)
+				}
+				resp := admin.NewDigestsResponse(image, digests, tracked)
+
+				if output == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(resp)
+				}
+				if len(resp.Digests) == 0 {
+					fmt.Printf("no digest history for %s\n", image)
+					return nil
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintln(tw, "PUSHED\tSIZE\tCURRENT\tREFERENCE")
+				for _, d := range resp.Digests {
+					current := "-"
+					if d.Current {
+						current = "yes"
+					}
+					_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+						d.PushedAt.Format(time.RFC3339), formatBytes(d.SizeBytes), current, d.Reference)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func imagesExpireCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "expire <repo:tag>",
+		Short: "Expire a tracked image now so the next reap cycle deletes it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				now := time.Now()
+				if err := rdb.SetExpiry(ctx, args[0], now); err != nil {
+					return fmt.Errorf("expiring %s: %w", args[0], err)
+				}
+				newHistory(newConfig(), rdb, slog.Default()).Record(ctx,
+					audit.Entry{Action: audit.ActionExpired, Image: args[0], ExpiresAt: now, Actor: audit.ActorCLI})
+				fmt.Printf("expired %s\n", args[0])
+				return nil
+			})
+		},
+	}
+}
+
+func imagesExtendCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "extend <repo:tag> <ttl>",
+		Short: "Give a tracked image a new TTL from now",
+		Long: `Set the expiry of a tracked image to now + ttl. The ttl may not exceed
+MAX_TTL, or the max_ttl of a matching policy rule.`,
+		Example: "  ephemeron images extend myapp:pr-42 48h",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			image := args[0]
+			repo, tag, ok := strings.Cut(image, ":")
+			if !ok {
+				return fmt.Errorf("image must be given as repo:tag")
+			}
+			ttl, err := time.ParseDuration(args[1])
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("ttl must be a positive Go duration, got %q", args[1])
+			}
+
+			cfg := newConfig()
+			p, err := policy.NewSource(cfg.PolicyFile)
+			if err != nil {
+				return fmt.Errorf("loading policy: %w", err)
+			}
+			maxTTL := p.Policy().Resolve(repo, tag, policy.Defaults{DefaultTTL: cfg.DefaultTTL, MaxTTL: cfg.MaxTTL}).MaxTTL
+			if ttl > maxTTL {
+				return fmt.Errorf("ttl %s exceeds the maximum of %s for %s", ttl, maxTTL, image)
+			}
+
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				expiresAt := time.Now().Add(ttl)
+				if err := rdb.SetExpiry(ctx, image, expiresAt); err != nil {
+					return fmt.Errorf("extending %s: %w", image, err)
+				}
+				newHistory(cfg, rdb, slog.Default()).Record(ctx,
+					audit.Entry{Action: audit.ActionExtended, Image: image, ExpiresAt: expiresAt, Actor: audit.ActorCLI})
+				fmt.Printf("%s now expires at %s\n", image, expiresAt.Format(time.RFC3339))
+				return nil
+			})
+		},
+	}
+}
+
+func imagesForgetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "forget <repo:tag>",
+		Short: "Stop tracking an image without deleting it from the registry",
+		Long: `Remove the tracking record of an image. The image stays in the registry
+and is never reaped, unless it is pushed again or picked up by recover.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				img, err := rdb.GetImage(ctx, args[0])
+				if err != nil {
+					return fmt.Errorf("forgetting %s: %w", args[0], err)
+				}
+				if err := rdb.RemoveImage(ctx, args[0]); err != nil {
+					return fmt.Errorf("forgetting %s: %w", args[0], err)
+				}
+				newHistory(newConfig(), rdb, slog.Default()).Record(ctx, audit.Entry{
+					Action:    audit.ActionUntracked,
+					Image:     args[0],
+					Digest:    img.Digest,
+					SizeBytes: img.SizeBytes,
+					Actor:     audit.ActorCLI,
+					Reason:    "forgotten",
+				})
+				fmt.Printf("forgot %s\n", args[0])
+				return nil
+			})
+		},
+	}
+}
+
+// formatBytes renders n with the binary suffixes STORAGE_BUDGET accepts.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ci", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// shortDigest trims a digest to the 12 hex characters docker prints.
+func shortDigest(digest string) string {
+	_, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) < 12 {
+		return orDash(digest)
+	}
+	return hex[:12]
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -14,13 +17,18 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 
+	"github.com/tamcore/ephemeron/internal/admin"
+	"github.com/tamcore/ephemeron/internal/audit"
 	"github.com/tamcore/ephemeron/internal/config"
 	"github.com/tamcore/ephemeron/internal/health"
 	"github.com/tamcore/ephemeron/internal/hooks"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
 	"github.com/tamcore/ephemeron/internal/reaper"
 	recoverlib "github.com/tamcore/ephemeron/internal/recover"
 	redisclient "github.com/tamcore/ephemeron/internal/redis"
 	"github.com/tamcore/ephemeron/internal/registry"
+	"github.com/tamcore/ephemeron/internal/warn"
 	"github.com/tamcore/ephemeron/internal/web"
 )
 
@@ -38,6 +46,13 @@ func main() {
 	rootCmd.AddCommand(serveCmd())
 	rootCmd.AddCommand(reapCmd())
 	rootCmd.AddCommand(recoverCmd())
+	rootCmd.AddCommand(policyCmd())
+	rootCmd.AddCommand(pinCmd())
+	rootCmd.AddCommand(unpinCmd())
+	rootCmd.AddCommand(bulkExpireCmd())
+	rootCmd.AddCommand(imagesCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(reapDeadLettersCmd())
 	rootCmd.AddCommand(versionCmd())
 
 	if err := rootCmd.Execute(); err != nil {
@@ -51,14 +66,42 @@ func newConfig() *config.Config {
 		InternalPort:           envInt("INTERNAL_PORT", 9090),
 		RedisURL:               envStr("REDIS_URL", envStr("REDISCLOUD_URL", "redis://localhost:6379")),
 		HookToken:              envStr("HOOK_TOKEN", ""),
+		AdminTokens:            adminTokens(),
 		RegistryURL:            envStr("REGISTRY_URL", "http://localhost:5000"),
 		Hostname:               envStr("HOSTNAME_OVERRIDE", "localhost"),
 		DefaultTTL:             envDuration("DEFAULT_TTL", time.Hour),
 		MaxTTL:                 envDuration("MAX_TTL", 24*time.Hour),
+		SlidingTTLIdle:         envDuration("SLIDING_TTL_IDLE", 0),
 		ReapInterval:           envDuration("REAP_INTERVAL", time.Minute),
+		ReapConcurrency:        envInt("REAP_CONCURRENCY", 4),
+		ReapMaxDeletions:       envInt("REAP_MAX_DELETIONS", 0),
+		ReapMaxDuration:        envDuration("REAP_MAX_DURATION", 4*time.Minute),
+		ReapRetryBackoff:       envDuration("REAP_RETRY_BACKOFF", time.Minute),
+		ReapRetryMaxBackoff:    envDuration("REAP_RETRY_MAX_BACKOFF", time.Hour),
+		ReapMaxFailures:        envInt("REAP_MAX_FAILURES", 10),
 		LogFormat:              envStr("LOG_FORMAT", "json"),
 		ImmutableTagPatterns:   envStrSlice("IMMUTABLE_TAG_PATTERNS", nil),
+		ImmutabilityRules:      envStr("IMMUTABILITY_RULES", ""),
+		ImmutabilityMode:       envStr("IMMUTABILITY_MODE", "reject"),
+		TTLAnnotationKeys:      envStrSlice("TTL_ANNOTATION_KEYS", nil),
+		PolicyFile:             envStr("POLICY_FILE", ""),
+		NotifyFile:             envStr("NOTIFY_FILE", ""),
+		WebhookWorkers:         envInt("WEBHOOK_WORKERS", 0),
+		EventDedupRetention:    envDuration("EVENT_DEDUP_RETENTION", 24*time.Hour),
+		StorageBudget:          envBytes("STORAGE_BUDGET"),
+		StorageRepoBudgets:     envByteMap("STORAGE_REPO_BUDGETS"),
+		StorageLowWatermark:    envFloat("STORAGE_LOW_WATERMARK", 0.9),
+		EvictionOrder:          envStr("EVICTION_ORDER", "expiry"),
 		HealthFailureThreshold: envInt("HEALTH_FAILURE_THRESHOLD", 3),
+		ExpiryWarning:          envDuration("EXPIRY_WARNING", 0),
+		ExtendLinkSecret:       envStr("EXTEND_LINK_SECRET", ""),
+		ExtendLinkTTL:          envDuration("EXTEND_LINK_TTL", envDuration("DEFAULT_TTL", time.Hour)),
+		PublicURL:              envStr("PUBLIC_URL", "https://"+envStr("HOSTNAME_OVERRIDE", "localhost")),
+		SMTPAddr:               envStr("SMTP_ADDR", ""),
+		SMTPFrom:               envStr("SMTP_FROM", "ephemeron@"+envStr("HOSTNAME_OVERRIDE", "localhost")),
+		SMTPTo:                 envStrSlice("SMTP_TO", nil),
+		SMTPTimeout:            envDuration("SMTP_TIMEOUT", 30*time.Second),
+		AuditRetention:         envDuration("AUDIT_RETENTION", 7*24*time.Hour),
 	}
 }
 
@@ -81,6 +124,8 @@ func serveCmd() *cobra.Command {
 			if err := cfg.Validate(); err != nil {
 				return err
 			}
+			// Validate compiled the rules already; this cannot fail.
+			immutable, _ := cfg.Immutability()
 
 			logger := setupLogger(cfg.LogFormat)
 
@@ -98,28 +143,113 @@ func serveCmd() *cobra.Command {
 			}
 			logger.Info("connected to redis")
 
+			policySrc, err := policy.NewSource(cfg.PolicyFile)
+			if err != nil {
+				return fmt.Errorf("loading policy: %w", err)
+			}
+			go policySrc.Watch(ctx, 30*time.Second, logger.With("component", "policy"))
+
+			notifier, err := newNotifier(ctx, cfg, rdb, logger)
+			if err != nil {
+				return err
+			}
+			defer notifier.Close()
+			history := newHistory(cfg, rdb, logger)
+
+			if migrated, err := rdb.MigrateIndexes(ctx); err != nil {
+				logger.Error("index migration failed", "error", err)
+			} else if migrated > 0 {
+				logger.Info("rebuilt redis indexes", "images", migrated)
+			}
+
 			// Auto-recover if Redis is not initialized.
 			reg := registry.New(cfg.RegistryURL)
-			rec := recoverlib.New(rdb, reg, cfg.DefaultTTL, cfg.MaxTTL, logger.With("component", "recover"))
+			rec := recoverlib.New(rdb, reg, cfg.DefaultTTL, cfg.MaxTTL, logger.With("component", "recover"),
+				recoverlib.WithTTLAnnotations(cfg.TTLAnnotationKeys),
+				recoverlib.WithPolicy(policySrc),
+			)
 			if err := rec.RunIfNeeded(ctx); err != nil {
 				logger.Error("auto-recovery failed", "error", err)
 			}
 
 			// Start reaper in background.
 			healthChecker := health.New(cfg.HealthFailureThreshold, logger.With("component", "health"))
-			r := reaper.New(rdb, cfg.RegistryURL, logger.With("component", "reaper"), reaper.WithHealthReporter(healthChecker))
+			r := newReaper(cfg, rdb, policySrc, notifier, history, logger,
+				reaper.WithHealthReporter(healthChecker),
+			)
 			go r.RunLoop(ctx, cfg.ReapInterval)
 
+			var links *warn.Links
+			if cfg.ExtendLinkSecret != "" {
+				links = warn.NewLinks(cfg.PublicURL, cfg.ExtendLinkSecret, cfg.ExtendLinkTTL)
+			}
+			if cfg.ExpiryWarning > 0 {
+				warnOpts := []warn.Option{
+					warn.WithPolicy(policySrc),
+					warn.WithNotifier(notifier),
+					warn.WithLinks(links),
+				}
+				if cfg.SMTPAddr != "" {
+					warnOpts = append(warnOpts, warn.WithMailer(&warn.SMTPMailer{
+						Addr:    cfg.SMTPAddr,
+						From:    cfg.SMTPFrom,
+						To:      cfg.SMTPTo,
+						Timeout: cfg.SMTPTimeout,
+					}))
+				}
+				warner := warn.New(rdb, cfg.ExpiryWarning, logger.With("component", "warn"), warnOpts...)
+				go warner.RunLoop(ctx, cfg.ReapInterval)
+			}
+
 			// Set up public HTTP routes (webhook + landing page).
 			mux := http.NewServeMux()
 
+			hookOpts := []hooks.Option{
+				hooks.WithSlidingTTL(cfg.SlidingTTLIdle),
+				hooks.WithDedup(cfg.EventDedupRetention),
+				hooks.WithTTLAnnotations(cfg.TTLAnnotationKeys),
+				hooks.WithPolicy(policySrc),
+				hooks.WithNotifier(notifier),
+				hooks.WithHistory(history),
+				hooks.WithImmutabilityMode(cfg.ImmutabilityMode),
+			}
+			if cfg.WebhookWorkers > 0 {
+				hookOpts = append(hookOpts, hooks.WithQueue(rdb))
+			}
 			hookHandler := hooks.NewHandler(
 				rdb, reg, cfg.HookToken, cfg.DefaultTTL, cfg.MaxTTL,
-				cfg.ImmutableTagPatterns,
+				immutable,
 				logger.With("component", "hooks"),
+				hookOpts...,
 			)
 			mux.Handle("POST /v1/hook/registry-event", hookHandler)
 
+			// Process queued webhook events in the background.
+			if cfg.WebhookWorkers > 0 {
+				consumer, err := os.Hostname()
+				if err != nil || consumer == "" {
+					consumer = fmt.Sprintf("ephemeron-%d", os.Getpid())
+				}
+				worker := hooks.NewWorker(hookHandler, rdb, consumer, cfg.WebhookWorkers, logger.With("component", "worker"))
+				go worker.Run(ctx)
+			}
+
+			if len(cfg.AdminTokens) > 0 {
+				adminHandler := admin.NewHandler(rdb, cfg.AdminTokens, cfg.DefaultTTL, cfg.MaxTTL, logger.With("component", "admin"),
+					admin.WithPolicy(policySrc),
+					admin.WithHistory(history),
+					admin.WithDeleter(r),
+				)
+				mux.Handle("/v1/admin/", adminHandler)
+			}
+
+			if links != nil {
+				mux.Handle("GET /v1/extend", warn.NewExtendHandler(rdb, links,
+					policy.Defaults{DefaultTTL: cfg.DefaultTTL, MaxTTL: cfg.MaxTTL}, policySrc, history,
+					logger.With("component", "extend"),
+				))
+			}
+
 			webHandler, err := web.NewHandler(cfg.Hostname, cfg.DefaultTTL, cfg.MaxTTL, version, logger.With("component", "web"))
 			if err != nil {
 				return fmt.Errorf("creating web handler: %w", err)
@@ -202,8 +332,24 @@ func reapCmd() *cobra.Command {
 			}
 			defer func() { _ = rdb.Close() }()
 
+			policySrc, err := policy.NewSource(cfg.PolicyFile)
+			if err != nil {
+				return fmt.Errorf("loading policy: %w", err)
+			}
+
 			ctx := context.Background()
-			r := reaper.New(rdb, cfg.RegistryURL, logger.With("component", "reaper"))
+			if _, err := rdb.MigrateIndexes(ctx); err != nil {
+				return fmt.Errorf("migrating indexes: %w", err)
+			}
+
+			notifier, err := newNotifier(ctx, cfg, rdb, logger)
+			if err != nil {
+				return err
+			}
+			defer notifier.Close()
+			history := newHistory(cfg, rdb, logger)
+
+			r := newReaper(cfg, rdb, policySrc, notifier, history, logger)
 			return r.ReapOnce(ctx)
 		},
 	}
@@ -227,9 +373,17 @@ func recoverCmd() *cobra.Command {
 			}
 			defer func() { _ = rdb.Close() }()
 
+			policySrc, err := policy.NewSource(cfg.PolicyFile)
+			if err != nil {
+				return fmt.Errorf("loading policy: %w", err)
+			}
+
 			ctx := context.Background()
 			reg := registry.New(cfg.RegistryURL)
-			rec := recoverlib.New(rdb, reg, cfg.DefaultTTL, cfg.MaxTTL, logger.With("component", "recover"))
+			rec := recoverlib.New(rdb, reg, cfg.DefaultTTL, cfg.MaxTTL, logger.With("component", "recover"),
+				recoverlib.WithTTLAnnotations(cfg.TTLAnnotationKeys),
+				recoverlib.WithPolicy(policySrc),
+			)
 
 			if err := rec.Run(ctx); err != nil {
 				return err
@@ -240,6 +394,256 @@ func recoverCmd() *cobra.Command {
 	}
 }
 
+// newReaper builds the reaper from the configuration, so that every command
+// deleting images applies the same rules. cfg must have been validated.
+func newReaper(
+	cfg *config.Config,
+	rdb *redisclient.Client,
+	policySrc *policy.Source,
+	notifier *notify.Dispatcher,
+	history *audit.Recorder,
+	logger *slog.Logger,
+	opts ...reaper.Option,
+) *reaper.Reaper {
+	// Validate compiled the rules already; this cannot fail.
+	immutable, _ := cfg.Immutability()
+	return reaper.New(rdb, cfg.RegistryURL, logger.With("component", "reaper"), append([]reaper.Option{
+		reaper.WithPolicy(policySrc),
+		reaper.WithImmutability(immutable),
+		reaper.WithConcurrency(cfg.ReapConcurrency),
+		reaper.WithCycleLimits(cfg.ReapMaxDeletions, cfg.ReapMaxDuration),
+		reaper.WithRetryPolicy(reapRetryPolicy(cfg)),
+		reaper.WithNotifier(notifier),
+		reaper.WithHistory(history),
+		storageBudgets(cfg),
+	}, opts...)...)
+}
+
+// storageBudgets converts the configured budgets into a reaper option.
+func storageBudgets(cfg *config.Config) reaper.Option {
+	var budgets []reaper.Budget
+	if cfg.StorageBudget > 0 {
+		budgets = append(budgets, reaper.Budget{MaxBytes: cfg.StorageBudget})
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(cfg.StorageRepoBudgets)) {
+		budgets = append(budgets, reaper.Budget{Prefix: prefix, MaxBytes: cfg.StorageRepoBudgets[prefix]})
+	}
+	return reaper.WithStorageBudgets(budgets, cfg.StorageLowWatermark, reaper.EvictionOrder(cfg.EvictionOrder))
+}
+
+// reapRetryPolicy converts the configured backoff and dead-letter threshold
+// for failed deletions.
+func reapRetryPolicy(cfg *config.Config) redisclient.RetryPolicy {
+	return redisclient.RetryPolicy{
+		Backoff:     cfg.ReapRetryBackoff,
+		MaxBackoff:  cfg.ReapRetryMaxBackoff,
+		MaxFailures: cfg.ReapMaxFailures,
+	}
+}
+
+// newHistory records image history in Redis for AUDIT_RETENTION. It returns
+// nil, which records nothing, when the retention is zero.
+func newHistory(cfg *config.Config, rdb *redisclient.Client, logger *slog.Logger) *audit.Recorder {
+	if cfg.AuditRetention <= 0 {
+		return nil
+	}
+	return audit.New(rdb, cfg.AuditRetention, logger.With("component", "audit"))
+}
+
+// newNotifier starts a dispatcher for the sinks in NOTIFY_FILE, dead-lettering
+// to Redis. It returns nil, which discards events, when no file is set.
+func newNotifier(ctx context.Context, cfg *config.Config, rdb *redisclient.Client, logger *slog.Logger) (*notify.Dispatcher, error) {
+	if cfg.NotifyFile == "" {
+		return nil, nil
+	}
+	nc, err := notify.Load(cfg.NotifyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading notifications: %w", err)
+	}
+	d := notify.New(nc, rdb, logger.With("component", "notify"))
+	d.Start(ctx)
+	logger.Info("sending notifications", "sinks", len(nc.Sinks))
+	return d, nil
+}
+
+func policyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Inspect the per-repository policy file",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate [file]",
+		Short: "Validate a policy file (defaults to POLICY_FILE)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := envStr("POLICY_FILE", "")
+			if len(args) == 1 {
+				file = args[0]
+			}
+			if file == "" {
+				return fmt.Errorf("no policy file given and POLICY_FILE is not set")
+			}
+
+			p, err := policy.Load(file)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: %d rules OK\n", file, len(p.Rules))
+			for _, r := range p.Rules {
+				fmt.Printf("  %-20s repository=%q tag=%q\n", r.Name, r.Repository, r.Tag)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func pinCmd() *cobra.Command {
+	var duration time.Duration
+	cmd := &cobra.Command{
+		Use:   "pin <repo:tag>",
+		Short: "Exempt a tracked image from reaping",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var until time.Time
+			if duration > 0 {
+				until = time.Now().Add(duration)
+			}
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				if err := rdb.PinImage(ctx, args[0], until); err != nil {
+					return fmt.Errorf("pinning %s: %w", args[0], err)
+				}
+				entry := audit.Entry{Action: audit.ActionPinned, Image: args[0], Actor: audit.ActorCLI}
+				if !until.IsZero() {
+					entry.Reason = "until " + until.UTC().Format(time.RFC3339)
+				}
+				newHistory(newConfig(), rdb, slog.Default()).Record(ctx, entry)
+				if until.IsZero() {
+					fmt.Printf("pinned %s indefinitely\n", args[0])
+				} else {
+					fmt.Printf("pinned %s until %s\n", args[0], until.Format(time.RFC3339))
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "for", 0, "how long the pin lasts (default: until unpinned)")
+	return cmd
+}
+
+func unpinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin <repo:tag>",
+		Short: "Remove the pin of a tracked image",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				if err := rdb.UnpinImage(ctx, args[0]); err != nil {
+					return fmt.Errorf("unpinning %s: %w", args[0], err)
+				}
+				newHistory(newConfig(), rdb, slog.Default()).Record(ctx,
+					audit.Entry{Action: audit.ActionUnpinned, Image: args[0], Actor: audit.ActorCLI})
+				fmt.Printf("unpinned %s\n", args[0])
+				return nil
+			})
+		},
+	}
+}
+
+func bulkExpireCmd() *cobra.Command {
+	var (
+		sel     admin.Selector
+		minSize string
+		del     bool
+		dryRun  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "bulk-expire",
+		Short: "Expire or delete every tracked image matching a selector",
+		Example: `  ephemeron bulk-expire --tag 'feature-x-*' --dry-run
+  ephemeron bulk-expire --repository 'ci/*' --min-age 72h --delete`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if minSize != "" {
+				n, err := config.ParseBytes(minSize)
+				if err != nil {
+					return fmt.Errorf("invalid --min-size: %w", err)
+				}
+				sel.MinSize = n
+			}
+			req := admin.BulkRequest{Selector: sel, Action: admin.BulkExpire, DryRun: dryRun, Actor: audit.ActorCLI}
+			if del {
+				req.Action = admin.BulkDelete
+			}
+
+			cfg := newConfig()
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			logger := setupLogger(cfg.LogFormat)
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				policySrc, err := policy.NewSource(cfg.PolicyFile)
+				if err != nil {
+					return fmt.Errorf("loading policy: %w", err)
+				}
+				notifier, err := newNotifier(ctx, cfg, rdb, logger)
+				if err != nil {
+					return err
+				}
+				defer notifier.Close()
+				history := newHistory(cfg, rdb, logger)
+
+				r := newReaper(cfg, rdb, policySrc, notifier, history, logger)
+
+				result, err := admin.Bulk(ctx, rdb, r, history, req, logger.With("component", "bulk"))
+				if err != nil {
+					return err
+				}
+				for _, img := range result.Images {
+					if img.Error != "" {
+						fmt.Printf("%-8s %s: %s\n", img.Status, img.Image, img.Error)
+						continue
+					}
+					fmt.Printf("%-8s %s\n", img.Status, img.Image)
+				}
+				fmt.Printf("matched %d, expired %d, deleted %d, skipped pinned %d, failed %d",
+					result.Matched, result.Expired, result.Deleted, result.SkippedPinned, result.Failed)
+				if result.DryRun {
+					fmt.Print(" (dry run)")
+				}
+				fmt.Println()
+				if result.Failed > 0 {
+					return fmt.Errorf("%d images failed", result.Failed)
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&sel.Repository, "repository", "", "repository glob, e.g. 'ci/*'")
+	cmd.Flags().StringVar(&sel.Tag, "tag", "", "tag glob, e.g. 'feature-x-*'")
+	cmd.Flags().DurationVar(&sel.MinAge, "min-age", 0, "only images pushed at least this long ago")
+	cmd.Flags().StringVar(&sel.Digest, "digest", "", "only images with this manifest digest")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "only images of at least this size, e.g. 500Mi")
+	cmd.Flags().BoolVar(&del, "delete", false, "delete the images now instead of expiring them")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the matching images")
+	return cmd
+}
+
+// withStore connects to REDIS_URL for commands that only operate on the
+// tracking data.
+func withStore(fn func(ctx context.Context, rdb *redisclient.Client) error) error {
+	cfg := newConfig()
+	rdb, err := redisclient.New(cfg.RedisURL)
+	if err != nil {
+		return fmt.Errorf("connecting to redis: %w", err)
+	}
+	defer func() { _ = rdb.Close() }()
+	return fn(context.Background(), rdb)
+}
+
 func versionCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "version",
@@ -290,3 +694,57 @@ func envStrSlice(key string, fallback []string) []string {
 	}
 	return result
 }
+
+// adminTokens reads ADMIN_TOKENS, falling back to the single token in
+// ADMIN_TOKEN that earlier releases used.
+func adminTokens() []string {
+	if tokens := envStrSlice("ADMIN_TOKENS", nil); len(tokens) > 0 {
+		return tokens
+	}
+	if token := strings.TrimSpace(os.Getenv("ADMIN_TOKEN")); token != "" {
+		return []string{token}
+	}
+	return nil
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+// envBytes parses a size like "45Gi". Invalid values yield -1 so that
+// validation reports them instead of silently disabling the budget.
+func envBytes(key string) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	n, err := config.ParseBytes(v)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// envByteMap parses comma-separated prefix=size pairs, e.g.
+// "ci/=10Gi,staging/=20Gi". Invalid sizes yield -1 for validation to report.
+func envByteMap(key string) map[string]int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	result := make(map[string]int64)
+	for _, pair := range strings.Split(v, ",") {
+		prefix, size, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		n, err := config.ParseBytes(size)
+		if err != nil {
+			n = -1
+		}
+		result[strings.TrimSpace(prefix)] = n
+	}
+	return result
+}
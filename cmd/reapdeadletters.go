@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tamcore/ephemeron/internal/admin"
+	"github.com/tamcore/ephemeron/internal/audit"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+func reapDeadLettersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reap-dead-letters",
+		Short: "List and retry images the reaper gave up deleting",
+		Long: `Images that failed deletion REAP_MAX_FAILURES times in a row are moved to
+the dead-letter set and no longer retried. They stay tracked until they are
+retried, pushed again or forgotten.`,
+	}
+	cmd.AddCommand(reapDeadLettersLsCmd())
+	cmd.AddCommand(reapDeadLettersRetryCmd())
+	return cmd
+}
+
+func reapDeadLettersLsCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List dead-lettered images, oldest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, got %q", output)
+			}
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				names, err := rdb.ListReapDeadLetters(ctx)
+				if err != nil {
+					return fmt.Errorf("listing dead letters: %w", err)
+				}
+				now := time.Now()
+				resp := make([]admin.ImageResponse, 0, len(names))
+				for _, name := range names {
+					img, err := rdb.GetImage(ctx, name)
+					if errors.Is(err, redisclient.ErrNotTracked) {
+						continue
+					}
+					if err != nil {
+						return fmt.Errorf("reading %s: %w", name, err)
+					}
+					resp = append(resp, admin.NewImageResponse(img, now))
+				}
+
+				if output == "json" {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(resp)
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintln(tw, "IMAGE\tDEAD-LETTERED\tFAILURES\tSIZE\tLAST ERROR")
+				for _, img := range resp {
+					_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+						img.Image,
+						formatTime(img.DeadLettered),
+						img.ReapFailures,
+						formatBytes(img.SizeBytes),
+						orDash(img.LastReapError),
+					)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func reapDeadLettersRetryCmd() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "retry [repo:tag...]",
+		Short: "Take images out of the dead-letter set so the reaper tries them again",
+		Example: `  ephemeron reap-dead-letters retry myapp:pr-42
+  ephemeron reap-dead-letters retry --all`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) > 0) {
+				return fmt.Errorf("give either images or --all")
+			}
+			return withStore(func(ctx context.Context, rdb *redisclient.Client) error {
+				images := args
+				if all {
+					var err error
+					if images, err = rdb.ListReapDeadLetters(ctx); err != nil {
+						return fmt.Errorf("listing dead letters: %w", err)
+					}
+				}
+				history := newHistory(newConfig(), rdb, slog.Default())
+				for _, image := range images {
+					if err := rdb.RetryReapDeadLetter(ctx, image); err != nil {
+						return fmt.Errorf("retrying %s: %w", image, err)
+					}
+					history.Record(ctx, audit.Entry{Action: audit.ActionRetried, Image: image, Actor: audit.ActorCLI})
+					fmt.Printf("retrying %s\n", image)
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "retry every dead-lettered image")
+	return cmd
+}
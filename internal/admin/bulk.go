@@ -0,0 +1,267 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// Deleter deletes an image from the registry and stops tracking it, the way
+// the reaper does for expired images.
+type Deleter interface {
+	DeleteImage(ctx context.Context, imageWithTag string) error
+}
+
+// Selector picks tracked images for a bulk operation. Empty fields match
+// every image, but at least one must be set.
+type Selector struct {
+	// Repository and Tag are path.Match globs.
+	Repository string
+	Tag        string
+	// MinAge selects images pushed at least this long ago.
+	MinAge time.Duration
+	// Digest selects images whose manifest digest is exactly this.
+	Digest string
+	// MinSize selects images of at least this many bytes.
+	MinSize int64
+}
+
+// Validate rejects empty selectors and invalid globs.
+func (s Selector) Validate() error {
+	if s == (Selector{}) {
+		return errors.New("selector must set at least one of repository, tag, min_age, digest or min_size")
+	}
+	if _, err := path.Match(s.Repository, ""); err != nil {
+		return fmt.Errorf("invalid repository pattern %q", s.Repository)
+	}
+	if _, err := path.Match(s.Tag, ""); err != nil {
+		return fmt.Errorf("invalid tag pattern %q", s.Tag)
+	}
+	if s.MinAge < 0 || s.MinSize < 0 {
+		return errors.New("min_age and min_size must not be negative")
+	}
+	return nil
+}
+
+// matchesName checks the criteria that only need the image name, so the
+// record is only read for candidates.
+func (s Selector) matchesName(repo, tag string) bool {
+	return matchGlob(s.Repository, repo) && matchGlob(s.Tag, tag)
+}
+
+// Matches reports whether the selector picks img at now.
+func (s Selector) Matches(img redisclient.Image, now time.Time) bool {
+	repo, tag, _ := strings.Cut(img.Name, ":")
+	if !s.matchesName(repo, tag) {
+		return false
+	}
+	if s.MinAge > 0 && (img.Created.IsZero() || now.Sub(img.Created) < s.MinAge) {
+		return false
+	}
+	if s.Digest != "" && img.Digest != s.Digest {
+		return false
+	}
+	return img.SizeBytes >= s.MinSize
+}
+
+func matchGlob(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// BulkAction is what a bulk operation does to the selected images.
+type BulkAction string
+
+const (
+	// BulkExpire sets the expiry to now, leaving deletion to the next
+	// reap cycle.
+	BulkExpire BulkAction = "expire"
+	// BulkDelete deletes the images right away through the reaper.
+	BulkDelete BulkAction = "delete"
+)
+
+// Statuses of an image in a BulkResult.
+const (
+	BulkStatusMatched = "matched"
+	BulkStatusExpired = "expired"
+	BulkStatusDeleted = "deleted"
+	BulkStatusPinned  = "pinned"
+	BulkStatusFailed  = "failed"
+)
+
+// BulkRequest describes a bulk operation.
+type BulkRequest struct {
+	Selector Selector
+	Action   BulkAction
+	// DryRun only lists the matches.
+	DryRun bool
+	// Actor and Addr identify who asked, for the image history.
+	Actor string
+	Addr  string
+}
+
+// BulkImage is the outcome for one selected image.
+type BulkImage struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkResult summarizes a bulk operation. Pinned images are selected but
+// never expired or deleted.
+type BulkResult struct {
+	DryRun        bool        `json:"dry_run"`
+	Action        BulkAction  `json:"action"`
+	Matched       int         `json:"matched"`
+	Expired       int         `json:"expired"`
+	Deleted       int         `json:"deleted"`
+	SkippedPinned int         `json:"skipped_pinned"`
+	Failed        int         `json:"failed"`
+	Images        []BulkImage `json:"images"`
+}
+
+// bulkProgressInterval is how many images are processed between progress
+// log lines.
+const bulkProgressInterval = 100
+
+// Bulk selects tracked images and expires or deletes them. deleter may be
+// nil unless the action is BulkDelete. Expiries are recorded in history,
+// which may be nil; deletions are recorded by the deleter. Failures on
+// single images are reported in the result; the error is only set if
+// selection failed.
+func Bulk(
+	ctx context.Context,
+	store redisclient.Store,
+	deleter Deleter,
+	history *audit.Recorder,
+	req BulkRequest,
+	logger *slog.Logger,
+) (BulkResult, error) {
+	result := BulkResult{DryRun: req.DryRun, Action: req.Action, Images: []BulkImage{}}
+	if err := req.Selector.Validate(); err != nil {
+		return result, err
+	}
+	switch req.Action {
+	case BulkExpire:
+	case BulkDelete:
+		if deleter == nil {
+			return result, errors.New("delete is not available")
+		}
+	default:
+		return result, fmt.Errorf("unknown action %q", req.Action)
+	}
+
+	now := time.Now()
+	images, err := selectImages(ctx, store, req.Selector, now)
+	if err != nil {
+		return result, fmt.Errorf("selecting images: %w", err)
+	}
+	result.Matched = len(images)
+	logger.Info("bulk operation starting",
+		"action", string(req.Action),
+		"dry_run", req.DryRun,
+		"matched", len(images),
+	)
+
+	for i, img := range images {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		outcome := BulkImage{Image: img.Name}
+		switch {
+		case img.PinnedAt(now):
+			outcome.Status = BulkStatusPinned
+			result.SkippedPinned++
+		case req.DryRun:
+			outcome.Status = BulkStatusMatched
+		case req.Action == BulkDelete:
+			if err := deleter.DeleteImage(ctx, img.Name); err != nil {
+				outcome.Status, outcome.Error = BulkStatusFailed, err.Error()
+				result.Failed++
+				break
+			}
+			outcome.Status = BulkStatusDeleted
+			result.Deleted++
+		default:
+			if err := store.SetExpiry(ctx, img.Name, now); err != nil {
+				outcome.Status, outcome.Error = BulkStatusFailed, err.Error()
+				result.Failed++
+				break
+			}
+			outcome.Status = BulkStatusExpired
+			result.Expired++
+			history.Record(ctx, audit.Entry{
+				Action:    audit.ActionExpired,
+				Image:     img.Name,
+				Digest:    img.Digest,
+				SizeBytes: img.SizeBytes,
+				ExpiresAt: now,
+				Actor:     req.Actor,
+				Addr:      req.Addr,
+				Reason:    "bulk",
+			})
+		}
+		result.Images = append(result.Images, outcome)
+
+		if done := i + 1; done%bulkProgressInterval == 0 && done < len(images) {
+			logger.Info("bulk operation progress", "processed", done, "total", len(images))
+		}
+	}
+
+	logger.Info("bulk operation finished",
+		"action", string(req.Action),
+		"dry_run", req.DryRun,
+		"matched", result.Matched,
+		"expired", result.Expired,
+		"deleted", result.Deleted,
+		"skipped_pinned", result.SkippedPinned,
+		"failed", result.Failed,
+	)
+	return result, nil
+}
+
+// selectImages scans the expiry index and returns the records the selector
+// picks, soonest expiry first.
+func selectImages(ctx context.Context, store redisclient.Store, sel Selector, now time.Time) ([]redisclient.Image, error) {
+	var selected []redisclient.Image
+	var offset int64
+	for {
+		batch, err := store.ListImagesByExpiry(ctx, offset, scanBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(len(batch))
+
+		for _, name := range batch {
+			repo, tag, _ := strings.Cut(name, ":")
+			if !sel.matchesName(repo, tag) {
+				continue
+			}
+			img, err := store.GetImage(ctx, name)
+			if errors.Is(err, redisclient.ErrNotTracked) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if sel.Matches(img, now) {
+				selected = append(selected, img)
+			}
+		}
+
+		if len(batch) < scanBatchSize {
+			return selected, nil
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// mockDeleter removes images from the store, failing for those in fail.
+type mockDeleter struct {
+	store   *mockStore
+	fail    map[string]bool
+	deleted []string
+}
+
+func (d *mockDeleter) DeleteImage(_ context.Context, imageWithTag string) error {
+	if d.fail[imageWithTag] {
+		return errors.New("registry unavailable")
+	}
+	delete(d.store.images, imageWithTag)
+	d.deleted = append(d.deleted, imageWithTag)
+	return nil
+}
+
+func TestSelector_Matches(t *testing.T) {
+	now := time.Now()
+	img := redisclient.Image{
+		Name:      "team/app:feature-x-1",
+		Created:   now.Add(-48 * time.Hour),
+		Digest:    "sha256:abc",
+		SizeBytes: 500,
+	}
+
+	tests := []struct {
+		name string
+		sel  Selector
+		want bool
+	}{
+		{"tag glob", Selector{Tag: "feature-x-*"}, true},
+		{"tag glob mismatch", Selector{Tag: "feature-y-*"}, false},
+		{"repository glob", Selector{Repository: "team/*"}, true},
+		{"repository glob does not cross /", Selector{Repository: "*"}, false},
+		{"old enough", Selector{MinAge: 24 * time.Hour}, true},
+		{"too young", Selector{MinAge: 72 * time.Hour}, false},
+		{"digest", Selector{Digest: "sha256:abc"}, true},
+		{"other digest", Selector{Digest: "sha256:def"}, false},
+		{"large enough", Selector{MinSize: 500}, true},
+		{"too small", Selector{MinSize: 501}, false},
+		{"all criteria", Selector{Repository: "team/*", Tag: "feature-*", MinAge: time.Hour, Digest: "sha256:abc", MinSize: 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sel.Matches(img, now); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelector_Validate(t *testing.T) {
+	if err := (Selector{}).Validate(); err == nil {
+		t.Error("expected empty selector to be rejected")
+	}
+	if err := (Selector{Tag: "["}).Validate(); err == nil {
+		t.Error("expected invalid glob to be rejected")
+	}
+	if err := (Selector{Tag: "feature-*"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	images := []string{"app:feature-x-1", "web:feature-x-2", "web:feature-x-3", "app:main", "web:feature-y-1"}
+	sel := Selector{Tag: "feature-x-*"}
+
+	t.Run("dry run", func(t *testing.T) {
+		store := newMockStore(images...)
+		before := store.images["app:feature-x-1"].Expires
+
+		result, err := Bulk(t.Context(), store, nil, nil, BulkRequest{Selector: sel, Action: BulkExpire, DryRun: true}, slog.Default())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Matched != 3 || result.Expired != 0 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		if !store.images["app:feature-x-1"].Expires.Equal(before) {
+			t.Error("expected dry run to leave expiries alone")
+		}
+	})
+
+	t.Run("expire skips pinned", func(t *testing.T) {
+		store := newMockStore(images...)
+		_ = store.PinImage(t.Context(), "web:feature-x-3", time.Time{})
+
+		result, err := Bulk(t.Context(), store, nil, nil, BulkRequest{Selector: sel, Action: BulkExpire}, slog.Default())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Matched != 3 || result.Expired != 2 || result.SkippedPinned != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		now := time.Now()
+		for _, image := range []string{"app:feature-x-1", "web:feature-x-2"} {
+			if store.images[image].Expires.After(now) {
+				t.Errorf("expected %s to be expired", image)
+			}
+		}
+		for _, image := range []string{"web:feature-x-3", "app:main", "web:feature-y-1"} {
+			if !store.images[image].Expires.After(now) {
+				t.Errorf("expected %s to be left alone", image)
+			}
+		}
+	})
+
+	t.Run("delete reports failures", func(t *testing.T) {
+		store := newMockStore(images...)
+		deleter := &mockDeleter{store: store, fail: map[string]bool{"web:feature-x-2": true}}
+
+		result, err := Bulk(t.Context(), store, deleter, nil, BulkRequest{Selector: sel, Action: BulkDelete}, slog.Default())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Deleted != 2 || result.Failed != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		if !slices.Equal(deleter.deleted, []string{"app:feature-x-1", "web:feature-x-3"}) {
+			t.Errorf("deleted = %v", deleter.deleted)
+		}
+		failed := result.Images[1]
+		if failed.Image != "web:feature-x-2" || failed.Status != BulkStatusFailed || failed.Error == "" {
+			t.Errorf("expected failure to be reported, got %+v", failed)
+		}
+	})
+
+	t.Run("delete without deleter", func(t *testing.T) {
+		if _, err := Bulk(t.Context(), newMockStore(images...), nil, nil, BulkRequest{Selector: sel, Action: BulkDelete}, slog.Default()); err == nil {
+			t.Error("expected error without a deleter")
+		}
+	})
+}
+
+func TestHandler_BulkExpire(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		deleter    bool
+		wantStatus int
+		wantImages []string
+	}{
+		{"dry run", `{"tag":"feature-x-*","dry_run":true}`, false, http.StatusOK, []string{"app:feature-x-1", "web:feature-x-2"}},
+		{"expire by repository and size", `{"repository":"web","min_size":"1Ki"}`, false, http.StatusOK, []string{"web:feature-x-2", "web:main"}},
+		{"delete", `{"tag":"feature-x-*","action":"delete"}`, true, http.StatusOK, []string{"app:feature-x-1", "web:feature-x-2"}},
+		{"delete unavailable", `{"tag":"feature-x-*","action":"delete"}`, false, http.StatusBadRequest, nil},
+		{"empty selector", `{"dry_run":true}`, false, http.StatusBadRequest, nil},
+		{"invalid min_age", `{"tag":"x","min_age":"old"}`, false, http.StatusBadRequest, nil},
+		{"invalid min_size", `{"tag":"x","min_size":"big"}`, false, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore("app:feature-x-1", "web:feature-x-2", "web:main")
+			var opts []Option
+			if tt.deleter {
+				opts = append(opts, WithDeleter(&mockDeleter{store: store}))
+			}
+
+			rec := do(t, newTestHandler(store, opts...), http.MethodPost, "/v1/admin/bulk-expire", testToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			result := decode[BulkResult](t, rec)
+			var got []string
+			for _, img := range result.Images {
+				got = append(got, img.Image)
+			}
+			if !slices.Equal(got, tt.wantImages) {
+				t.Errorf("images = %v, want %v", got, tt.wantImages)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// DigestResponse is one digest a tag pointed at.
+type DigestResponse struct {
+	Digest string `json:"digest"`
+	// Reference is repo@digest, ready to re-tag the digest by hand.
+	Reference string    `json:"reference"`
+	PushedAt  time.Time `json:"pushed_at"`
+	SizeBytes int64     `json:"size_bytes"`
+	Current   bool      `json:"current"`
+}
+
+// DigestsResponse is the digest history of a tag, newest first.
+type DigestsResponse struct {
+	Image   string           `json:"image"`
+	Tracked bool             `json:"tracked"`
+	Digests []DigestResponse `json:"digests"`
+}
+
+// NewDigestsResponse builds the response for an image from its digest
+// history and its record, if it is tracked.
+func NewDigestsResponse(image string, digests []redisclient.TagDigest, img *redisclient.Image) DigestsResponse {
+	repo, _, _ := strings.Cut(image, ":")
+	resp := DigestsResponse{Image: image, Tracked: img != nil, Digests: make([]DigestResponse, 0, len(digests))}
+	for i, d := range digests {
+		resp.Digests = append(resp.Digests, DigestResponse{
+			Digest:    d.Digest,
+			Reference: repo + "@" + d.Digest,
+			PushedAt:  d.PushedAt,
+			SizeBytes: d.SizeBytes,
+			Current:   i == 0 && img != nil && img.Digest == d.Digest,
+		})
+	}
+	return resp
+}
+
+// getDigests serves GET /v1/admin/digests/{repo:tag}.
+func (h *Handler) getDigests(w http.ResponseWriter, r *http.Request) {
+	image := r.PathValue("image")
+	digests, err := h.redis.TagDigests(r.Context(), image)
+	if err != nil {
+		h.writeStoreError(w, image, err)
+		return
+	}
+	var tracked *redisclient.Image
+	img, err := h.redis.GetImage(r.Context(), image)
+	switch {
+	case err == nil:
+		tracked = &img
+	case !errors.Is(err, redisclient.ErrNotTracked):
+		h.writeStoreError(w, image, err)
+		return
+	}
+	if tracked == nil && len(digests) == 0 {
+		writeError(w, http.StatusNotFound, "no digest history for image")
+		return
+	}
+	writeJSON(w, http.StatusOK, NewDigestsResponse(image, digests, tracked))
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+func TestHandler_Digests(t *testing.T) {
+	store := newMockStore("app:latest")
+	now := time.Now()
+	store.tagDigests = map[string][]redisclient.TagDigest{
+		"app:latest": {
+			{Digest: "sha256:app:latest", PushedAt: now, SizeBytes: 1024},
+			{Digest: "sha256:old", PushedAt: now.Add(-time.Hour), SizeBytes: 512},
+		},
+		"gone:1h": {
+			{Digest: "sha256:gone", PushedAt: now.Add(-2 * time.Hour)},
+		},
+	}
+	h := newTestHandler(store)
+
+	t.Run("tracked tag", func(t *testing.T) {
+		rec := do(t, h, http.MethodGet, "/v1/admin/digests/app:latest", testToken, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decode[DigestsResponse](t, rec)
+		if !resp.Tracked || len(resp.Digests) != 2 {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		if d := resp.Digests[0]; !d.Current || d.Reference != "app@sha256:app:latest" {
+			t.Errorf("unexpected current digest: %+v", d)
+		}
+		if d := resp.Digests[1]; d.Current || d.Digest != "sha256:old" || d.Reference != "app@sha256:old" || d.SizeBytes != 512 {
+			t.Errorf("unexpected previous digest: %+v", d)
+		}
+	})
+
+	t.Run("reaped tag keeps its history", func(t *testing.T) {
+		rec := do(t, h, http.MethodGet, "/v1/admin/digests/gone:1h", testToken, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decode[DigestsResponse](t, rec)
+		if resp.Tracked || len(resp.Digests) != 1 || resp.Digests[0].Current {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		if rec := do(t, h, http.MethodGet, "/v1/admin/digests/other:1h", testToken, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+// Package admin implements the authenticated HTTP API for operating on
+// tracked images.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/config"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// ImageRequest is the body of the endpoints acting on one image.
+type ImageRequest struct {
+	// Image is the tracked image as repo:tag.
+	Image string `json:"image"`
+	// Duration limits a pin (e.g. "48h"); empty pins indefinitely. Only
+	// used by pin.
+	Duration string `json:"duration,omitempty"`
+	// TTL is the new lifetime from now. Only used by extend.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// PinResponse reports the pin state of an image after a request.
+type PinResponse struct {
+	Image       string    `json:"image"`
+	Pinned      bool      `json:"pinned"`
+	PinnedUntil time.Time `json:"pinned_until,omitzero"`
+}
+
+// ErrorResponse is returned with every non-2xx status.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the admin API. Every request must carry one of the admin
+// tokens.
+type Handler struct {
+	redis      redisclient.Store
+	tokens     []string
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	policy     *policy.Source
+	deleter    Deleter
+	history    *audit.Recorder
+	logger     *slog.Logger
+	mux        *http.ServeMux
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithPolicy applies the per-repository max_ttl when extending images.
+func WithPolicy(src *policy.Source) Option {
+	return func(h *Handler) {
+		h.policy = src
+	}
+}
+
+// WithDeleter enables the delete action of bulk operations.
+func WithDeleter(d Deleter) Option {
+	return func(h *Handler) {
+		h.deleter = d
+	}
+}
+
+// WithHistory records the changes made through the API in the image
+// history and serves GET /v1/admin/history/{repo:tag}.
+func WithHistory(r *audit.Recorder) Option {
+	return func(h *Handler) {
+		h.history = r
+	}
+}
+
+// NewHandler creates an admin handler authenticated by tokens. Extensions
+// are capped at maxTTL.
+func NewHandler(
+	redis redisclient.Store,
+	tokens []string,
+	defaultTTL, maxTTL time.Duration,
+	logger *slog.Logger,
+	opts ...Option,
+) *Handler {
+	h := &Handler{
+		redis:      redis,
+		tokens:     tokens,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+		logger:     logger,
+		mux:        http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.mux.HandleFunc("GET /v1/admin/images", h.listImages)
+	h.mux.HandleFunc("GET /v1/admin/images/{image...}", h.getImage)
+	h.mux.HandleFunc("GET /v1/admin/digests/{image...}", h.getDigests)
+	h.mux.HandleFunc("POST /v1/admin/extend", h.extend)
+	h.mux.HandleFunc("POST /v1/admin/expire", h.expire)
+	h.mux.HandleFunc("POST /v1/admin/bulk-expire", h.bulkExpire)
+	h.mux.HandleFunc("POST /v1/admin/pin", h.pin)
+	h.mux.HandleFunc("POST /v1/admin/unpin", h.unpin)
+	h.mux.HandleFunc("GET /v1/admin/reap-dead-letters", h.listReapDeadLetters)
+	h.mux.HandleFunc("POST /v1/admin/reap-dead-letters/retry", h.retryReapDeadLetter)
+	if h.history != nil {
+		h.mux.HandleFunc("GET /v1/admin/history/{image...}", h.getHistory)
+	}
+	return h
+}
+
+// ServeHTTP authenticates the request and dispatches it to the admin routes.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r.Header.Get("Authorization")) {
+		h.logger.Warn("unauthorized admin request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized compares the header against every token in constant time.
+func (h *Handler) authorized(auth string) bool {
+	ok := false
+	for _, token := range h.tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(auth), []byte("Token "+token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func (h *Handler) pin(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var until time.Time
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "duration must be a positive Go duration")
+			return
+		}
+		until = time.Now().Add(d)
+	}
+
+	if err := h.redis.PinImage(r.Context(), req.Image, until); err != nil {
+		h.writeStoreError(w, req.Image, err)
+		return
+	}
+
+	h.logger.Info("pinned image", "image", req.Image, "until", until, "remote_addr", r.RemoteAddr)
+	entry := historyEntry(r, audit.ActionPinned, req.Image)
+	if !until.IsZero() {
+		entry.Reason = "until " + until.UTC().Format(time.RFC3339)
+	}
+	h.history.Record(r.Context(), entry)
+	writeJSON(w, http.StatusOK, PinResponse{Image: req.Image, Pinned: true, PinnedUntil: until})
+}
+
+func (h *Handler) unpin(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.redis.UnpinImage(r.Context(), req.Image); err != nil {
+		h.writeStoreError(w, req.Image, err)
+		return
+	}
+
+	h.logger.Info("unpinned image", "image", req.Image, "remote_addr", r.RemoteAddr)
+	h.history.Record(r.Context(), historyEntry(r, audit.ActionUnpinned, req.Image))
+	writeJSON(w, http.StatusOK, PinResponse{Image: req.Image})
+}
+
+// BulkExpireRequest is the body of the bulk-expire endpoint. Durations use
+// Go syntax and sizes accept the same suffixes as STORAGE_BUDGET.
+type BulkExpireRequest struct {
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	MinAge     string `json:"min_age,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	MinSize    string `json:"min_size,omitempty"`
+	// Action is "expire" (default) or "delete".
+	Action string `json:"action,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+func (h *Handler) bulkExpire(w http.ResponseWriter, r *http.Request) {
+	var body BulkExpireRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req := BulkRequest{
+		Selector: Selector{Repository: body.Repository, Tag: body.Tag, Digest: body.Digest},
+		Action:   BulkAction(body.Action),
+		DryRun:   body.DryRun,
+		Actor:    audit.ActorAdmin,
+		Addr:     r.RemoteAddr,
+	}
+	if req.Action == "" {
+		req.Action = BulkExpire
+	}
+	if body.MinAge != "" {
+		d, err := time.ParseDuration(body.MinAge)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "min_age must be a Go duration")
+			return
+		}
+		req.Selector.MinAge = d
+	}
+	if body.MinSize != "" {
+		n, err := config.ParseBytes(body.MinSize)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "min_size must be a size like 500Mi")
+			return
+		}
+		req.Selector.MinSize = n
+	}
+	if err := req.Selector.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Action != BulkExpire && (req.Action != BulkDelete || h.deleter == nil) {
+		writeError(w, http.StatusBadRequest, "action must be expire or delete")
+		return
+	}
+
+	result, err := Bulk(r.Context(), h.redis, h.deleter, h.history, req, h.logger.With("remote_addr", r.RemoteAddr))
+	if err != nil {
+		h.writeStoreError(w, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// historyEntry starts the history entry for a change requested by r.
+func historyEntry(r *http.Request, action audit.Action, image string) audit.Entry {
+	return audit.Entry{Action: action, Image: image, Actor: audit.ActorAdmin, Addr: r.RemoteAddr}
+}
+
+// decodeImageRequest parses the request body, writing a 400 response when it
+// is invalid.
+func decodeImageRequest(w http.ResponseWriter, r *http.Request) (ImageRequest, bool) {
+	var req ImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return req, false
+	}
+	if !strings.Contains(req.Image, ":") {
+		writeError(w, http.StatusBadRequest, "image must be given as repo:tag")
+		return req, false
+	}
+	return req, true
+}
+
+// writeStoreError maps a store error to a response.
+func (h *Handler) writeStoreError(w http.ResponseWriter, image string, err error) {
+	if errors.Is(err, redisclient.ErrNotTracked) {
+		writeError(w, http.StatusNotFound, "image not tracked")
+		return
+	}
+	if errors.Is(err, redisclient.ErrNotDeadLettered) {
+		writeError(w, http.StatusConflict, "image not dead-lettered")
+		return
+	}
+	h.logger.Error("admin request failed", "image", image, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
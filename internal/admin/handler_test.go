@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// mockStore implements the store methods the admin API uses. Calling any
+// other method panics on the nil embedded Store.
+type mockStore struct {
+	redisclient.Store
+	images     map[string]redisclient.Image
+	tagDigests map[string][]redisclient.TagDigest
+}
+
+// newMockStore tracks images expiring in the order given.
+func newMockStore(images ...string) *mockStore {
+	m := &mockStore{images: make(map[string]redisclient.Image)}
+	now := time.Now()
+	for i, image := range images {
+		m.images[image] = redisclient.Image{
+			Name:      image,
+			Created:   now.Add(-time.Hour),
+			Expires:   now.Add(time.Duration(i+1) * time.Hour),
+			SizeBytes: 1024,
+			Digest:    "sha256:" + image,
+		}
+	}
+	return m
+}
+
+func (m *mockStore) GetImage(_ context.Context, imageWithTag string) (redisclient.Image, error) {
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.Image{}, redisclient.ErrNotTracked
+	}
+	return img, nil
+}
+
+func (m *mockStore) TagDigests(_ context.Context, imageWithTag string) ([]redisclient.TagDigest, error) {
+	return m.tagDigests[imageWithTag], nil
+}
+
+func (m *mockStore) ListImagesByExpiry(_ context.Context, offset, limit int64) ([]string, error) {
+	names := make([]string, 0, len(m.images))
+	for name := range m.images {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return m.images[names[i]].Expires.Before(m.images[names[j]].Expires)
+	})
+	if offset >= int64(len(names)) {
+		return nil, nil
+	}
+	return names[offset:min(offset+limit, int64(len(names)))], nil
+}
+
+// ListImagesByExpiryAfter orders by expiry, then name, like the index.
+func (m *mockStore) ListImagesByExpiryAfter(
+	_ context.Context, after redisclient.ExpiryCursor, limit int64,
+) ([]redisclient.ExpiryCursor, error) {
+	entries := make([]redisclient.ExpiryCursor, 0, len(m.images))
+	for name, img := range m.images {
+		entries = append(entries, redisclient.ExpiryCursor{Image: name, Expires: img.Expires.UnixMilli()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Expires != entries[j].Expires {
+			return entries[i].Expires < entries[j].Expires
+		}
+		return entries[i].Image < entries[j].Image
+	})
+	var out []redisclient.ExpiryCursor
+	for _, e := range entries {
+		if after.Image != "" && (e.Expires < after.Expires || e.Expires == after.Expires && e.Image <= after.Image) {
+			continue
+		}
+		if int64(len(out)) == limit {
+			break
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (m *mockStore) SetExpiry(_ context.Context, imageWithTag string, expiresAt time.Time) error {
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.ErrNotTracked
+	}
+	img.Expires = expiresAt
+	m.images[imageWithTag] = img
+	return nil
+}
+
+func (m *mockStore) PinImage(_ context.Context, imageWithTag string, until time.Time) error {
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.ErrNotTracked
+	}
+	img.Pinned, img.PinnedUntil = true, until
+	m.images[imageWithTag] = img
+	return nil
+}
+
+func (m *mockStore) UnpinImage(_ context.Context, imageWithTag string) error {
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.ErrNotTracked
+	}
+	img.Pinned, img.PinnedUntil = false, time.Time{}
+	m.images[imageWithTag] = img
+	return nil
+}
+
+const testToken = "admin-secret"
+
+func newTestHandler(store *mockStore, opts ...Option) *Handler {
+	return NewHandler(store, []string{testToken}, time.Hour, 24*time.Hour, slog.Default(), opts...)
+}
+
+func do(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Auth(t *testing.T) {
+	tests := []struct {
+		name        string
+		adminTokens []string
+		token       string
+		wantStatus  int
+	}{
+		{"valid token", []string{testToken}, testToken, http.StatusOK},
+		{"second of several tokens", []string{"old", testToken}, testToken, http.StatusOK},
+		{"wrong token", []string{testToken}, "nope", http.StatusUnauthorized},
+		{"missing token", []string{testToken}, "", http.StatusUnauthorized},
+		{"empty token never matches", []string{""}, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(newMockStore("myapp:1h"), tt.adminTokens, time.Hour, 24*time.Hour, slog.Default())
+			rec := do(t, h, http.MethodPost, "/v1/admin/pin", tt.token, `{"image":"myapp:1h"}`)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Pin(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPinned bool
+		wantUntil  bool
+	}{
+		{"indefinitely", `{"image":"myapp:1h"}`, http.StatusOK, true, false},
+		{"with duration", `{"image":"myapp:1h","duration":"48h"}`, http.StatusOK, true, true},
+		{"invalid duration", `{"image":"myapp:1h","duration":"soon"}`, http.StatusBadRequest, false, false},
+		{"missing tag", `{"image":"myapp"}`, http.StatusBadRequest, false, false},
+		{"invalid JSON", `{`, http.StatusBadRequest, false, false},
+		{"not tracked", `{"image":"other:1h"}`, http.StatusNotFound, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore("myapp:1h")
+			h := newTestHandler(store)
+
+			rec := do(t, h, http.MethodPost, "/v1/admin/pin", testToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			img := store.images["myapp:1h"]
+			until, pinned := img.PinnedUntil, img.Pinned
+			if pinned != tt.wantPinned {
+				t.Fatalf("pinned = %v, want %v", pinned, tt.wantPinned)
+			}
+			if !pinned {
+				return
+			}
+			if tt.wantUntil && time.Until(until) < 47*time.Hour {
+				t.Errorf("expected pin to last about 48h, got until %v", until)
+			}
+			if !tt.wantUntil && !until.IsZero() {
+				t.Errorf("expected indefinite pin, got until %v", until)
+			}
+
+			var resp PinResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !resp.Pinned || resp.Image != "myapp:1h" {
+				t.Errorf("unexpected response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestHandler_Unpin(t *testing.T) {
+	store := newMockStore("myapp:1h")
+	_ = store.PinImage(t.Context(), "myapp:1h", time.Time{})
+	h := newTestHandler(store)
+
+	rec := do(t, h, http.MethodPost, "/v1/admin/unpin", testToken, `{"image":"myapp:1h"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if store.images["myapp:1h"].Pinned {
+		t.Error("expected image to be unpinned")
+	}
+
+	rec = do(t, h, http.MethodPost, "/v1/admin/unpin", testToken, `{"image":"other:1h"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for an untracked image", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// HistoryResponse is the history of one image, oldest entry first.
+type HistoryResponse struct {
+	Image   string `json:"image"`
+	Tracked bool   `json:"tracked"`
+	// Tombstone is the last entry if it ended tracking, i.e. when and why
+	// the image is gone.
+	Tombstone *audit.Entry  `json:"tombstone,omitempty"`
+	Entries   []audit.Entry `json:"entries"`
+}
+
+// getHistory serves GET /v1/admin/history/{repo:tag}?limit=. It answers for
+// images that are no longer tracked, as long as their history is retained.
+func (h *Handler) getHistory(w http.ResponseWriter, r *http.Request) {
+	image := r.PathValue("image")
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxListLimit)
+	}
+
+	entries, err := h.history.History(r.Context(), image, int64(limit))
+	if err != nil {
+		h.writeStoreError(w, image, err)
+		return
+	}
+	_, err = h.redis.GetImage(r.Context(), image)
+	if err != nil && !errors.Is(err, redisclient.ErrNotTracked) {
+		h.writeStoreError(w, image, err)
+		return
+	}
+	tracked := err == nil
+	if !tracked && len(entries) == 0 {
+		writeError(w, http.StatusNotFound, "no history for image")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HistoryResponse{
+		Image:     image,
+		Tracked:   tracked,
+		Tombstone: audit.Tombstone(entries),
+		Entries:   entries,
+	})
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+)
+
+// historyStore keeps image history in memory.
+type historyStore struct {
+	entries map[string][][]byte
+}
+
+func (s *historyStore) AppendHistory(_ context.Context, imageWithTag string, entry []byte, _ time.Duration) error {
+	if s.entries == nil {
+		s.entries = make(map[string][][]byte)
+	}
+	s.entries[imageWithTag] = append(s.entries[imageWithTag], entry)
+	return nil
+}
+
+func (s *historyStore) ImageHistory(_ context.Context, imageWithTag string, limit int64) ([][]byte, error) {
+	entries := s.entries[imageWithTag]
+	if int64(len(entries)) > limit {
+		entries = entries[int64(len(entries))-limit:]
+	}
+	return entries, nil
+}
+
+func TestHandler_History(t *testing.T) {
+	store := newMockStore("myapp:1h")
+	history := audit.New(&historyStore{}, time.Hour, slog.Default())
+	h := newTestHandler(store, WithHistory(history))
+
+	history.Record(t.Context(), audit.Entry{Action: audit.ActionTracked, Image: "myapp:1h", Actor: "ci-bot"})
+	for _, req := range []struct{ path, body string }{
+		{"/v1/admin/extend", `{"image":"myapp:1h","ttl":"12h"}`},
+		{"/v1/admin/pin", `{"image":"myapp:1h","duration":"48h"}`},
+	} {
+		if rec := do(t, h, http.MethodPost, req.path, testToken, req.body); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", req.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	history.Record(t.Context(), audit.Entry{Action: audit.ActionTracked, Image: "api:2h"})
+	history.Record(t.Context(), audit.Entry{
+		Action:    audit.ActionReaped,
+		Image:     "api:2h",
+		Digest:    "sha256:abc",
+		SizeBytes: 2048,
+		Actor:     audit.ActorReaper,
+		Reason:    "ttl",
+	})
+
+	t.Run("tracked image", func(t *testing.T) {
+		rec := do(t, h, http.MethodGet, "/v1/admin/history/myapp:1h", testToken, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decode[HistoryResponse](t, rec)
+		if !resp.Tracked || resp.Tombstone != nil || len(resp.Entries) != 3 {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		extended, pinned := resp.Entries[1], resp.Entries[2]
+		if extended.Action != audit.ActionExtended || extended.Actor != audit.ActorAdmin || extended.ExpiresAt.IsZero() {
+			t.Errorf("unexpected extended entry: %+v", extended)
+		}
+		if pinned.Action != audit.ActionPinned || pinned.Reason == "" {
+			t.Errorf("unexpected pinned entry: %+v", pinned)
+		}
+	})
+
+	t.Run("reaped image", func(t *testing.T) {
+		rec := do(t, h, http.MethodGet, "/v1/admin/history/api:2h", testToken, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decode[HistoryResponse](t, rec)
+		if resp.Tracked || resp.Tombstone == nil {
+			t.Fatalf("expected a tombstone, got %+v", resp)
+		}
+		if tomb := resp.Tombstone; tomb.Action != audit.ActionReaped || tomb.Reason != "ttl" ||
+			tomb.Digest != "sha256:abc" || tomb.SizeBytes != 2048 || tomb.Time.IsZero() {
+			t.Errorf("unexpected tombstone: %+v", tomb)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		rec := do(t, h, http.MethodGet, "/v1/admin/history/myapp:1h?limit=1", testToken, "")
+		if resp := decode[HistoryResponse](t, rec); len(resp.Entries) != 1 || resp.Entries[0].Action != audit.ActionPinned {
+			t.Errorf("expected only the newest entry, got %+v", resp.Entries)
+		}
+		if rec := do(t, h, http.MethodGet, "/v1/admin/history/myapp:1h?limit=x", testToken, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400 for an invalid limit", rec.Code)
+		}
+	})
+
+	t.Run("unknown image", func(t *testing.T) {
+		if rec := do(t, h, http.MethodGet, "/v1/admin/history/other:1h", testToken, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		rec := do(t, newTestHandler(store), http.MethodGet, "/v1/admin/history/myapp:1h", testToken, "")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404 without history", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+const (
+	// defaultListLimit and maxListLimit bound the page size of the list
+	// endpoint.
+	defaultListLimit = 100
+	maxListLimit     = 1000
+
+	// scanBatchSize is the number of index entries read per round trip
+	// while filtering.
+	scanBatchSize = 500
+)
+
+// ImageResponse describes a tracked image.
+type ImageResponse struct {
+	Image            string    `json:"image"`
+	Repository       string    `json:"repository"`
+	Tag              string    `json:"tag"`
+	Created          time.Time `json:"created,omitzero"`
+	Expires          time.Time `json:"expires"`
+	Remaining        string    `json:"remaining"`
+	RemainingSeconds int64     `json:"remaining_seconds"`
+	SizeBytes        int64     `json:"size_bytes"`
+	Digest           string    `json:"digest,omitempty"`
+	LastPulled       time.Time `json:"last_pulled,omitzero"`
+	Pinned           bool      `json:"pinned"`
+	PinnedUntil      time.Time `json:"pinned_until,omitzero"`
+	// ReapFailures counts the failed deletions since the last push or
+	// retry. The reaper backs off until RetryAt, or gives up once
+	// DeadLettered is set.
+	ReapFailures    int64     `json:"reap_failures,omitempty"`
+	LastReapError   string    `json:"last_reap_error,omitempty"`
+	LastReapFailure time.Time `json:"last_reap_failure,omitzero"`
+	RetryAt         time.Time `json:"retry_at,omitzero"`
+	DeadLettered    time.Time `json:"dead_lettered,omitzero"`
+}
+
+// ListResponse is one page of tracked images, ordered by expiry. Pass
+// NextCursor as the cursor parameter to fetch the next page; it is empty on
+// the last page.
+type ListResponse struct {
+	Images     []ImageResponse `json:"images"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// NewImageResponse describes img as seen at now.
+func NewImageResponse(img redisclient.Image, now time.Time) ImageResponse {
+	repo, tag, _ := strings.Cut(img.Name, ":")
+	remaining := max(img.Expires.Sub(now), 0).Truncate(time.Second)
+	return ImageResponse{
+		Image:            img.Name,
+		Repository:       repo,
+		Tag:              tag,
+		Created:          img.Created,
+		Expires:          img.Expires,
+		Remaining:        remaining.String(),
+		RemainingSeconds: int64(remaining.Seconds()),
+		SizeBytes:        img.SizeBytes,
+		Digest:           img.Digest,
+		LastPulled:       img.LastPulled,
+		Pinned:           img.PinnedAt(now),
+		PinnedUntil:      img.PinnedUntil,
+		ReapFailures:     img.ReapFailures,
+		LastReapError:    img.LastReapError,
+		LastReapFailure:  img.LastReapFailure,
+		RetryAt:          img.RetryAt,
+		DeadLettered:     img.DeadLettered,
+	}
+}
+
+// listImages serves GET /v1/admin/images?prefix=&tag=&cursor=&limit=.
+// prefix matches the start of the repository and tag is a path.Match glob.
+func (h *Handler) listImages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, tagGlob := q.Get("prefix"), q.Get("tag")
+	if _, err := path.Match(tagGlob, ""); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag pattern")
+		return
+	}
+
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxListLimit)
+	}
+
+	cursor, ok := parseCursor(q.Get("cursor"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	ctx := r.Context()
+	var names []string
+	next := ""
+scan:
+	for {
+		batch, err := h.redis.ListImagesByExpiryAfter(ctx, cursor, scanBatchSize)
+		if err != nil {
+			h.writeStoreError(w, "", err)
+			return
+		}
+		for _, entry := range batch {
+			cursor = entry
+			image := entry.Image
+			repo, tag, _ := strings.Cut(image, ":")
+			if !strings.HasPrefix(repo, prefix) {
+				continue
+			}
+			if tagGlob != "" {
+				if ok, _ := path.Match(tagGlob, tag); !ok {
+					continue
+				}
+			}
+			names = append(names, image)
+			if len(names) == limit {
+				next = formatCursor(cursor)
+				break scan
+			}
+		}
+		if len(batch) < scanBatchSize {
+			break
+		}
+	}
+
+	now := time.Now()
+	resp := ListResponse{Images: make([]ImageResponse, 0, len(names)), NextCursor: next}
+	for _, name := range names {
+		img, err := h.redis.GetImage(ctx, name)
+		if err != nil {
+			// Reaped between the index read and now.
+			continue
+		}
+		resp.Images = append(resp.Images, NewImageResponse(img, now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// formatCursor encodes the last listed entry of the expiry index as
+// "<expiry in Unix milliseconds>:<repo:tag>", which the next page resumes
+// after.
+func formatCursor(c redisclient.ExpiryCursor) string {
+	return strconv.FormatInt(c.Expires, 10) + ":" + c.Image
+}
+
+// parseCursor decodes a cursor from formatCursor. An empty cursor is the
+// start of the index.
+func parseCursor(s string) (redisclient.ExpiryCursor, bool) {
+	if s == "" {
+		return redisclient.ExpiryCursor{}, true
+	}
+	expires, image, ok := strings.Cut(s, ":")
+	if !ok || image == "" {
+		return redisclient.ExpiryCursor{}, false
+	}
+	ms, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return redisclient.ExpiryCursor{}, false
+	}
+	return redisclient.ExpiryCursor{Image: image, Expires: ms}, true
+}
+
+// getImage serves GET /v1/admin/images/{repo:tag}.
+func (h *Handler) getImage(w http.ResponseWriter, r *http.Request) {
+	image := r.PathValue("image")
+	img, err := h.redis.GetImage(r.Context(), image)
+	if err != nil {
+		h.writeStoreError(w, image, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewImageResponse(img, time.Now()))
+}
+
+// extend sets the expiry of an image to now + ttl. The ttl may not exceed
+// MAX_TTL, or the max_ttl of a matching policy rule.
+func (h *Handler) extend(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl <= 0 {
+		writeError(w, http.StatusBadRequest, "ttl must be a positive Go duration")
+		return
+	}
+	repo, tag, _ := strings.Cut(req.Image, ":")
+	maxTTL := h.policy.Policy().Resolve(repo, tag, policy.Defaults{DefaultTTL: h.defaultTTL, MaxTTL: h.maxTTL}).MaxTTL
+	if ttl > maxTTL {
+		writeError(w, http.StatusBadRequest, "ttl exceeds the maximum of "+maxTTL.String())
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if err := h.redis.SetExpiry(r.Context(), req.Image, expiresAt); err != nil {
+		h.writeStoreError(w, req.Image, err)
+		return
+	}
+
+	h.logger.Info("extended image expiry", "image", req.Image, "ttl", ttl, "expires", expiresAt, "remote_addr", r.RemoteAddr)
+	entry := historyEntry(r, audit.ActionExtended, req.Image)
+	entry.ExpiresAt = expiresAt
+	h.history.Record(r.Context(), entry)
+	h.writeImage(r.Context(), w, req.Image)
+}
+
+// expire makes an image expire now, so the next reap cycle deletes it
+// unless it is pinned.
+func (h *Handler) expire(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if err := h.redis.SetExpiry(r.Context(), req.Image, now); err != nil {
+		h.writeStoreError(w, req.Image, err)
+		return
+	}
+
+	h.logger.Info("expired image", "image", req.Image, "remote_addr", r.RemoteAddr)
+	entry := historyEntry(r, audit.ActionExpired, req.Image)
+	entry.ExpiresAt = now
+	h.history.Record(r.Context(), entry)
+	h.writeImage(r.Context(), w, req.Image)
+}
+
+// writeImage responds with the current record of an image.
+func (h *Handler) writeImage(ctx context.Context, w http.ResponseWriter, image string) {
+	img, err := h.redis.GetImage(ctx, image)
+	if err != nil {
+		h.writeStoreError(w, image, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, NewImageResponse(img, time.Now()))
+}
@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/policy"
+)
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return v
+}
+
+func names(images []ImageResponse) []string {
+	out := make([]string, len(images))
+	for i, img := range images {
+		out[i] = img.Image
+	}
+	return out
+}
+
+func TestHandler_ListImages(t *testing.T) {
+	store := newMockStore("ci/app:a", "myapp:1h", "ci/app:b", "ci/web:a", "ci/app:c")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+		wantNext   bool
+	}{
+		{"all by expiry", "", http.StatusOK, []string{"ci/app:a", "myapp:1h", "ci/app:b", "ci/web:a", "ci/app:c"}, false},
+		{"repo prefix", "?prefix=ci/app", http.StatusOK, []string{"ci/app:a", "ci/app:b", "ci/app:c"}, false},
+		{"tag glob", "?tag=a", http.StatusOK, []string{"ci/app:a", "ci/web:a"}, false},
+		{"prefix and tag glob", "?prefix=ci/&tag=%5Bab%5D", http.StatusOK, []string{"ci/app:a", "ci/app:b", "ci/web:a"}, false},
+		{"first page", "?prefix=ci/&limit=2", http.StatusOK, []string{"ci/app:a", "ci/app:b"}, true},
+		{"invalid limit", "?limit=0", http.StatusBadRequest, nil, false},
+		{"invalid cursor", "?cursor=x", http.StatusBadRequest, nil, false},
+		{"cursor without image", "?cursor=1700000000000:", http.StatusBadRequest, nil, false},
+		{"invalid tag glob", "?tag=%5B", http.StatusBadRequest, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(t, newTestHandler(store), http.MethodGet, "/v1/admin/images"+tt.query, testToken, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			resp := decode[ListResponse](t, rec)
+			if got := names(resp.Images); !slices.Equal(got, tt.want) {
+				t.Errorf("images = %v, want %v", got, tt.want)
+			}
+			if (resp.NextCursor != "") != tt.wantNext {
+				t.Errorf("next_cursor = %q, want one: %v", resp.NextCursor, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHandler_ListImages_Pagination(t *testing.T) {
+	store := newMockStore("ci/app:a", "myapp:1h", "ci/app:b", "ci/web:a", "ci/app:c")
+	h := newTestHandler(store)
+
+	var got []string
+	cursor := ""
+	for range 5 {
+		path := "/v1/admin/images?prefix=ci/&limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		rec := do(t, h, http.MethodGet, path, testToken, "")
+		resp := decode[ListResponse](t, rec)
+		got = append(got, names(resp.Images)...)
+		if cursor = resp.NextCursor; cursor == "" {
+			break
+		}
+	}
+
+	want := []string{"ci/app:a", "ci/app:b", "ci/web:a", "ci/app:c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged images = %v, want %v", got, want)
+	}
+}
+
+func TestHandler_ListImages_CursorSurvivesRemovals(t *testing.T) {
+	store := newMockStore("ci/app:a", "ci/app:b", "ci/app:c", "ci/app:d")
+	h := newTestHandler(store)
+
+	first := decode[ListResponse](t, do(t, h, http.MethodGet, "/v1/admin/images?limit=2", testToken, ""))
+	if got := names(first.Images); !slices.Equal(got, []string{"ci/app:a", "ci/app:b"}) {
+		t.Fatalf("first page = %v", got)
+	}
+
+	// Reaping listed images must not shift the next page.
+	delete(store.images, "ci/app:a")
+	delete(store.images, "ci/app:b")
+
+	rec := do(t, h, http.MethodGet, "/v1/admin/images?limit=2&cursor="+url.QueryEscape(first.NextCursor), testToken, "")
+	if got := names(decode[ListResponse](t, rec).Images); !slices.Equal(got, []string{"ci/app:c", "ci/app:d"}) {
+		t.Errorf("second page = %v, want [ci/app:c ci/app:d]", got)
+	}
+}
+
+func TestHandler_GetImage(t *testing.T) {
+	store := newMockStore("ci/app:1h")
+	h := newTestHandler(store)
+
+	rec := do(t, h, http.MethodGet, "/v1/admin/images/ci/app:1h", testToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	resp := decode[ImageResponse](t, rec)
+	if resp.Repository != "ci/app" || resp.Tag != "1h" || resp.Digest != "sha256:ci/app:1h" || resp.SizeBytes != 1024 {
+		t.Errorf("unexpected image: %+v", resp)
+	}
+	if resp.RemainingSeconds <= 3500 || resp.RemainingSeconds > 3600 {
+		t.Errorf("expected about an hour remaining, got %ds (%s)", resp.RemainingSeconds, resp.Remaining)
+	}
+
+	rec = do(t, h, http.MethodGet, "/v1/admin/images/other:1h", testToken, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for an untracked image", rec.Code)
+	}
+}
+
+func TestHandler_Extend(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - repository: \"ci/*\"\n    max_ttl: 2h\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := policy.NewSource(file)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantTTL    time.Duration
+	}{
+		{"within MAX_TTL", `{"image":"myapp:1h","ttl":"12h"}`, http.StatusOK, 12 * time.Hour},
+		{"shorten", `{"image":"myapp:1h","ttl":"10m"}`, http.StatusOK, 10 * time.Minute},
+		{"beyond MAX_TTL", `{"image":"myapp:1h","ttl":"48h"}`, http.StatusBadRequest, 0},
+		{"beyond policy max_ttl", `{"image":"ci/app:1h","ttl":"3h"}`, http.StatusBadRequest, 0},
+		{"invalid ttl", `{"image":"myapp:1h","ttl":"-1h"}`, http.StatusBadRequest, 0},
+		{"not tracked", `{"image":"other:1h","ttl":"1h"}`, http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore("myapp:1h", "ci/app:1h")
+			before := store.images["myapp:1h"].Expires
+
+			rec := do(t, newTestHandler(store, WithPolicy(src)), http.MethodPost, "/v1/admin/extend", testToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			expires := store.images["myapp:1h"].Expires
+			if tt.wantStatus != http.StatusOK {
+				if !expires.Equal(before) {
+					t.Errorf("expected expiry to be unchanged, got %v", expires)
+				}
+				return
+			}
+			if d := time.Until(expires); d < tt.wantTTL-time.Minute || d > tt.wantTTL {
+				t.Errorf("expected expiry in %v, got %v", tt.wantTTL, d)
+			}
+			if resp := decode[ImageResponse](t, rec); !resp.Expires.Equal(expires) {
+				t.Errorf("response expires = %v, want %v", resp.Expires, expires)
+			}
+		})
+	}
+}
+
+func TestHandler_Expire(t *testing.T) {
+	store := newMockStore("myapp:1h")
+	h := newTestHandler(store)
+
+	rec := do(t, h, http.MethodPost, "/v1/admin/expire", testToken, `{"image":"myapp:1h"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if store.images["myapp:1h"].Expires.After(time.Now()) {
+		t.Error("expected image to expire now")
+	}
+	if resp := decode[ImageResponse](t, rec); resp.RemainingSeconds != 0 {
+		t.Errorf("expected no time remaining, got %s", resp.Remaining)
+	}
+
+	rec = do(t, h, http.MethodPost, "/v1/admin/expire", testToken, `{"image":"other:1h"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 for an untracked image", rec.Code)
+	}
+}
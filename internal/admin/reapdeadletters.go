@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+)
+
+// listReapDeadLetters serves GET /v1/admin/reap-dead-letters, the images the
+// reaper gave up on after repeated failed deletions, oldest first.
+func (h *Handler) listReapDeadLetters(w http.ResponseWriter, r *http.Request) {
+	names, err := h.redis.ListReapDeadLetters(r.Context())
+	if err != nil {
+		h.writeStoreError(w, "", err)
+		return
+	}
+
+	now := time.Now()
+	resp := ListResponse{Images: make([]ImageResponse, 0, len(names))}
+	for _, name := range names {
+		img, err := h.redis.GetImage(r.Context(), name)
+		if err != nil {
+			// Removed between the set read and now.
+			continue
+		}
+		resp.Images = append(resp.Images, NewImageResponse(img, now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// retryReapDeadLetter takes an image out of the dead-letter set, so the next
+// reap cycle tries to delete it again if it expired.
+func (h *Handler) retryReapDeadLetter(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeImageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.redis.RetryReapDeadLetter(r.Context(), req.Image); err != nil {
+		h.writeStoreError(w, req.Image, err)
+		return
+	}
+
+	h.logger.Info("retrying dead-lettered image", "image", req.Image, "remote_addr", r.RemoteAddr)
+	h.history.Record(r.Context(), historyEntry(r, audit.ActionRetried, req.Image))
+	h.writeImage(r.Context(), w, req.Image)
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+func (m *mockStore) ListReapDeadLetters(context.Context) ([]string, error) {
+	var names []string
+	for name, img := range m.images {
+		if !img.DeadLettered.IsZero() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *mockStore) RetryReapDeadLetter(_ context.Context, imageWithTag string) error {
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.ErrNotTracked
+	}
+	if img.DeadLettered.IsZero() {
+		return redisclient.ErrNotDeadLettered
+	}
+	img.ReapFailures, img.LastReapError, img.DeadLettered = 0, "", time.Time{}
+	m.images[imageWithTag] = img
+	return nil
+}
+
+func TestHandler_DeadLetters(t *testing.T) {
+	store := newMockStore("myapp:1h", "myapp:2h", "other:1h")
+	for _, name := range []string{"myapp:2h", "other:1h"} {
+		img := store.images[name]
+		img.ReapFailures = 10
+		img.LastReapError = "DELETE manifest returned 405"
+		img.DeadLettered = time.Now()
+		store.images[name] = img
+	}
+	h := newTestHandler(store)
+
+	rec := do(t, h, http.MethodGet, "/v1/admin/reap-dead-letters", testToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var list ListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(list.Images) != 2 || list.Images[0].Image != "myapp:2h" || list.Images[1].Image != "other:1h" {
+		t.Fatalf("unexpected dead letters: %+v", list.Images)
+	}
+	if got := list.Images[0]; got.ReapFailures != 10 || got.LastReapError == "" || got.DeadLettered.IsZero() {
+		t.Errorf("expected failure details, got %+v", got)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"dead-lettered", `{"image":"myapp:2h"}`, http.StatusOK},
+		{"not dead-lettered", `{"image":"myapp:1h"}`, http.StatusConflict},
+		{"not tracked", `{"image":"gone:1h"}`, http.StatusNotFound},
+		{"missing tag", `{"image":"myapp"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(t, h, http.MethodPost, "/v1/admin/reap-dead-letters/retry", testToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	if img := store.images["myapp:2h"]; !img.DeadLettered.IsZero() || img.ReapFailures != 0 {
+		t.Errorf("expected the retried image to be cleared, got %+v", img)
+	}
+}
@@ -0,0 +1,158 @@
+// Package audit keeps a history of image lifecycle transitions that outlives
+// the tracking record, so it can still answer who pushed an image and why it
+// is gone after it was reaped.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+)
+
+// Action identifies a lifecycle transition.
+type Action string
+
+const (
+	// ActionTracked is recorded when a push starts tracking an image.
+	ActionTracked Action = "tracked"
+	// ActionRepushed is recorded when the tracked digest is pushed again,
+	// refreshing the expiry.
+	ActionRepushed Action = "repushed"
+	// ActionOverwritten is recorded when a push moves a tag to a different
+	// digest. If the tag is immutable, Reason is "rejected", "rolled_back"
+	// or "rollback_failed".
+	ActionOverwritten Action = "overwritten"
+	// ActionExtended is recorded when an operator or extend link moves the
+	// expiry. Extensions by pulls (sliding expiry) are not recorded.
+	ActionExtended Action = "extended"
+	// ActionExpired is recorded when an operator expires an image early.
+	ActionExpired Action = "expired"
+	// ActionPinned is recorded when an image is pinned. Reason is
+	// "until <time>" for a limited pin.
+	ActionPinned Action = "pinned"
+	// ActionUnpinned is recorded when a pin is removed on request.
+	ActionUnpinned Action = "unpinned"
+	// ActionReaped is recorded after the reaper deleted an image. Reason is
+	// the reap reason: ttl, count, budget or manual.
+	ActionReaped Action = "reaped"
+	// ActionDeleteFailed is recorded when the reaper failed to delete an
+	// image.
+	ActionDeleteFailed Action = "delete_failed"
+	// ActionDeadLettered is recorded when the reaper gives up on an image
+	// after repeated failed deletions. Reason is "<n> failures".
+	ActionDeadLettered Action = "dead_lettered"
+	// ActionRetried is recorded when an operator takes an image out of the
+	// dead-letter set.
+	ActionRetried Action = "retried"
+	// ActionUntracked is recorded when tracking stops without a reap, e.g.
+	// after a registry delete or for a keep annotation.
+	ActionUntracked Action = "untracked"
+)
+
+// Actors for transitions not caused by a registry client.
+const (
+	ActorAdmin      = "admin"
+	ActorCLI        = "cli"
+	ActorReaper     = "reaper"
+	ActorExtendLink = "extend-link"
+)
+
+// Entry is one recorded transition.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	Image  string    `json:"image"`
+	Digest string    `json:"digest,omitempty"`
+	// PreviousDigest is the digest the tag pointed at before an overwrite.
+	PreviousDigest string    `json:"previous_digest,omitempty"`
+	SizeBytes      int64     `json:"size_bytes,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at,omitzero"`
+	// Actor is the registry user for pushes and deletes, when the registry
+	// authenticates them, and otherwise one of the Actor constants.
+	Actor string `json:"actor,omitempty"`
+	// Addr is the client address of the request that caused the transition.
+	Addr   string `json:"addr,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Final reports whether the entry ended the tracking of the image.
+func (e Entry) Final() bool {
+	return e.Action == ActionReaped || e.Action == ActionUntracked
+}
+
+// Store persists history entries per image.
+type Store interface {
+	AppendHistory(ctx context.Context, imageWithTag string, entry []byte, retention time.Duration) error
+	ImageHistory(ctx context.Context, imageWithTag string, limit int64) ([][]byte, error)
+}
+
+// writeTimeout bounds writing an entry, which may happen after the request
+// that caused it was cancelled.
+const writeTimeout = 5 * time.Second
+
+// Recorder writes and reads image history. A nil Recorder records nothing.
+type Recorder struct {
+	store     Store
+	retention time.Duration
+	logger    *slog.Logger
+}
+
+// New creates a Recorder that keeps entries for retention.
+func New(store Store, retention time.Duration, logger *slog.Logger) *Recorder {
+	return &Recorder{store: store, retention: retention, logger: logger}
+}
+
+// Record appends e to the history of e.Image. Failures are logged and
+// counted; they never fail the transition itself.
+func (r *Recorder) Record(ctx context.Context, e Entry) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		r.logger.Error("failed to encode history entry", "image", e.Image, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if err := r.store.AppendHistory(ctx, e.Image, body, r.retention); err != nil {
+		metrics.AuditWriteErrors.Inc()
+		r.logger.Warn("failed to record image history", "image", e.Image, "action", string(e.Action), "error", err)
+	}
+}
+
+// History returns up to limit of the newest entries of an image, oldest
+// first. Entries that cannot be decoded are skipped.
+func (r *Recorder) History(ctx context.Context, imageWithTag string, limit int64) ([]Entry, error) {
+	raw, err := r.store.ImageHistory(ctx, imageWithTag, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(raw))
+	for _, b := range raw {
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			r.logger.Debug("skipping undecodable history entry", "image", imageWithTag, "error", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Tombstone returns the last entry if it ended the tracking of the image,
+// i.e. it tells when and why an image is gone.
+func Tombstone(entries []Entry) *Entry {
+	if len(entries) == 0 || !entries[len(entries)-1].Final() {
+		return nil
+	}
+	return &entries[len(entries)-1]
+}
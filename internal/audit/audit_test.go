@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	entries   map[string][][]byte
+	retention time.Duration
+	err       error
+}
+
+func (m *mockStore) AppendHistory(_ context.Context, imageWithTag string, entry []byte, retention time.Duration) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.entries == nil {
+		m.entries = make(map[string][][]byte)
+	}
+	m.entries[imageWithTag] = append(m.entries[imageWithTag], entry)
+	m.retention = retention
+	return nil
+}
+
+func (m *mockStore) ImageHistory(_ context.Context, imageWithTag string, limit int64) ([][]byte, error) {
+	entries := m.entries[imageWithTag]
+	if int64(len(entries)) > limit {
+		entries = entries[int64(len(entries))-limit:]
+	}
+	return entries, nil
+}
+
+func TestRecorder(t *testing.T) {
+	store := &mockStore{}
+	r := New(store, 24*time.Hour, slog.Default())
+
+	r.Record(t.Context(), Entry{Action: ActionTracked, Image: "api:2h", Digest: "sha256:a", Actor: "ci-bot"})
+	r.Record(t.Context(), Entry{Action: ActionRepushed, Image: "api:2h", Digest: "sha256:a"})
+	r.Record(t.Context(), Entry{Action: ActionReaped, Image: "api:2h", Digest: "sha256:a", SizeBytes: 1024, Reason: "ttl"})
+	r.Record(t.Context(), Entry{Action: ActionTracked, Image: "other:1h"})
+
+	if store.retention != 24*time.Hour {
+		t.Errorf("retention = %s, want 24h", store.retention)
+	}
+
+	entries, err := r.History(t.Context(), "api:2h", 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Action != ActionTracked || entries[0].Actor != "ci-bot" || entries[0].Time.IsZero() {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+
+	tomb := Tombstone(entries)
+	if tomb == nil || tomb.Action != ActionReaped || tomb.Reason != "ttl" || tomb.SizeBytes != 1024 {
+		t.Errorf("unexpected tombstone: %+v", tomb)
+	}
+
+	latest, err := r.History(t.Context(), "api:2h", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(latest) != 1 || latest[0].Action != ActionReaped {
+		t.Errorf("expected only the newest entry, got %+v", latest)
+	}
+}
+
+func TestTombstone(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []Action
+		want    Action
+	}{
+		{name: "no history"},
+		{name: "still tracked", actions: []Action{ActionTracked, ActionExtended}},
+		{name: "reaped", actions: []Action{ActionTracked, ActionReaped}, want: ActionReaped},
+		{name: "untracked", actions: []Action{ActionTracked, ActionUntracked}, want: ActionUntracked},
+		{name: "failed delete", actions: []Action{ActionTracked, ActionDeleteFailed}},
+		{name: "pushed again after reap", actions: []Action{ActionReaped, ActionTracked}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []Entry
+			for _, a := range tt.actions {
+				entries = append(entries, Entry{Action: a})
+			}
+			got := Tombstone(entries)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("expected no tombstone, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.Action != tt.want {
+				t.Errorf("tombstone = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Record(t.Context(), Entry{Action: ActionTracked, Image: "api:2h"})
+}
+
+func TestRecorder_StoreErrorIsNotFatal(t *testing.T) {
+	r := New(&mockStore{err: errors.New("redis down")}, time.Hour, slog.Default())
+	r.Record(t.Context(), Entry{Action: ActionTracked, Image: "api:2h"})
+}
@@ -2,7 +2,12 @@ package config
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/tamcore/ephemeron/internal/immutability"
 )
 
 // Config holds all configuration for the application.
@@ -19,6 +24,10 @@ type Config struct {
 	// HookToken is the shared secret for registry webhook authentication.
 	HookToken string
 
+	// AdminTokens authenticate the admin API; any of them is accepted, so
+	// tokens can be rotated. Empty = admin API disabled.
+	AdminTokens []string
+
 	// RegistryURL is the base URL of the OCI registry (used by the reaper).
 	RegistryURL string
 
@@ -31,9 +40,35 @@ type Config struct {
 	// MaxTTL is the maximum allowed TTL.
 	MaxTTL time.Duration
 
+	// SlidingTTLIdle enables sliding expiry when positive: each pull pushes the
+	// expiry of a tracked image out to now+SlidingTTLIdle, capped at MaxTTL
+	// after the image was last pushed.
+	SlidingTTLIdle time.Duration
+
 	// ReapInterval is how often the reaper checks for expired images.
 	ReapInterval time.Duration
 
+	// ReapConcurrency is the number of expired images deleted in parallel.
+	ReapConcurrency int
+
+	// ReapMaxDeletions caps the deletions of one reap cycle; the rest of a
+	// backlog is left for the following cycles. Zero = no limit.
+	ReapMaxDeletions int
+
+	// ReapMaxDuration stops a reap cycle from starting new deletions once it
+	// has run this long. Zero = no limit.
+	ReapMaxDuration time.Duration
+
+	// ReapRetryBackoff is how long the reaper leaves an image alone after a
+	// failed deletion, doubled with every further failure up to
+	// ReapRetryMaxBackoff. Zero = retry every cycle.
+	ReapRetryBackoff    time.Duration
+	ReapRetryMaxBackoff time.Duration
+
+	// ReapMaxFailures moves an image to the dead-letter set after this many
+	// failed deletions in a row. Zero = never.
+	ReapMaxFailures int
+
 	// LogFormat controls log output: "json" or "text".
 	LogFormat string
 
@@ -41,6 +76,81 @@ type Config struct {
 	// Empty list = observability mode only (default). Example: ["prod-*", "release-*"]
 	ImmutableTagPatterns []string
 
+	// ImmutabilityRules are repository-scoped immutability rules, checked
+	// before ImmutableTagPatterns; see immutability.ParseRules for the format.
+	// Example: "releases release/* /v\d+\.\d+\.\d+/; sandbox sandbox/* * mutable"
+	ImmutabilityRules string
+
+	// ImmutabilityMode selects how overwrites of immutable tags are enforced:
+	// "reject" fails the webhook, "rollback" restores the tag to the tracked
+	// digest.
+	ImmutabilityMode string
+
+	// PolicyFile is the path to a YAML file of per-repository TTL and
+	// immutability rules. Empty = global settings only.
+	PolicyFile string
+
+	// NotifyFile is the path to a YAML file of outbound notification sinks.
+	// Empty = no notifications.
+	NotifyFile string
+
+	// TTLAnnotationKeys are manifest annotation / config label keys that set
+	// an image's TTL, checked in order and taking precedence over the tag.
+	// A value of "keep" or "pin" exempts the image from expiry. Empty = tag only.
+	TTLAnnotationKeys []string
+
+	// WebhookWorkers is the number of workers processing queued webhook events.
+	// Zero processes events synchronously within the webhook request.
+	WebhookWorkers int
+
+	// EventDedupRetention is how long processed webhook event IDs are
+	// remembered so redelivered events are not applied twice. Zero disables it.
+	EventDedupRetention time.Duration
+
+	// StorageBudget caps the summed size of tracked images in bytes. When
+	// exceeded, the reaper evicts images before their expiry. Zero disables it.
+	StorageBudget int64
+
+	// StorageRepoBudgets caps tracked bytes per repository prefix, e.g.
+	// {"ci/": 10Gi}.
+	StorageRepoBudgets map[string]int64
+
+	// StorageLowWatermark is the fraction of a budget that eviction brings
+	// usage back down to.
+	StorageLowWatermark float64
+
+	// EvictionOrder selects eviction candidates first: "expiry" (soonest to
+	// expire) or "created" (least recently pushed).
+	EvictionOrder string
+
+	// ExpiryWarning is how long before its expiry an image triggers a single
+	// "expiring soon" warning. Zero disables warnings.
+	ExpiryWarning time.Duration
+
+	// ExtendLinkSecret signs the one-click extend links in warnings. Empty
+	// disables the links and the GET /v1/extend endpoint.
+	ExtendLinkSecret string
+
+	// ExtendLinkTTL is the lifetime from now that an extend link gives an
+	// image, capped at MAX_TTL or the policy max_ttl.
+	ExtendLinkTTL time.Duration
+
+	// PublicURL is the externally reachable base URL of Ephemeron, used to
+	// build extend links.
+	PublicURL string
+
+	// SMTPAddr is the host:port of a mail relay for expiry warnings. Empty
+	// disables mail.
+	SMTPAddr string
+	SMTPFrom string
+	SMTPTo   []string
+	// SMTPTimeout bounds sending one warning mail.
+	SMTPTimeout time.Duration
+
+	// AuditRetention is how long image history entries are kept, including
+	// after the image is reaped. Zero disables the history.
+	AuditRetention time.Duration
+
 	// HealthFailureThreshold is the number of consecutive all-failed reap cycles
 	// before the liveness probe reports unhealthy.
 	HealthFailureThreshold int
@@ -54,6 +164,9 @@ func (c *Config) Validate() error {
 	if c.HookToken == "" {
 		return fmt.Errorf("HOOK_TOKEN is required")
 	}
+	if slices.Contains(c.AdminTokens, c.HookToken) {
+		return fmt.Errorf("ADMIN_TOKENS must not include HOOK_TOKEN")
+	}
 	if c.RegistryURL == "" {
 		return fmt.Errorf("REGISTRY_URL is required")
 	}
@@ -66,8 +179,118 @@ func (c *Config) Validate() error {
 	if c.DefaultTTL > c.MaxTTL {
 		return fmt.Errorf("DEFAULT_TTL (%s) must not exceed MAX_TTL (%s)", c.DefaultTTL, c.MaxTTL)
 	}
+	if c.SlidingTTLIdle < 0 {
+		return fmt.Errorf("SLIDING_TTL_IDLE must not be negative")
+	}
+	if c.ReapConcurrency <= 0 {
+		return fmt.Errorf("REAP_CONCURRENCY must be positive")
+	}
+	if c.ReapMaxDeletions < 0 {
+		return fmt.Errorf("REAP_MAX_DELETIONS must not be negative")
+	}
+	if c.ReapMaxDuration < 0 {
+		return fmt.Errorf("REAP_MAX_DURATION must not be negative")
+	}
+	if c.ReapRetryBackoff < 0 {
+		return fmt.Errorf("REAP_RETRY_BACKOFF must not be negative")
+	}
+	if c.ReapRetryMaxBackoff < c.ReapRetryBackoff {
+		return fmt.Errorf("REAP_RETRY_MAX_BACKOFF must not be less than REAP_RETRY_BACKOFF")
+	}
+	if c.ReapMaxFailures < 0 {
+		return fmt.Errorf("REAP_MAX_FAILURES must not be negative")
+	}
+	if c.WebhookWorkers < 0 {
+		return fmt.Errorf("WEBHOOK_WORKERS must not be negative")
+	}
+	if c.EventDedupRetention < 0 {
+		return fmt.Errorf("EVENT_DEDUP_RETENTION must not be negative")
+	}
+	if c.StorageBudget < 0 {
+		return fmt.Errorf("STORAGE_BUDGET must be a non-negative size like 45Gi")
+	}
+	for prefix, n := range c.StorageRepoBudgets {
+		if prefix == "" || n <= 0 {
+			return fmt.Errorf("STORAGE_REPO_BUDGETS entry %q must be prefix=size with a positive size", prefix)
+		}
+	}
+	if c.StorageLowWatermark <= 0 || c.StorageLowWatermark > 1 {
+		return fmt.Errorf("STORAGE_LOW_WATERMARK must be in (0, 1]")
+	}
+	if c.EvictionOrder != "expiry" && c.EvictionOrder != "created" {
+		return fmt.Errorf("EVICTION_ORDER must be \"expiry\" or \"created\"")
+	}
+	if _, err := c.Immutability(); err != nil {
+		return err
+	}
+	if c.ImmutabilityMode != "reject" && c.ImmutabilityMode != "rollback" {
+		return fmt.Errorf("IMMUTABILITY_MODE must be \"reject\" or \"rollback\"")
+	}
+	if c.ExpiryWarning < 0 {
+		return fmt.Errorf("EXPIRY_WARNING must not be negative")
+	}
+	if c.ExtendLinkSecret != "" && c.ExtendLinkTTL <= 0 {
+		return fmt.Errorf("EXTEND_LINK_TTL must be positive")
+	}
+	if c.SMTPAddr != "" && len(c.SMTPTo) == 0 {
+		return fmt.Errorf("SMTP_TO is required when SMTP_ADDR is set")
+	}
+	if c.SMTPAddr != "" && c.SMTPTimeout <= 0 {
+		return fmt.Errorf("SMTP_TIMEOUT must be positive")
+	}
+	if c.AuditRetention < 0 {
+		return fmt.Errorf("AUDIT_RETENTION must not be negative")
+	}
 	if c.HealthFailureThreshold <= 0 {
 		return fmt.Errorf("HEALTH_FAILURE_THRESHOLD must be positive")
 	}
 	return nil
 }
+
+// Immutability compiles ImmutabilityRules followed by ImmutableTagPatterns,
+// so an invalid pattern fails at startup rather than on every push.
+func (c *Config) Immutability() (*immutability.Rules, error) {
+	rules, err := immutability.ParseRules(c.ImmutabilityRules)
+	if err != nil {
+		return nil, fmt.Errorf("IMMUTABILITY_RULES: %w", err)
+	}
+	patterns, err := immutability.TagPatterns(c.ImmutableTagPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("IMMUTABLE_TAG_PATTERNS: %w", err)
+	}
+	return immutability.New(rules, patterns), nil
+}
+
+var byteUnits = map[string]int64{
+	"":   1,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"T":  1000 * 1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+}
+
+// ParseBytes parses a size such as "512Mi", "45Gi" or "1000000" into bytes,
+// using the Kubernetes quantity suffixes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := byteUnits[s[i:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return n * unit, nil
+}
@@ -16,7 +16,11 @@ func TestValidate(t *testing.T) {
 			DefaultTTL:             time.Hour,
 			MaxTTL:                 24 * time.Hour,
 			ReapInterval:           time.Minute,
+			ReapConcurrency:        4,
 			LogFormat:              "text",
+			StorageLowWatermark:    0.9,
+			EvictionOrder:          "expiry",
+			ImmutabilityMode:       "reject",
 			HealthFailureThreshold: 3,
 		}
 	}
@@ -44,6 +48,14 @@ func TestValidate(t *testing.T) {
 		}
 	})
 
+	t.Run("admin token reuses hook token", func(t *testing.T) {
+		c := base()
+		c.AdminTokens = []string{"admin", "secret"}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for an admin token equal to HookToken")
+		}
+	})
+
 	t.Run("missing registry url", func(t *testing.T) {
 		c := base()
 		c.RegistryURL = ""
@@ -52,6 +64,138 @@ func TestValidate(t *testing.T) {
 		}
 	})
 
+	t.Run("negative sliding ttl idle", func(t *testing.T) {
+		c := base()
+		c.SlidingTTLIdle = -time.Minute
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for negative SlidingTTLIdle")
+		}
+	})
+
+	t.Run("negative webhook workers", func(t *testing.T) {
+		c := base()
+		c.WebhookWorkers = -1
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for negative WebhookWorkers")
+		}
+	})
+
+	t.Run("negative event dedup retention", func(t *testing.T) {
+		c := base()
+		c.EventDedupRetention = -time.Hour
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for negative EventDedupRetention")
+		}
+	})
+
+	t.Run("negative storage budget", func(t *testing.T) {
+		c := base()
+		c.StorageBudget = -1
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for invalid StorageBudget")
+		}
+	})
+
+	t.Run("invalid repo budget", func(t *testing.T) {
+		c := base()
+		c.StorageRepoBudgets = map[string]int64{"ci/": -1}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for invalid StorageRepoBudgets")
+		}
+	})
+
+	t.Run("low watermark out of range", func(t *testing.T) {
+		c := base()
+		c.StorageLowWatermark = 1.5
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for StorageLowWatermark above 1")
+		}
+	})
+
+	t.Run("reap limits", func(t *testing.T) {
+		for name, mutate := range map[string]func(*Config){
+			"zero concurrency":       func(c *Config) { c.ReapConcurrency = 0 },
+			"negative max deletions": func(c *Config) { c.ReapMaxDeletions = -1 },
+			"negative max duration":  func(c *Config) { c.ReapMaxDuration = -time.Minute },
+			"negative retry backoff": func(c *Config) { c.ReapRetryBackoff = -time.Minute },
+			"max backoff below backoff": func(c *Config) {
+				c.ReapRetryBackoff, c.ReapRetryMaxBackoff = time.Hour, time.Minute
+			},
+			"negative max failures": func(c *Config) { c.ReapMaxFailures = -1 },
+		} {
+			c := base()
+			mutate(&c)
+			if err := c.Validate(); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+
+	t.Run("unknown eviction order", func(t *testing.T) {
+		c := base()
+		c.EvictionOrder = "random"
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for unknown EvictionOrder")
+		}
+	})
+
+	t.Run("invalid immutability rule", func(t *testing.T) {
+		c := base()
+		c.ImmutabilityRules = `releases release/* /v(\d+/`
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for invalid ImmutabilityRules regex")
+		}
+	})
+
+	t.Run("invalid immutable tag pattern", func(t *testing.T) {
+		c := base()
+		c.ImmutableTagPatterns = []string{"[prod"}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for invalid ImmutableTagPatterns glob")
+		}
+	})
+
+	t.Run("unknown immutability mode", func(t *testing.T) {
+		c := base()
+		c.ImmutabilityMode = "revert"
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for unknown ImmutabilityMode")
+		}
+	})
+
+	t.Run("smtp without recipients", func(t *testing.T) {
+		c := base()
+		c.SMTPAddr = "localhost:25"
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for SMTPAddr without SMTPTo")
+		}
+	})
+
+	t.Run("smtp without timeout", func(t *testing.T) {
+		c := base()
+		c.SMTPAddr = "localhost:25"
+		c.SMTPTo = []string{"ops@example.com"}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for SMTPAddr without SMTPTimeout")
+		}
+	})
+
+	t.Run("extend links without ttl", func(t *testing.T) {
+		c := base()
+		c.ExtendLinkSecret = "secret"
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for ExtendLinkSecret without ExtendLinkTTL")
+		}
+	})
+
+	t.Run("negative audit retention", func(t *testing.T) {
+		c := base()
+		c.AuditRetention = -time.Hour
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for negative AuditRetention")
+		}
+	})
+
 	t.Run("default exceeds max", func(t *testing.T) {
 		c := base()
 		c.DefaultTTL = 48 * time.Hour
@@ -76,3 +220,33 @@ func TestValidate(t *testing.T) {
 		}
 	})
 }
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1000", 1000, false},
+		{"512Mi", 512 << 20, false},
+		{"45Gi", 45 << 30, false},
+		{"2G", 2000000000, false},
+		{" 1Ti ", 1 << 40, false},
+		{"", 0, true},
+		{"Gi", 0, true},
+		{"10GB", 0, true},
+		{"-5Gi", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBytes(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBytes(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBytes(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,27 +3,93 @@ package hooks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"path/filepath"
 	"time"
 
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/immutability"
 	"github.com/tamcore/ephemeron/internal/metrics"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
 	redisclient "github.com/tamcore/ephemeron/internal/redis"
 	"github.com/tamcore/ephemeron/internal/registry"
 )
 
 // RegistryEvent represents a single event from the Docker Registry webhook.
 type RegistryEvent struct {
-	Action string      `json:"action"`
-	Target EventTarget `json:"target"`
+	// ID uniquely identifies the event. Retried envelopes carry the same IDs.
+	ID        string       `json:"id,omitempty"`
+	Timestamp time.Time    `json:"timestamp,omitzero"`
+	Action    string       `json:"action"`
+	Target    EventTarget  `json:"target"`
+	Request   EventRequest `json:"request,omitzero"`
+	Actor     EventActor   `json:"actor,omitzero"`
+	Source    EventSource  `json:"source,omitzero"`
 }
 
-// EventTarget contains the repository and tag from a registry event.
+// EventRequest describes the registry API request that caused an event.
+type EventRequest struct {
+	ID        string `json:"id,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Method    string `json:"method,omitempty"`
+	UserAgent string `json:"useragent,omitempty"`
+}
+
+// EventActor identifies who initiated an event, when authentication is enabled.
+type EventActor struct {
+	Name string `json:"name,omitempty"`
+}
+
+// EventSource identifies the registry instance that generated an event.
+type EventSource struct {
+	Addr       string `json:"addr,omitempty"`
+	InstanceID string `json:"instanceID,omitempty"`
+}
+
+// EventTarget contains the repository, tag and digest from a registry event.
+// Delete events carry either a tag (tag delete) or only a digest (manifest delete).
 type EventTarget struct {
 	Repository string `json:"repository"`
 	Tag        string `json:"tag"`
+	Digest     string `json:"digest,omitempty"`
+	MediaType  string `json:"mediaType,omitempty"`
+	// Size is the size of the manifest itself, not of the image.
+	Size int64 `json:"size,omitempty"`
+	// References lists the config and layer blobs of a manifest, or the child
+	// manifests of an index. Only sent when the registry endpoint has
+	// includereferences enabled.
+	References []EventDescriptor `json:"references,omitempty"`
+}
+
+// EventDescriptor describes content referenced by an event target.
+type EventDescriptor struct {
+	MediaType string `json:"mediaType,omitempty"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// manifestInfo derives the digest and image size from the event itself. It
+// reports false when the event lacks the digest or references, or describes
+// an image index whose references are manifests rather than blobs; the
+// manifest must then be fetched from the registry.
+func (t EventTarget) manifestInfo() (*registry.ManifestInfo, bool) {
+	if t.Digest == "" || len(t.References) == 0 || registry.IsIndex(t.MediaType) {
+		return nil, false
+	}
+
+	var size int64
+	for _, ref := range t.References {
+		size += ref.Size
+	}
+	return &registry.ManifestInfo{
+		Digest:    t.Digest,
+		MediaType: t.MediaType,
+		SizeBytes: size,
+	}, true
 }
 
 // EventEnvelope is the top-level structure sent by the Docker Registry.
@@ -31,21 +97,135 @@ type EventEnvelope struct {
 	Events []RegistryEvent `json:"events"`
 }
 
+// Event outcomes reported in EventResult.Status.
+const (
+	StatusProcessed = "processed"
+	StatusDuplicate = "duplicate"
+	StatusIgnored   = "ignored"
+	StatusQueued    = "queued"
+	StatusFailed    = "failed"
+)
+
+// EventResult reports the outcome of a single event in an envelope.
+type EventResult struct {
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// EventResponse is the webhook response body.
+type EventResponse struct {
+	Results []EventResult `json:"results"`
+}
+
+// ErrImmutableTag is returned when a push overwrites an immutable tag.
+var ErrImmutableTag = errors.New("tag is immutable, overwrite rejected")
+
+// Immutability modes select what happens when a push overwrites an immutable
+// tag. The registry has already accepted the push by the time it is notified.
+const (
+	// ImmutabilityReject fails the event, leaving the tag on the new digest.
+	ImmutabilityReject = "reject"
+	// ImmutabilityRollback acknowledges the event and restores the tag to
+	// the tracked digest.
+	ImmutabilityRollback = "rollback"
+)
+
+// rollbackMarkerTTL bounds how long a rollback waits for the push event of
+// the restored manifest.
+const rollbackMarkerTTL = 5 * time.Minute
+
 // registryClient is the subset of registry operations needed by the handler.
 type registryClient interface {
 	GetImageSize(ctx context.Context, repo, tag string) (int64, error)
 	GetImageManifestInfo(ctx context.Context, repo, tag string) (*registry.ManifestInfo, error)
+	GetImageAnnotations(ctx context.Context, repo, reference string) (map[string]string, error)
+	RestoreTag(ctx context.Context, repo, tag, digest string) error
 }
 
 // Handler handles incoming registry webhook events.
 type Handler struct {
-	redis                redisclient.Store
-	registry             registryClient
-	hookToken            string
-	defaultTTL           time.Duration
-	maxTTL               time.Duration
-	logger               *slog.Logger
-	immutableTagPatterns []string
+	redis             redisclient.Store
+	registry          registryClient
+	hookToken         string
+	defaultTTL        time.Duration
+	maxTTL            time.Duration
+	logger            *slog.Logger
+	immutable         *immutability.Rules
+	slidingIdle       time.Duration
+	queue             redisclient.EventQueue
+	dedupRetention    time.Duration
+	ttlAnnotationKeys []string
+	policy            *policy.Source
+	notifier          *notify.Dispatcher
+	history           *audit.Recorder
+	immutabilityMode  string
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithSlidingTTL enables sliding expiry: each pull of a tracked tag pushes its
+// expiry out to now+idle, capped at MAX_TTL after the image was created.
+// A zero idle window leaves sliding expiry disabled.
+func WithSlidingTTL(idle time.Duration) Option {
+	return func(h *Handler) {
+		h.slidingIdle = idle
+	}
+}
+
+// WithQueue makes the handler append events to a durable queue and answer
+// 202 immediately. A Worker processes the queued events.
+func WithQueue(q redisclient.EventQueue) Option {
+	return func(h *Handler) {
+		h.queue = q
+	}
+}
+
+// WithDedup records processed event IDs for the given retention, so events
+// redelivered within that window are acknowledged without reprocessing.
+func WithDedup(retention time.Duration) Option {
+	return func(h *Handler) {
+		h.dedupRetention = retention
+	}
+}
+
+// WithTTLAnnotations makes pushes read the TTL from the first of keys found in
+// the manifest annotations or image config labels, in preference to the tag.
+func WithTTLAnnotations(keys []string) Option {
+	return func(h *Handler) {
+		h.ttlAnnotationKeys = keys
+	}
+}
+
+// WithPolicy applies per-repository TTL and immutability rules from src.
+func WithPolicy(src *policy.Source) Option {
+	return func(h *Handler) {
+		h.policy = src
+	}
+}
+
+// WithNotifier sends tracked and overwritten events to n.
+func WithNotifier(n *notify.Dispatcher) Option {
+	return func(h *Handler) {
+		h.notifier = n
+	}
+}
+
+// WithHistory records pushes, overwrites and deletes in the image history.
+func WithHistory(r *audit.Recorder) Option {
+	return func(h *Handler) {
+		h.history = r
+	}
+}
+
+// WithImmutabilityMode sets how overwrites of immutable tags are enforced:
+// ImmutabilityReject (the default) or ImmutabilityRollback.
+func WithImmutabilityMode(mode string) Option {
+	return func(h *Handler) {
+		h.immutabilityMode = mode
+	}
 }
 
 // NewHandler creates a new webhook handler.
@@ -54,18 +234,23 @@ func NewHandler(
 	registry registryClient,
 	hookToken string,
 	defaultTTL, maxTTL time.Duration,
-	immutableTagPatterns []string,
+	immutable *immutability.Rules,
 	logger *slog.Logger,
+	opts ...Option,
 ) *Handler {
-	return &Handler{
-		redis:                redis,
-		registry:             registry,
-		hookToken:            hookToken,
-		defaultTTL:           defaultTTL,
-		maxTTL:               maxTTL,
-		immutableTagPatterns: immutableTagPatterns,
-		logger:               logger,
+	h := &Handler{
+		redis:      redis,
+		registry:   registry,
+		hookToken:  hookToken,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+		immutable:  immutable,
+		logger:     logger,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // ServeHTTP handles POST /v1/hook/registry-event.
@@ -91,42 +276,174 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+
+	if h.queue != nil {
+		h.enqueue(ctx, w, envelope.Events)
+		return
+	}
+
+	// Process every event even if an earlier one failed: successful events
+	// are recorded as processed, so a retried envelope only redoes failures.
+	response := EventResponse{Results: make([]EventResult, 0, len(envelope.Events))}
+	failed := false
 	for _, event := range envelope.Events {
 		metrics.WebhookEventsTotal.WithLabelValues(event.Action).Inc()
 
-		if event.Action != "push" {
-			continue
-		}
-		if event.Target.Repository == "" || event.Target.Tag == "" {
-			continue
-		}
-		if err := h.handlePush(ctx, event.Target.Repository, event.Target.Tag); err != nil {
-			h.logger.Error("failed to handle push event",
+		result := EventResult{ID: event.ID, Action: event.Action}
+		status, err := h.processEvent(ctx, event)
+		result.Status = status
+		if err != nil {
+			h.logger.Error("failed to handle registry event",
+				"id", event.ID,
+				"action", event.Action,
 				"image", event.Target.Repository,
 				"tag", event.Target.Tag,
+				"digest", event.Target.Digest,
 				"error", err,
 			)
+			result.Error = err.Error()
+			failed = true
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if failed {
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// enqueue appends the events the handler acts on to the event stream and
+// answers 202 without waiting for them to be processed.
+func (h *Handler) enqueue(ctx context.Context, w http.ResponseWriter, events []RegistryEvent) {
+	response := EventResponse{Results: make([]EventResult, 0, len(events))}
+	var payloads [][]byte
+	for _, event := range events {
+		metrics.WebhookEventsTotal.WithLabelValues(event.Action).Inc()
+
+		result := EventResult{ID: event.ID, Action: event.Action, Status: StatusIgnored}
+		if h.wants(event) {
+			payload, err := json.Marshal(event)
+			if err != nil {
+				h.logger.Error("failed to encode registry event", "id", event.ID, "error", err)
+				result.Status = StatusFailed
+				result.Error = err.Error()
+			} else {
+				payloads = append(payloads, payload)
+				result.Status = StatusQueued
+			}
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if len(payloads) > 0 {
+		if err := h.queue.EnqueueEvents(ctx, payloads); err != nil {
+			h.logger.Error("failed to enqueue registry events", "events", len(payloads), "error", err)
 			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
 			return
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("{}"))
+	writeJSON(w, http.StatusAccepted, response)
 }
 
-func (h *Handler) handlePush(ctx context.Context, repo, tag string) error {
-	imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
 
-	ttl := ClampTTL(ParseTTL(tag), h.defaultTTL, h.maxTTL)
-	expiresAt := time.Now().Add(ttl)
+// wants reports whether the handler acts on an event at all.
+func (h *Handler) wants(event RegistryEvent) bool {
+	if event.Target.Repository == "" {
+		return false
+	}
+	switch event.Action {
+	case "push":
+		return event.Target.Tag != ""
+	case "delete":
+		return event.Target.Tag != "" || event.Target.Digest != ""
+	case "pull":
+		return h.slidingIdle > 0 && event.Target.Tag != ""
+	default:
+		return false
+	}
+}
+
+// processEvent applies a single registry event and returns its outcome.
+// Events the handler does not act on are ignored, and events whose ID was
+// already processed are acknowledged without being applied again.
+func (h *Handler) processEvent(ctx context.Context, event RegistryEvent) (string, error) {
+	if !h.wants(event) {
+		return StatusIgnored, nil
+	}
+
+	dedup := event.ID != "" && h.dedupRetention > 0
+	if dedup {
+		seen, err := h.redis.IsEventProcessed(ctx, event.ID)
+		if err != nil {
+			return StatusFailed, fmt.Errorf("checking event %s: %w", event.ID, err)
+		}
+		if seen {
+			metrics.DuplicateEvents.Inc()
+			h.logger.Debug("skipping already processed event", "id", event.ID, "action", event.Action)
+			return StatusDuplicate, nil
+		}
+	}
+
+	if err := h.applyEvent(ctx, event); err != nil {
+		return StatusFailed, err
+	}
+
+	if dedup {
+		if err := h.redis.MarkEventProcessed(ctx, event.ID, h.dedupRetention); err != nil {
+			h.logger.Warn("failed to record processed event", "id", event.ID, "error", err)
+		}
+	}
+	return StatusProcessed, nil
+}
+
+// applyEvent dispatches an event to its action handler.
+func (h *Handler) applyEvent(ctx context.Context, event RegistryEvent) error {
+	target := event.Target
+	switch event.Action {
+	case "push":
+		return h.handlePush(ctx, event)
+	case "delete":
+		return h.handleDelete(ctx, event)
+	case "pull":
+		return h.handlePull(ctx, target.Repository, target.Tag)
+	default:
+		return nil
+	}
+}
+
+// historyEntry starts the history entry for a transition caused by event.
+func historyEntry(event RegistryEvent, action audit.Action, imageWithTag string) audit.Entry {
+	return audit.Entry{
+		Action: action,
+		Image:  imageWithTag,
+		Actor:  event.Actor.Name,
+		Addr:   event.Request.Addr,
+	}
+}
+
+func (h *Handler) handlePush(ctx context.Context, event RegistryEvent) error {
+	target := event.Target
+	repo, tag := target.Repository, target.Tag
+	imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
 
-	// Fetch manifest info (digest + size) - best effort
-	var manifestInfo *registry.ManifestInfo
+	// Take digest + size from the event, falling back to fetching the
+	// manifest - best effort
 	var sizeBytes int64
 	var digest string
 
-	manifestInfo, err := h.registry.GetImageManifestInfo(ctx, repo, tag)
+	manifestInfo, ok := target.manifestInfo()
+	var err error
+	if !ok {
+		manifestInfo, err = h.registry.GetImageManifestInfo(ctx, repo, tag)
+	}
 	if err != nil {
 		h.logger.Warn("failed to fetch manifest info, tracking without digest",
 			"image", imageWithTag,
@@ -141,13 +458,39 @@ func (h *Handler) handlePush(ctx context.Context, repo, tag string) error {
 	}
 
 	// Detect tag overwrite (may block webhook in enforcement mode)
+	var existingDigest string
 	if digest != "" {
-		if err := h.detectOverwrite(ctx, imageWithTag, repo, tag, digest); err != nil {
+		existingDigest, err = h.detectOverwrite(ctx, imageWithTag, repo, tag, digest)
+		if err != nil {
 			// Error means overwrite blocked (enforcement mode)
-			return err
+			return h.enforceImmutable(ctx, event, digest, existingDigest, err)
 		}
+		if existingDigest == digest && h.claimRollback(ctx, imageWithTag, digest) {
+			// Our own rollback restored the tracked digest; tracking it again
+			// would refresh the expiry of the original push.
+			h.logger.Debug("ignoring push from immutable tag rollback", "image", imageWithTag, "digest", digest)
+			return nil
+		}
+	}
+
+	eff := h.effective(repo, tag)
+	if eff.NeverReap {
+		h.logger.Info("image exempt by policy, not tracking", "image", imageWithTag, "rule", eff.Rule)
+		entry := historyEntry(event, audit.ActionUntracked, imageWithTag)
+		entry.Digest, entry.Reason = digest, "exempt"
+		return h.untrack(ctx, imageWithTag, entry)
 	}
 
+	ttl, keep := ResolveTTL(tag, h.annotations(ctx, repo, tag, digest), h.ttlAnnotationKeys, eff.DefaultTTL, eff.MaxTTL)
+	if keep {
+		h.logger.Info("image kept by annotation, not tracking", "image", imageWithTag, "digest", digest)
+		entry := historyEntry(event, audit.ActionUntracked, imageWithTag)
+		entry.Digest, entry.Reason = digest, "kept"
+		return h.untrack(ctx, imageWithTag, entry)
+	}
+	ttl = eff.Bound(ttl)
+	expiresAt := time.Now().Add(ttl)
+
 	sizeMB := float64(sizeBytes) / (1024 * 1024)
 
 	h.logger.Info("tracking image",
@@ -157,6 +500,7 @@ func (h *Handler) handlePush(ctx context.Context, repo, tag string) error {
 		"size_bytes", sizeBytes,
 		"size_mb", fmt.Sprintf("%.2f", sizeMB),
 		"digest", digest,
+		"rule", eff.Rule,
 	)
 
 	if err := h.redis.TrackImage(ctx, imageWithTag, expiresAt, sizeBytes, digest); err != nil {
@@ -167,29 +511,286 @@ func (h *Handler) handlePush(ctx context.Context, repo, tag string) error {
 	metrics.TrackedBytesTotal.Add(float64(sizeBytes))
 	metrics.ImageSizeBytes.Observe(float64(sizeBytes))
 
+	h.notifier.Emit(notify.Event{
+		Type:      notify.EventTracked,
+		Image:     imageWithTag,
+		Digest:    digest,
+		SizeBytes: sizeBytes,
+		TTL:       ttl.String(),
+		ExpiresAt: expiresAt,
+	})
+
+	entry := historyEntry(event, audit.ActionTracked, imageWithTag)
+	switch {
+	case existingDigest == digest && digest != "":
+		entry.Action = audit.ActionRepushed
+	case existingDigest != "":
+		entry.Action, entry.PreviousDigest = audit.ActionOverwritten, existingDigest
+	}
+	entry.Digest, entry.SizeBytes, entry.ExpiresAt = digest, sizeBytes, expiresAt
+	h.history.Record(ctx, entry)
+	return nil
+}
+
+// enforceImmutable handles a push that overwrote an immutable tag. In reject
+// mode it returns blocked, an ErrImmutableTag. In rollback mode it restores
+// the tag to the tracked digest and acknowledges the event, leaving the
+// record untouched; failed rollbacks are returned so the event is retried,
+// unless the old manifest is gone from the registry.
+func (h *Handler) enforceImmutable(ctx context.Context, event RegistryEvent, digest, existingDigest string, blocked error) error {
+	repo, tag := event.Target.Repository, event.Target.Tag
+	imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
+
+	reason, err := "rejected", blocked
+	if h.immutabilityMode == ImmutabilityRollback {
+		reason, err = h.rollback(ctx, repo, tag, digest, existingDigest, blocked)
+	}
+
+	h.notifier.Emit(notify.Event{
+		Type:           notify.EventOverwritten,
+		Image:          imageWithTag,
+		Digest:         digest,
+		PreviousDigest: existingDigest,
+		Reason:         reason,
+	})
+	entry := historyEntry(event, audit.ActionOverwritten, imageWithTag)
+	entry.Digest, entry.PreviousDigest, entry.Reason = digest, existingDigest, reason
+	if reason == "rollback_failed" {
+		entry.Error = err.Error()
+	}
+	h.history.Record(ctx, entry)
+	return err
+}
+
+// rollback PUTs the manifest of existingDigest back under tag and returns
+// the violation reason together with the error to report for the event.
+func (h *Handler) rollback(ctx context.Context, repo, tag, digest, existingDigest string, blocked error) (string, error) {
+	imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
+	// Mark the restore first, so its push event is recognised however soon
+	// the registry sends it.
+	if err := h.redis.MarkRollback(ctx, imageWithTag, existingDigest, rollbackMarkerTTL); err != nil {
+		metrics.ImmutableTagRollbacks.WithLabelValues("failed").Inc()
+		return "rollback_failed", fmt.Errorf("marking rollback of %s: %w", imageWithTag, err)
+	}
+	err := h.registry.RestoreTag(ctx, repo, tag, existingDigest)
+	if err != nil {
+		metrics.ImmutableTagRollbacks.WithLabelValues("failed").Inc()
+		h.logger.Error("failed to roll back immutable tag overwrite",
+			"image", imageWithTag,
+			"digest", digest,
+			"restore_digest", existingDigest,
+			"error", err,
+		)
+		if errors.Is(err, registry.ErrManifestNotFound) {
+			// Retrying cannot bring the old manifest back.
+			return "rollback_failed", fmt.Errorf("%w: %w", blocked, err)
+		}
+		return "rollback_failed", fmt.Errorf("rolling back %s to %s: %w", imageWithTag, existingDigest, err)
+	}
+
+	metrics.ImmutableTagRollbacks.WithLabelValues("restored").Inc()
+	h.logger.Warn("rolled back immutable tag overwrite",
+		"image", imageWithTag,
+		"rejected_digest", digest,
+		"digest", existingDigest,
+	)
+	return "rolled_back", nil
+}
+
+// claimRollback consumes the marker left by rollback for imageWithTag at
+// digest. A push is only ignored when the marker was there; on errors it is
+// processed like any other push.
+func (h *Handler) claimRollback(ctx context.Context, imageWithTag, digest string) bool {
+	ok, err := h.redis.ClaimRollback(ctx, imageWithTag, digest)
+	if err != nil {
+		h.logger.Warn("failed to check rollback marker", "image", imageWithTag, "error", err)
+		return false
+	}
+	return ok
+}
+
+// annotations fetches the annotations and labels of a pushed image when TTL
+// annotation keys are configured. Failures are logged and fall back to the
+// tag TTL.
+func (h *Handler) annotations(ctx context.Context, repo, tag, digest string) map[string]string {
+	if len(h.ttlAnnotationKeys) == 0 {
+		return nil
+	}
+
+	reference := tag
+	if digest != "" {
+		reference = digest
+	}
+	annotations, err := h.registry.GetImageAnnotations(ctx, repo, reference)
+	if err != nil {
+		h.logger.Warn("failed to fetch annotations, using tag TTL",
+			"image", fmt.Sprintf("%s:%s", repo, tag),
+			"error", err,
+		)
+		return nil
+	}
+	return annotations
+}
+
+// untrack stops tracking an image that is exempt from expiry, e.g. when a
+// tag is re-pushed with a keep annotation, and records entry if it was
+// tracked.
+func (h *Handler) untrack(ctx context.Context, imageWithTag string, entry audit.Entry) error {
+	tracked, err := h.redis.IsTracked(ctx, imageWithTag)
+	if err != nil || !tracked {
+		return err
+	}
+
+	sizeBytes, err := h.redis.GetImageSize(ctx, imageWithTag)
+	if err != nil {
+		h.logger.Warn("failed to get image size for metrics", "image", imageWithTag, "error", err)
+		sizeBytes = 0
+	}
+	if err := h.redis.RemoveImage(ctx, imageWithTag); err != nil {
+		return err
+	}
+	metrics.TrackedBytesTotal.Sub(float64(sizeBytes))
+
+	entry.SizeBytes = sizeBytes
+	h.history.Record(ctx, entry)
+	return nil
+}
+
+// handlePull records the pull and, in sliding expiry mode, pushes the expiry
+// of a tracked image out to now+idle. The new expiry never exceeds MAX_TTL
+// measured from the created timestamp, and is never moved earlier.
+func (h *Handler) handlePull(ctx context.Context, repo, tag string) error {
+	imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
+
+	tracked, err := h.redis.IsTracked(ctx, imageWithTag)
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		return nil
+	}
+
+	now := time.Now()
+	if err := h.redis.SetLastPulled(ctx, imageWithTag, now); err != nil {
+		return ignoreNotTracked(err)
+	}
+
+	createdMillis, err := h.redis.GetCreatedTimestamp(ctx, imageWithTag)
+	if err != nil {
+		return err
+	}
+	created := now
+	if createdMillis > 0 {
+		created = time.UnixMilli(createdMillis)
+	}
+
+	newExpiry := now.Add(h.slidingIdle)
+	if ceiling := created.Add(h.effective(repo, tag).MaxTTL); newExpiry.After(ceiling) {
+		newExpiry = ceiling
+	}
+
+	currentMillis, err := h.redis.GetExpiry(ctx, imageWithTag)
+	if err != nil {
+		return ignoreNotTracked(err)
+	}
+	if newExpiry.UnixMilli() <= currentMillis {
+		return nil
+	}
+
+	if err := h.redis.SetExpiry(ctx, imageWithTag, newExpiry); err != nil {
+		return ignoreNotTracked(err)
+	}
+
+	metrics.ExpiryExtensions.Inc()
+	h.logger.Info("extended expiry on pull",
+		"image", imageWithTag,
+		"previous_expires_at", time.UnixMilli(currentMillis).Format(time.RFC3339),
+		"expires_at", newExpiry.Format(time.RFC3339),
+	)
+	return nil
+}
+
+// ignoreNotTracked treats an image that stopped being tracked concurrently
+// (e.g. reaped between two calls) as a no-op.
+func ignoreNotTracked(err error) error {
+	if errors.Is(err, redisclient.ErrNotTracked) {
+		return nil
+	}
+	return err
+}
+
+// handleDelete removes tracking records for images deleted from the registry
+// outside of the reaper. A tag delete removes that tag; a manifest delete
+// removes every tracked tag whose stored digest matches.
+func (h *Handler) handleDelete(ctx context.Context, event RegistryEvent) error {
+	repo, tag, digest := event.Target.Repository, event.Target.Tag, event.Target.Digest
+	var images []string
+	if tag != "" {
+		imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
+		tracked, err := h.redis.IsTracked(ctx, imageWithTag)
+		if err != nil {
+			return err
+		}
+		if tracked {
+			images = append(images, imageWithTag)
+		}
+	} else {
+		tags, err := h.redis.ListDigestTags(ctx, repo, digest)
+		if err != nil {
+			return err
+		}
+		images = tags
+	}
+
+	for _, imageWithTag := range images {
+		sizeBytes, err := h.redis.GetImageSize(ctx, imageWithTag)
+		if err != nil {
+			h.logger.Warn("failed to get image size for metrics", "image", imageWithTag, "error", err)
+			sizeBytes = 0
+		}
+
+		if err := h.redis.RemoveImage(ctx, imageWithTag); err != nil {
+			return err
+		}
+
+		metrics.ImagesDeleted.Inc()
+		metrics.TrackedBytesTotal.Sub(float64(sizeBytes))
+
+		h.logger.Info("image deleted from registry, stopped tracking",
+			"image", imageWithTag,
+			"digest", digest,
+			"size_bytes", sizeBytes,
+		)
+
+		entry := historyEntry(event, audit.ActionUntracked, imageWithTag)
+		entry.Digest, entry.SizeBytes, entry.Reason = digest, sizeBytes, "registry_delete"
+		h.history.Record(ctx, entry)
+	}
+
 	return nil
 }
 
 // detectOverwrite checks if tag push overwrites existing content with different digest.
-// Returns error if overwrite should be blocked (enforcement mode), nil otherwise.
-func (h *Handler) detectOverwrite(ctx context.Context, imageWithTag, repo, tag, newDigest string) error {
+// It returns the digest tracked before the push, if any, and ErrImmutableTag if
+// the overwrite should be blocked (enforcement mode).
+func (h *Handler) detectOverwrite(ctx context.Context, imageWithTag, repo, tag, newDigest string) (string, error) {
 	existingDigest, err := h.redis.GetImageDigest(ctx, imageWithTag)
 	if err != nil {
 		h.logger.Warn("failed to check existing digest (non-critical)",
 			"image", imageWithTag,
 			"error", err,
 		)
-		return nil // Best effort: continue on error
+		return "", nil // Best effort: continue on error
 	}
 
 	// No existing digest = first push or old record (backward compatible)
 	if existingDigest == "" {
-		return nil
+		return "", nil
 	}
 
 	// Same digest = re-push of same content (no-op)
 	if existingDigest == newDigest {
-		return nil
+		return existingDigest, nil
 	}
 
 	// Different digest = overwrite detected!
@@ -207,35 +808,46 @@ func (h *Handler) detectOverwrite(ctx context.Context, imageWithTag, repo, tag,
 		metrics.OverwrittenImageAge.Observe(ageSeconds)
 	}
 
-	// Check if tag matches immutable patterns (enforcement mode)
-	if h.isImmutableTag(tag) {
-		h.logger.Error("immutable tag overwrite rejected",
+	event := notify.Event{
+		Type:           notify.EventOverwritten,
+		Image:          imageWithTag,
+		Digest:         newDigest,
+		PreviousDigest: existingDigest,
+	}
+
+	// Check if tag is immutable by policy or pattern (enforcement mode).
+	// The caller rejects or rolls back the push and emits the event.
+	if rule, immutable := h.isImmutable(repo, tag); immutable {
+		h.logger.Error("immutable tag overwrite detected",
 			"image", imageWithTag,
 			"tag", tag,
+			"rule", rule,
 			"old_digest", existingDigest,
 			"new_digest", newDigest,
 		)
-		metrics.ImmutableTagViolations.WithLabelValues(repo, tag).Inc()
-		return fmt.Errorf("tag %s is immutable, overwrite rejected", tag)
+		metrics.ImmutableTagViolations.WithLabelValues(repo, rule).Inc()
+		return existingDigest, fmt.Errorf("tag %s: %w", tag, ErrImmutableTag)
 	}
 
-	return nil // Observability mode: log but allow
+	h.notifier.Emit(event)
+	return existingDigest, nil // Observability mode: log but allow
 }
 
-// isImmutableTag checks if tag matches any immutable patterns.
-func (h *Handler) isImmutableTag(tag string) bool {
-	for _, pattern := range h.immutableTagPatterns {
-		matched, err := filepath.Match(pattern, tag)
-		if err != nil {
-			h.logger.Warn("invalid immutable tag pattern",
-				"pattern", pattern,
-				"error", err,
-			)
-			continue
-		}
-		if matched {
-			return true
-		}
+// effective returns the policy settings for repo:tag, falling back to the
+// handler's global TTLs.
+func (h *Handler) effective(repo, tag string) policy.Effective {
+	return h.policy.Policy().Resolve(repo, tag, policy.Defaults{DefaultTTL: h.defaultTTL, MaxTTL: h.maxTTL})
+}
+
+// isImmutable reports whether tag is immutable and the name of the rule that
+// decided it. A policy rule that sets immutable is checked first, then the
+// immutability rules and tag patterns.
+func (h *Handler) isImmutable(repo, tag string) (string, bool) {
+	if eff := h.effective(repo, tag); eff.Immutable != nil {
+		return eff.Rule, *eff.Immutable
+	}
+	if rule := h.immutable.Match(repo, tag); rule != nil {
+		return rule.Name, rule.Immutable
 	}
-	return false
+	return "", false
 }
@@ -4,12 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/immutability"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
 	"github.com/tamcore/ephemeron/internal/registry"
 )
 
@@ -106,18 +116,24 @@ func TestHandler_EventParsing(t *testing.T) {
 
 // mockStore is a minimal mock for testing size tracking
 type mockStore struct {
-	images  map[string]time.Time
-	sizes   map[string]int64
-	digests map[string]string
-	created map[string]int64
+	images     map[string]time.Time
+	sizes      map[string]int64
+	digests    map[string]string
+	created    map[string]int64
+	lastPulled map[string]time.Time
+	processed  map[string]bool
+	rollbacks  map[string]bool
 }
 
 func newMockStore() *mockStore {
 	return &mockStore{
-		images:  make(map[string]time.Time),
-		sizes:   make(map[string]int64),
-		digests: make(map[string]string),
-		created: make(map[string]int64),
+		images:     make(map[string]time.Time),
+		sizes:      make(map[string]int64),
+		digests:    make(map[string]string),
+		created:    make(map[string]int64),
+		lastPulled: make(map[string]time.Time),
+		processed:  make(map[string]bool),
+		rollbacks:  make(map[string]bool),
 	}
 }
 
@@ -143,23 +159,154 @@ func (m *mockStore) GetCreatedTimestamp(_ context.Context, imageWithTag string)
 	return m.created[imageWithTag], nil
 }
 
-func (m *mockStore) Ping(context.Context) error                                     { return nil }
-func (m *mockStore) Close() error                                                   { return nil }
-func (m *mockStore) ListImages(context.Context) ([]string, error)                   { return nil, nil }
-func (m *mockStore) GetExpiry(context.Context, string) (int64, error)               { return 0, nil }
-func (m *mockStore) GetImageSize(context.Context, string) (int64, error)            { return 0, nil }
-func (m *mockStore) RemoveImage(context.Context, string) error                      { return nil }
-func (m *mockStore) AcquireReaperLock(context.Context, time.Duration) (bool, error) { return true, nil }
-func (m *mockStore) ReleaseReaperLock(context.Context) error                        { return nil }
-func (m *mockStore) IsInitialized(context.Context) (bool, error)                    { return false, nil }
-func (m *mockStore) SetInitialized(context.Context) error                           { return nil }
-func (m *mockStore) ImageCount(context.Context) (int64, error)                      { return 0, nil }
+func (m *mockStore) Ping(context.Context) error                   { return nil }
+func (m *mockStore) Close() error                                 { return nil }
+func (m *mockStore) ListImages(context.Context) ([]string, error) { return nil, nil }
+func (m *mockStore) AcquireReaperLock(context.Context, string, time.Duration) (int64, error) {
+	return 1, nil
+}
+func (m *mockStore) RenewReaperLock(context.Context, string, time.Duration) (bool, error) {
+	return true, nil
+}
+func (m *mockStore) ReleaseReaperLock(context.Context, string) (bool, error) { return true, nil }
+func (m *mockStore) ReaperLockFence(context.Context) (int64, error)          { return 1, nil }
+func (m *mockStore) RecordReapFailure(context.Context, string, string, time.Time, redisclient.RetryPolicy) (redisclient.ReapFailure, error) {
+	return redisclient.ReapFailure{}, nil
+}
+func (m *mockStore) IsReapDeferred(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+func (m *mockStore) ListReapDeadLetters(context.Context) ([]string, error) { return nil, nil }
+func (m *mockStore) ReapDeadLetterCount(context.Context) (int64, error)    { return 0, nil }
+func (m *mockStore) RetryReapDeadLetter(context.Context, string) error     { return nil }
+func (m *mockStore) IsEventProcessed(_ context.Context, id string) (bool, error) {
+	return m.processed[id], nil
+}
+
+func (m *mockStore) MarkEventProcessed(_ context.Context, id string, _ time.Duration) error {
+	m.processed[id] = true
+	return nil
+}
+
+func (m *mockStore) MarkRollback(_ context.Context, imageWithTag, digest string, _ time.Duration) error {
+	m.rollbacks[imageWithTag+"@"+digest] = true
+	return nil
+}
+
+func (m *mockStore) ClaimRollback(_ context.Context, imageWithTag, digest string) (bool, error) {
+	ok := m.rollbacks[imageWithTag+"@"+digest]
+	delete(m.rollbacks, imageWithTag+"@"+digest)
+	return ok, nil
+}
+
+func (m *mockStore) IsInitialized(context.Context) (bool, error) { return false, nil }
+func (m *mockStore) SetInitialized(context.Context) error        { return nil }
+func (m *mockStore) ImageCount(context.Context) (int64, error)   { return 0, nil }
+
+func (m *mockStore) ListImagesByExpiry(context.Context, int64, int64) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ListImagesByCreated(context.Context, int64, int64) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ListRepositories(context.Context) ([]string, error) { return nil, nil }
+func (m *mockStore) ListRepoImagesByCreated(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ReapStates(context.Context, []string) ([]redisclient.Image, error) {
+	return nil, nil
+}
+func (m *mockStore) TrackedBytes(context.Context) (int64, error)         { return 0, nil }
+func (m *mockStore) RepoBytes(context.Context) (map[string]int64, error) { return nil, nil }
+
+func (m *mockStore) ListExpiredImages(context.Context, time.Time, int64, int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockStore) ListImagesByExpiryAfter(
+	context.Context, redisclient.ExpiryCursor, int64,
+) ([]redisclient.ExpiryCursor, error) {
+	return nil, nil
+}
+
+func (m *mockStore) ListImagesExpiringBetween(context.Context, time.Time, time.Time, int64, int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockStore) RemoveDigestTag(context.Context, string, string, string) error { return nil }
+
+func (m *mockStore) ListDigestTags(_ context.Context, repo, digest string) ([]string, error) {
+	var out []string
+	for image, d := range m.digests {
+		if d == digest && strings.HasPrefix(image, repo+":") {
+			out = append(out, image)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) IsTracked(_ context.Context, imageWithTag string) (bool, error) {
+	_, ok := m.images[imageWithTag]
+	return ok, nil
+}
+
+func (m *mockStore) GetExpiry(_ context.Context, imageWithTag string) (int64, error) {
+	return m.images[imageWithTag].UnixMilli(), nil
+}
+
+func (m *mockStore) SetExpiry(_ context.Context, imageWithTag string, expiresAt time.Time) error {
+	if _, ok := m.images[imageWithTag]; !ok {
+		return redisclient.ErrNotTracked
+	}
+	m.images[imageWithTag] = expiresAt
+	return nil
+}
+
+func (m *mockStore) SetLastPulled(_ context.Context, imageWithTag string, pulledAt time.Time) error {
+	if _, ok := m.images[imageWithTag]; !ok {
+		return redisclient.ErrNotTracked
+	}
+	m.lastPulled[imageWithTag] = pulledAt
+	return nil
+}
+
+func (m *mockStore) GetImageSize(_ context.Context, imageWithTag string) (int64, error) {
+	return m.sizes[imageWithTag], nil
+}
+
+func (m *mockStore) RemoveImage(_ context.Context, imageWithTag string) error {
+	delete(m.images, imageWithTag)
+	delete(m.sizes, imageWithTag)
+	delete(m.digests, imageWithTag)
+	delete(m.created, imageWithTag)
+	return nil
+}
+
+func (m *mockStore) GetImage(context.Context, string) (redisclient.Image, error) {
+	return redisclient.Image{}, redisclient.ErrNotTracked
+}
+func (m *mockStore) PinImage(context.Context, string, time.Time) error { return nil }
+func (m *mockStore) UnpinImage(context.Context, string) error          { return nil }
+func (m *mockStore) IsPinned(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+func (m *mockStore) ClaimExpiryWarning(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) TagDigests(context.Context, string) ([]redisclient.TagDigest, error) {
+	return nil, nil
+}
 
 // mockRegistry is a minimal mock for testing size fetching
 type mockRegistry struct {
-	sizes   map[string]int64
-	digests map[string]string
-	err     error
+	sizes       map[string]int64
+	digests     map[string]string
+	annotations map[string]map[string]string // reference -> annotations
+	err         error
+	calls       int
+	restoreErr  error
+	restored    []string // repo:tag@digest
 }
 
 func (m *mockRegistry) GetImageSize(_ context.Context, repo, tag string) (int64, error) {
@@ -171,6 +318,7 @@ func (m *mockRegistry) GetImageSize(_ context.Context, repo, tag string) (int64,
 }
 
 func (m *mockRegistry) GetImageManifestInfo(_ context.Context, repo, tag string) (*registry.ManifestInfo, error) {
+	m.calls++
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -181,6 +329,22 @@ func (m *mockRegistry) GetImageManifestInfo(_ context.Context, repo, tag string)
 	}, nil
 }
 
+func (m *mockRegistry) GetImageAnnotations(_ context.Context, repo, reference string) (map[string]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.annotations[reference], nil
+}
+
+func (m *mockRegistry) RestoreTag(_ context.Context, repo, tag, digest string) error {
+	if m.restoreErr != nil {
+		return m.restoreErr
+	}
+	m.restored = append(m.restored, repo+":"+tag+"@"+digest)
+	m.digests[repo+":"+tag] = digest
+	return nil
+}
+
 func TestHandler_SizeTracking_Success(t *testing.T) {
 	store := newMockStore()
 	registry := &mockRegistry{
@@ -250,6 +414,74 @@ func TestHandler_SizeTracking_FetchError(t *testing.T) {
 	}
 }
 
+func TestHandler_SizeTracking_FromEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     EventTarget
+		wantCalls  int
+		wantSize   int64
+		wantDigest string
+	}{
+		{
+			name: "references summed",
+			target: EventTarget{
+				Repository: "myapp", Tag: "1h", Digest: "sha256:event",
+				MediaType: registry.MediaTypeOCIManifest, Size: 500,
+				References: []EventDescriptor{
+					{Digest: "sha256:config", Size: 100},
+					{Digest: "sha256:layer1", Size: 1000},
+					{Digest: "sha256:layer2", Size: 2000},
+				},
+			},
+			wantCalls:  0,
+			wantSize:   3100,
+			wantDigest: "sha256:event",
+		},
+		{
+			name:       "no references falls back to registry",
+			target:     EventTarget{Repository: "myapp", Tag: "1h", Digest: "sha256:event"},
+			wantCalls:  1,
+			wantSize:   9999,
+			wantDigest: "sha256:registry",
+		},
+		{
+			name: "index falls back to registry",
+			target: EventTarget{
+				Repository: "myapp", Tag: "1h", Digest: "sha256:event",
+				MediaType:  registry.MediaTypeOCIIndex,
+				References: []EventDescriptor{{Digest: "sha256:amd64", Size: 400}},
+			},
+			wantCalls:  1,
+			wantSize:   9999,
+			wantDigest: "sha256:registry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			reg := &mockRegistry{
+				sizes:   map[string]int64{"myapp:1h": 9999},
+				digests: map[string]string{"myapp:1h": "sha256:registry"},
+			}
+			handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+
+			if code, _ := postEvents(t, handler, RegistryEvent{Action: "push", Target: tt.target}); code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", code)
+			}
+			if reg.calls != tt.wantCalls {
+				t.Errorf("expected %d registry calls, got %d", tt.wantCalls, reg.calls)
+			}
+			if store.sizes["myapp:1h"] != tt.wantSize {
+				t.Errorf("expected size %d, got %d", tt.wantSize, store.sizes["myapp:1h"])
+			}
+			if store.digests["myapp:1h"] != tt.wantDigest {
+				t.Errorf("expected digest %s, got %s", tt.wantDigest, store.digests["myapp:1h"])
+			}
+		})
+	}
+}
+
 func TestDetectOverwrite_FirstPush(t *testing.T) {
 	store := newMockStore()
 	registry := &mockRegistry{
@@ -355,7 +587,7 @@ func TestDetectOverwrite_DifferentDigest_Enforcement(t *testing.T) {
 	store.created["myapp:prod-1h"] = time.Now().Add(-5 * time.Minute).UnixMilli()
 
 	// Set immutable pattern that matches "prod-*"
-	handler := NewHandler(store, registry, "tok", time.Hour, 24*time.Hour, []string{"prod-*"}, slog.Default())
+	handler := NewHandler(store, registry, "tok", time.Hour, 24*time.Hour, tagPatterns(t, "prod-*"), slog.Default())
 
 	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
 		{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "prod-1h"}},
@@ -378,10 +610,137 @@ func TestDetectOverwrite_DifferentDigest_Enforcement(t *testing.T) {
 	}
 }
 
-func TestIsImmutableTag_Matches(t *testing.T) {
+func TestDetectOverwrite_DifferentDigest_Rollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		restoreErr error
+		wantCode   int
+		wantReason string
+		restored   bool
+	}{
+		{name: "restored", wantCode: http.StatusOK, wantReason: "rolled_back", restored: true},
+		{name: "registry error is retried", restoreErr: errors.New("connection refused"), wantCode: http.StatusServiceUnavailable, wantReason: "rollback_failed"},
+		{name: "old manifest gone", restoreErr: registry.ErrManifestNotFound, wantCode: http.StatusServiceUnavailable, wantReason: "rollback_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			reg := &mockRegistry{
+				sizes:      map[string]int64{"myapp:prod-1h": 100000},
+				digests:    map[string]string{"myapp:prod-1h": "sha256:new789"},
+				restoreErr: tt.restoreErr,
+			}
+			store.digests["myapp:prod-1h"] = "sha256:old456"
+			store.created["myapp:prod-1h"] = time.Now().Add(-5 * time.Minute).UnixMilli()
+			expiry := time.Now().Add(30 * time.Minute)
+			store.images["myapp:prod-1h"] = expiry
+
+			history := audit.New(&historyStore{}, time.Hour, slog.Default())
+			handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, tagPatterns(t, "prod-*"), slog.Default(),
+				WithImmutabilityMode(ImmutabilityRollback),
+				WithHistory(history),
+			)
+
+			code, resp := postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "prod-1h"}})
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %+v", code, tt.wantCode, resp)
+			}
+			if got := len(reg.restored) == 1 && reg.restored[0] == "myapp:prod-1h@sha256:old456"; got != tt.restored {
+				t.Errorf("restored = %v, want rollback %v", reg.restored, tt.restored)
+			}
+			if store.digests["myapp:prod-1h"] != "sha256:old456" || !store.images["myapp:prod-1h"].Equal(expiry) {
+				t.Errorf("record changed: digest %s, expiry %s", store.digests["myapp:prod-1h"], store.images["myapp:prod-1h"])
+			}
+
+			entries, _ := history.History(t.Context(), "myapp:prod-1h", 10)
+			if len(entries) != 1 || entries[0].Action != audit.ActionOverwritten || entries[0].Reason != tt.wantReason ||
+				entries[0].Digest != "sha256:new789" || entries[0].PreviousDigest != "sha256:old456" {
+				t.Errorf("unexpected history: %+v", entries)
+			}
+
+			err := handler.handlePush(t.Context(), RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "prod-1h"}})
+			if notFound := errors.Is(tt.restoreErr, registry.ErrManifestNotFound); tt.restoreErr != nil && errors.Is(err, ErrImmutableTag) != notFound {
+				t.Errorf("errors.Is(err, ErrImmutableTag) = %v, want %v (%v)", !notFound, notFound, err)
+			}
+		})
+	}
+}
+
+func TestHandler_IgnoresRollbackPush(t *testing.T) {
+	store := newMockStore()
+	reg := &mockRegistry{digests: map[string]string{"myapp:prod-1h": "sha256:new789"}}
+	store.digests["myapp:prod-1h"] = "sha256:old456"
+	expiry := time.Now().Add(30 * time.Minute)
+	store.images["myapp:prod-1h"] = expiry
+
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, tagPatterns(t, "prod-*"), slog.Default(),
+		WithImmutabilityMode(ImmutabilityRollback))
+	if code, resp := postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "prod-1h"}}); code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", code, resp)
+	}
+	if !store.rollbacks["myapp:prod-1h@sha256:old456"] {
+		t.Fatalf("expected a rollback marker, got %v", store.rollbacks)
+	}
+
+	// The registry's event for the restore carries the tracked digest.
+	restorePush := RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "prod-1h"}}
+	if code, resp := postEvents(t, handler, restorePush); code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", code, resp)
+	}
+	if !store.images["myapp:prod-1h"].Equal(expiry) {
+		t.Errorf("rollback push was tracked: expiry %s", store.images["myapp:prod-1h"])
+	}
+	if len(store.rollbacks) != 0 {
+		t.Errorf("expected the marker to be consumed, got %v", store.rollbacks)
+	}
+
+	// Without a marker the same push is an ordinary re-push.
+	if code, resp := postEvents(t, handler, restorePush); code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", code, resp)
+	}
+	if store.images["myapp:prod-1h"].Equal(expiry) {
+		t.Error("expected a re-push without a rollback marker to be tracked")
+	}
+}
+
+func TestHandler_RollbackUserAgentNotTrusted(t *testing.T) {
+	store := newMockStore()
+	reg := &mockRegistry{digests: map[string]string{"myapp:prod-1h": "sha256:new789"}}
+	store.digests["myapp:prod-1h"] = "sha256:old456"
+	expiry := time.Now().Add(30 * time.Minute)
+	store.images["myapp:prod-1h"] = expiry
+
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, tagPatterns(t, "prod-*"), slog.Default(),
+		WithImmutabilityMode(ImmutabilityRollback))
+	code, resp := postEvents(t, handler, RegistryEvent{
+		Action:  "push",
+		Target:  EventTarget{Repository: "myapp", Tag: "prod-1h"},
+		Request: EventRequest{UserAgent: "ephemeron-rollback"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %+v", code, resp)
+	}
+	if len(reg.restored) != 1 || reg.restored[0] != "myapp:prod-1h@sha256:old456" {
+		t.Errorf("expected the overwrite to be rolled back, restored %v", reg.restored)
+	}
+	if store.digests["myapp:prod-1h"] != "sha256:old456" || !store.images["myapp:prod-1h"].Equal(expiry) {
+		t.Errorf("record changed: digest %s, expiry %s", store.digests["myapp:prod-1h"], store.images["myapp:prod-1h"])
+	}
+}
+
+func tagPatterns(t *testing.T, patterns ...string) *immutability.Rules {
+	t.Helper()
+	rules, err := immutability.TagPatterns(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return immutability.New(rules)
+}
+
+func TestIsImmutable_Matches(t *testing.T) {
 	handler := NewHandler(
 		nil, nil, "tok", time.Hour, 24*time.Hour,
-		[]string{"prod-*", "release-*", "v[0-9]*"},
+		tagPatterns(t, "prod-*", "release-*", "v[0-9]*"),
 		slog.Default(),
 	)
 
@@ -402,7 +761,7 @@ func TestIsImmutableTag_Matches(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.tag, func(t *testing.T) {
-			result := handler.isImmutableTag(tt.tag)
+			_, result := handler.isImmutable("myapp", tt.tag)
 			if result != tt.expected {
 				t.Errorf("tag %s: expected %v, got %v", tt.tag, tt.expected, result)
 			}
@@ -410,21 +769,528 @@ func TestIsImmutableTag_Matches(t *testing.T) {
 	}
 }
 
-func TestIsImmutableTag_NoPatterns(t *testing.T) {
+func TestIsImmutable_NoPatterns(t *testing.T) {
 	handler := NewHandler(nil, nil, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
 
 	// No patterns = nothing is immutable
-	if handler.isImmutableTag("prod-1h") {
+	if _, immutable := handler.isImmutable("myapp", "prod-1h"); immutable {
 		t.Error("expected false when no patterns configured")
 	}
 }
 
-func TestIsImmutableTag_InvalidPattern(t *testing.T) {
-	// Invalid glob pattern should be skipped
-	handler := NewHandler(nil, nil, "tok", time.Hour, 24*time.Hour, []string{"[invalid"}, slog.Default())
+func TestIsImmutable_Rules(t *testing.T) {
+	rules, err := immutability.ParseRules(`releases release/* /v\d+\.\d+\.\d+/; sandbox sandbox/* * mutable`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := immutability.TagPatterns([]string{"v*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := testPolicy(t, "rules:\n  - name: legacy\n    repository: \"release/legacy\"\n    immutable: false\n")
+	handler := NewHandler(nil, nil, "tok", time.Hour, 24*time.Hour, immutability.New(rules, patterns), slog.Default(),
+		WithPolicy(src))
+
+	tests := []struct {
+		repo, tag string
+		rule      string
+		immutable bool
+	}{
+		{"release/api", "v1.2.3", "releases", true},
+		{"release/legacy", "v1.2.3", "legacy", false},
+		{"sandbox/api", "v1.2.3", "sandbox", false},
+		{"ci/api", "v1", "v*", true},
+		{"ci/api", "1h", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo+":"+tt.tag, func(t *testing.T) {
+			rule, immutable := handler.isImmutable(tt.repo, tt.tag)
+			if rule != tt.rule || immutable != tt.immutable {
+				t.Errorf("got rule %q immutable %v, want %q %v", rule, immutable, tt.rule, tt.immutable)
+			}
+		})
+	}
+}
+
+func TestHandler_DeleteEvent_Tag(t *testing.T) {
+	store := newMockStore()
+	store.images["myapp:1h"] = time.Now().Add(time.Hour)
+	store.digests["myapp:1h"] = "sha256:abc"
+	store.images["myapp:2h"] = time.Now().Add(2 * time.Hour)
+	store.digests["myapp:2h"] = "sha256:abc"
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "delete", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if _, exists := store.images["myapp:1h"]; exists {
+		t.Error("expected deleted tag to be untracked")
+	}
+	if _, exists := store.images["myapp:2h"]; !exists {
+		t.Error("expected other tag with same digest to stay tracked")
+	}
+}
+
+func TestHandler_DeleteEvent_Digest(t *testing.T) {
+	store := newMockStore()
+	store.images["myapp:1h"] = time.Now().Add(time.Hour)
+	store.digests["myapp:1h"] = "sha256:abc"
+	store.images["myapp:2h"] = time.Now().Add(2 * time.Hour)
+	store.digests["myapp:2h"] = "sha256:abc"
+	store.images["myapp:3h"] = time.Now().Add(3 * time.Hour)
+	store.digests["myapp:3h"] = "sha256:other"
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "delete", Target: EventTarget{Repository: "myapp", Digest: "sha256:abc"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if len(store.images) != 1 {
+		t.Fatalf("expected 1 image to remain tracked, got %d", len(store.images))
+	}
+	if _, exists := store.images["myapp:3h"]; !exists {
+		t.Error("expected image with different digest to stay tracked")
+	}
+}
+
+func TestHandler_DeleteEvent_UntrackedTag(t *testing.T) {
+	store := newMockStore()
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "delete", Target: EventTarget{Repository: "myapp", Tag: "unknown"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func pullEvent(t *testing.T, handler *Handler, repo, tag string) {
+	t.Helper()
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "pull", Target: EventTarget{Repository: repo, Tag: tag}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestHandler_PullEvent_SlidingTTLExtends(t *testing.T) {
+	store := newMockStore()
+	originalExpiry := time.Now().Add(10 * time.Minute)
+	store.images["pr-123:4h"] = originalExpiry
+	store.created["pr-123:4h"] = time.Now().Add(-3 * time.Hour).UnixMilli()
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithSlidingTTL(2*time.Hour))
+	pullEvent(t, handler, "pr-123", "4h")
+
+	if !store.images["pr-123:4h"].After(originalExpiry.Add(time.Hour)) {
+		t.Fatalf("expected expiry to be extended, got %s", store.images["pr-123:4h"])
+	}
+	if store.lastPulled["pr-123:4h"].IsZero() {
+		t.Error("expected last pulled time to be recorded")
+	}
+}
+
+func TestHandler_PullEvent_SlidingTTLCappedByMaxTTL(t *testing.T) {
+	store := newMockStore()
+	created := time.Now().Add(-23 * time.Hour)
+	store.images["pr-123:4h"] = time.Now().Add(10 * time.Minute)
+	store.created["pr-123:4h"] = created.UnixMilli()
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithSlidingTTL(4*time.Hour))
+	pullEvent(t, handler, "pr-123", "4h")
+
+	ceiling := created.Add(24 * time.Hour)
+	if store.images["pr-123:4h"].UnixMilli() != ceiling.UnixMilli() {
+		t.Fatalf("expected expiry capped at %s, got %s", ceiling, store.images["pr-123:4h"])
+	}
+}
+
+func TestHandler_PullEvent_SlidingTTLCapRestartsOnPush(t *testing.T) {
+	store := newMockStore()
+	store.images["pr-123:1h"] = time.Now().Add(10 * time.Minute)
+	store.created["pr-123:1h"] = time.Now().Add(-23 * time.Hour).UnixMilli()
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithSlidingTTL(6*time.Hour))
+	if code, resp := postEvents(t, handler, RegistryEvent{
+		Action: "push",
+		Target: EventTarget{Repository: "pr-123", Tag: "1h"},
+	}); code != http.StatusOK {
+		t.Fatalf("push status = %d: %+v", code, resp)
+	}
+	pullEvent(t, handler, "pr-123", "1h")
+
+	// The cap counts from the re-push, not from the first push 23h ago.
+	if got := time.Until(store.images["pr-123:1h"]); got < 5*time.Hour+59*time.Minute {
+		t.Fatalf("expected a full idle window after the re-push, expiry in %s", got)
+	}
+}
+
+func TestHandler_PullEvent_SlidingTTLNeverShortens(t *testing.T) {
+	store := newMockStore()
+	originalExpiry := time.Now().Add(3 * time.Hour)
+	store.images["app:4h"] = originalExpiry
+	store.created["app:4h"] = time.Now().Add(-time.Hour).UnixMilli()
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithSlidingTTL(30*time.Minute))
+	pullEvent(t, handler, "app", "4h")
+
+	if !store.images["app:4h"].Equal(originalExpiry) {
+		t.Fatalf("expected expiry to stay at %s, got %s", originalExpiry, store.images["app:4h"])
+	}
+}
+
+func TestHandler_PullEvent_Disabled(t *testing.T) {
+	store := newMockStore()
+	originalExpiry := time.Now().Add(10 * time.Minute)
+	store.images["app:1h"] = originalExpiry
+
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+	pullEvent(t, handler, "app", "1h")
+
+	if !store.images["app:1h"].Equal(originalExpiry) {
+		t.Fatal("expected expiry to be unchanged when sliding expiry is disabled")
+	}
+	if _, ok := store.lastPulled["app:1h"]; ok {
+		t.Error("expected no pull tracking when sliding expiry is disabled")
+	}
+}
+
+func postEvents(t *testing.T, handler *Handler, events ...RegistryEvent) (int, EventResponse) {
+	t.Helper()
+	body, _ := json.Marshal(EventEnvelope{Events: events})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var resp EventResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return rr.Code, resp
+}
+
+func TestHandler_DuplicateEventNotReprocessed(t *testing.T) {
+	store := newMockStore()
+	reg := &mockRegistry{digests: map[string]string{"myapp:1h": "sha256:abc"}}
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithDedup(time.Hour))
+
+	event := RegistryEvent{ID: "evt-1", Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}}
+
+	code, resp := postEvents(t, handler, event)
+	if code != http.StatusOK || resp.Results[0].Status != StatusProcessed {
+		t.Fatalf("expected first delivery to be processed, got %d %+v", code, resp.Results)
+	}
+
+	// A redelivery must not reset the expiry.
+	pinned := time.Now().Add(10 * time.Minute)
+	store.images["myapp:1h"] = pinned
+
+	code, resp = postEvents(t, handler, event)
+	if code != http.StatusOK || resp.Results[0].Status != StatusDuplicate {
+		t.Fatalf("expected redelivery to be a duplicate, got %d %+v", code, resp.Results)
+	}
+	if !store.images["myapp:1h"].Equal(pinned) {
+		t.Error("expected duplicate event to leave the expiry untouched")
+	}
+}
+
+func TestHandler_PartialFailureReportsPerEventResults(t *testing.T) {
+	store := &failingStore{newMockStore()}
+	store.images["myapp:old"] = time.Now().Add(time.Hour)
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithDedup(time.Hour))
+
+	code, resp := postEvents(t, handler,
+		RegistryEvent{ID: "evt-push", Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+		RegistryEvent{ID: "evt-delete", Action: "delete", Target: EventTarget{Repository: "myapp", Tag: "old"}},
+		RegistryEvent{ID: "evt-mount", Action: "mount", Target: EventTarget{Repository: "myapp"}},
+	)
+
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	want := []string{StatusFailed, StatusProcessed, StatusIgnored}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), resp.Results)
+	}
+	for i, status := range want {
+		if resp.Results[i].Status != status {
+			t.Errorf("result %d: expected %s, got %s", i, status, resp.Results[i].Status)
+		}
+	}
+	if resp.Results[0].Error == "" {
+		t.Error("expected failed result to carry an error")
+	}
+	if store.processed["evt-push"] || !store.processed["evt-delete"] {
+		t.Errorf("expected only the delete to be recorded as processed, got %v", store.processed)
+	}
+}
+
+func TestHandler_TTLFromAnnotation(t *testing.T) {
+	store := newMockStore()
+	reg := &mockRegistry{
+		digests:     map[string]string{"myapp:sha-abc123": "sha256:abc"},
+		annotations: map[string]map[string]string{"sha256:abc": {"wf.meh.ephemeron.ttl": "6h"}},
+	}
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithTTLAnnotations([]string{"wf.meh.ephemeron.ttl"}))
+
+	postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "sha-abc123"}})
+
+	expires, exists := store.images["myapp:sha-abc123"]
+	if !exists {
+		t.Fatal("expected image to be tracked")
+	}
+	if remaining := time.Until(expires); remaining < 5*time.Hour || remaining > 6*time.Hour {
+		t.Errorf("expected ~6h TTL from annotation, got %v", remaining)
+	}
+}
+
+func TestHandler_KeepAnnotationUntracks(t *testing.T) {
+	store := newMockStore()
+	store.images["myapp:1h"] = time.Now().Add(time.Hour)
+	store.digests["myapp:1h"] = "sha256:old"
+	reg := &mockRegistry{
+		digests:     map[string]string{"myapp:1h": "sha256:new"},
+		annotations: map[string]map[string]string{"sha256:new": {"wf.meh.ephemeron.ttl": "keep"}},
+	}
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithTTLAnnotations([]string{"wf.meh.ephemeron.ttl"}))
+
+	code, _ := postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}})
+
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if _, exists := store.images["myapp:1h"]; exists {
+		t.Error("expected kept image not to be tracked")
+	}
+}
+
+func testPolicy(t *testing.T, rules string) *policy.Source {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := policy.NewSource(file)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+	return src
+}
+
+func TestHandler_Policy(t *testing.T) {
+	src := testPolicy(t, `
+rules:
+  - name: release
+    repository: "release/*"
+    immutable: true
+  - name: ci
+    repository: "ci/*"
+    default_ttl: 30m
+  - name: staging
+    repository: "staging/*"
+    max_ttl: 7d
+  - name: pinned
+    repository: "base/*"
+    never_reap: true
+`)
+
+	t.Run("rule default ttl", func(t *testing.T) {
+		store := newMockStore()
+		handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithPolicy(src))
+		postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "ci/frontend", Tag: "latest"}})
+
+		if remaining := time.Until(store.images["ci/frontend:latest"]); remaining > 30*time.Minute {
+			t.Errorf("expected rule default of 30m, got %v", remaining)
+		}
+	})
+
+	t.Run("rule max ttl above global", func(t *testing.T) {
+		store := newMockStore()
+		handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithPolicy(src))
+		postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "staging/api", Tag: "3d"}})
+
+		if remaining := time.Until(store.images["staging/api:3d"]); remaining < 71*time.Hour {
+			t.Errorf("expected 3d TTL allowed by rule, got %v", remaining)
+		}
+	})
+
+	t.Run("rule immutability", func(t *testing.T) {
+		store := newMockStore()
+		store.images["release/api:v1"] = time.Now().Add(time.Hour)
+		store.digests["release/api:v1"] = "sha256:old"
+		reg := &mockRegistry{digests: map[string]string{"release/api:v1": "sha256:new"}}
+		handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithPolicy(src))
+
+		code, _ := postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "release/api", Tag: "v1"}})
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("expected overwrite to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("never reap", func(t *testing.T) {
+		store := newMockStore()
+		handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithPolicy(src))
+		postEvents(t, handler, RegistryEvent{Action: "push", Target: EventTarget{Repository: "base/alpine", Tag: "1h"}})
+
+		if _, exists := store.images["base/alpine:1h"]; exists {
+			t.Error("expected never_reap image not to be tracked")
+		}
+	})
+}
+
+// recordingSink collects the events posted to it.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (s *recordingSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e notify.Event
+	_ = json.NewDecoder(r.Body).Decode(&e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
 
-	// Should return false (pattern error is logged and skipped)
-	if handler.isImmutableTag("test") {
-		t.Error("expected false for invalid pattern")
+func TestHandler_Notifications(t *testing.T) {
+	sink := &recordingSink{}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+	notifier := notify.New(&notify.Config{Sinks: []notify.Sink{{Name: "test", URL: srv.URL, Secret: "s"}}}, nil, slog.Default())
+	notifier.Start(t.Context())
+
+	store := newMockStore()
+	store.digests["myapp:1h"] = "sha256:old123"
+	registry := &mockRegistry{
+		sizes:   map[string]int64{"myapp:1h": 100000},
+		digests: map[string]string{"myapp:1h": "sha256:new456"},
+	}
+	handler := NewHandler(store, registry, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithNotifier(notifier))
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	notifier.Close()
+
+	if len(sink.events) != 2 {
+		t.Fatalf("expected overwritten and tracked events, got %+v", sink.events)
+	}
+	overwritten, tracked := sink.events[0], sink.events[1]
+	if overwritten.Type != notify.EventOverwritten ||
+		overwritten.PreviousDigest != "sha256:old123" ||
+		overwritten.Digest != "sha256:new456" {
+		t.Errorf("unexpected overwritten event: %+v", overwritten)
+	}
+	if tracked.Type != notify.EventTracked ||
+		tracked.Image != "myapp:1h" ||
+		tracked.SizeBytes != 100000 ||
+		tracked.TTL != "1h0m0s" ||
+		tracked.ExpiresAt.IsZero() {
+		t.Errorf("unexpected tracked event: %+v", tracked)
+	}
+}
+
+// historyStore keeps image history in memory.
+type historyStore struct {
+	entries map[string][][]byte
+}
+
+func (s *historyStore) AppendHistory(_ context.Context, imageWithTag string, entry []byte, _ time.Duration) error {
+	if s.entries == nil {
+		s.entries = make(map[string][][]byte)
+	}
+	s.entries[imageWithTag] = append(s.entries[imageWithTag], entry)
+	return nil
+}
+
+func (s *historyStore) ImageHistory(_ context.Context, imageWithTag string, _ int64) ([][]byte, error) {
+	return s.entries[imageWithTag], nil
+}
+
+func TestHandler_History(t *testing.T) {
+	store := newMockStore()
+	registry := &mockRegistry{
+		sizes:   map[string]int64{"api:2h": 1000},
+		digests: map[string]string{"api:2h": "sha256:aaa"},
+	}
+	history := audit.New(&historyStore{}, time.Hour, slog.Default())
+	handler := NewHandler(store, registry, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithHistory(history))
+
+	push := RegistryEvent{
+		Action:  "push",
+		Target:  EventTarget{Repository: "api", Tag: "2h"},
+		Actor:   EventActor{Name: "ci-bot"},
+		Request: EventRequest{Addr: "10.0.0.1:5000"},
+	}
+	postEvents(t, handler, push)
+	postEvents(t, handler, push)
+	registry.digests["api:2h"] = "sha256:bbb"
+	postEvents(t, handler, push)
+	postEvents(t, handler, RegistryEvent{Action: "delete", Target: EventTarget{Repository: "api", Tag: "2h"}})
+
+	entries, err := history.History(t.Context(), "api:2h", 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []audit.Action{audit.ActionTracked, audit.ActionRepushed, audit.ActionOverwritten, audit.ActionUntracked}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	for i, e := range entries {
+		if e.Action != want[i] {
+			t.Errorf("entry %d action = %s, want %s", i, e.Action, want[i])
+		}
+	}
+	if e := entries[0]; e.Actor != "ci-bot" || e.Addr != "10.0.0.1:5000" || e.Digest != "sha256:aaa" || e.SizeBytes != 1000 || e.ExpiresAt.IsZero() {
+		t.Errorf("unexpected tracked entry: %+v", e)
+	}
+	if e := entries[2]; e.Digest != "sha256:bbb" || e.PreviousDigest != "sha256:aaa" {
+		t.Errorf("unexpected overwritten entry: %+v", e)
+	}
+	if tomb := audit.Tombstone(entries); tomb == nil || tomb.Reason != "registry_delete" || tomb.SizeBytes != 1000 {
+		t.Errorf("unexpected tombstone: %+v", tomb)
 	}
 }
@@ -3,6 +3,7 @@ package hooks
 import (
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -70,3 +71,26 @@ func ClampTTL(d, defaultTTL, maxTTL time.Duration) time.Duration {
 	}
 	return d
 }
+
+// ResolveTTL determines the TTL of an image. The first of keys found in
+// annotations (manifest annotations or config labels) takes precedence over
+// the tag. keep reports that the annotation value is "keep" or "pin", which
+// exempts the image from expiry; the returned TTL is then meaningless.
+func ResolveTTL(
+	tag string, annotations map[string]string, keys []string, defaultTTL, maxTTL time.Duration,
+) (ttl time.Duration, keep bool) {
+	for _, key := range keys {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "keep", "pin":
+			return 0, true
+		}
+		if d := ParseTTL(strings.TrimSpace(value)); d > 0 {
+			return ClampTTL(d, defaultTTL, maxTTL), false
+		}
+	}
+	return ClampTTL(ParseTTL(tag), defaultTTL, maxTTL), false
+}
@@ -65,3 +65,36 @@ func TestClampTTL(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveTTL(t *testing.T) {
+	keys := []string{"wf.meh.ephemeron.ttl", "org.opencontainers.image.ttl"}
+
+	tests := []struct {
+		name        string
+		tag         string
+		annotations map[string]string
+		wantTTL     time.Duration
+		wantKeep    bool
+	}{
+		{"tag only", "2h", nil, 2 * time.Hour, false},
+		{"annotation wins over tag", "2h", map[string]string{"wf.meh.ephemeron.ttl": "30m"}, 30 * time.Minute, false},
+		{"annotation on plain tag", "sha-abc123", map[string]string{"org.opencontainers.image.ttl": "3d"}, 24 * time.Hour, false},
+		{"first key wins", "latest", map[string]string{
+			"wf.meh.ephemeron.ttl":         "4h",
+			"org.opencontainers.image.ttl": "5h",
+		}, 4 * time.Hour, false},
+		{"invalid annotation falls back to tag", "2h", map[string]string{"wf.meh.ephemeron.ttl": "soon"}, 2 * time.Hour, false},
+		{"unknown key ignored", "latest", map[string]string{"other": "5h"}, time.Hour, false},
+		{"keep", "1h", map[string]string{"wf.meh.ephemeron.ttl": "keep"}, 0, true},
+		{"pin", "1h", map[string]string{"org.opencontainers.image.ttl": " PIN "}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, keep := ResolveTTL(tt.tag, tt.annotations, keys, time.Hour, 24*time.Hour)
+			if ttl != tt.wantTTL || keep != tt.wantKeep {
+				t.Errorf("ResolveTTL() = (%v, %v), want (%v, %v)", ttl, keep, tt.wantTTL, tt.wantKeep)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+const (
+	// readBatchSize is the number of events a consumer reads per round trip.
+	readBatchSize = 10
+	// readBlock is how long a consumer waits for new events.
+	readBlock = 5 * time.Second
+	// defaultClaimIdle is how long an event may stay unacknowledged before
+	// another consumer reclaims it. It doubles as the retry backoff.
+	defaultClaimIdle = 30 * time.Second
+	// defaultMaxDeliveries is how often an event is attempted before it is dropped.
+	defaultMaxDeliveries = 5
+)
+
+// Worker processes registry events from the durable queue with a pool of
+// consumers. Failed events stay pending and are retried once they have been
+// idle for the claim interval, which also recovers events from crashed
+// replicas.
+type Worker struct {
+	handler       *Handler
+	queue         redisclient.EventQueue
+	consumer      string
+	concurrency   int
+	claimIdle     time.Duration
+	maxDeliveries int64
+	logger        *slog.Logger
+}
+
+// WorkerOption configures a Worker.
+type WorkerOption func(*Worker)
+
+// WithClaimIdle sets how long a failed or orphaned event stays pending before
+// it is retried.
+func WithClaimIdle(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		if d > 0 {
+			w.claimIdle = d
+		}
+	}
+}
+
+// WithMaxDeliveries sets how often an event is attempted before it is dropped.
+func WithMaxDeliveries(n int64) WorkerOption {
+	return func(w *Worker) {
+		if n > 0 {
+			w.maxDeliveries = n
+		}
+	}
+}
+
+// NewWorker creates a worker pool of the given size. The consumer name must
+// be unique per replica (e.g. the pod name).
+func NewWorker(
+	handler *Handler,
+	queue redisclient.EventQueue,
+	consumer string,
+	concurrency int,
+	logger *slog.Logger,
+	opts ...WorkerOption,
+) *Worker {
+	w := &Worker{
+		handler:       handler,
+		queue:         queue,
+		consumer:      consumer,
+		concurrency:   concurrency,
+		claimIdle:     defaultClaimIdle,
+		maxDeliveries: defaultMaxDeliveries,
+		logger:        logger,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run starts the consumers and the reclaimer. It blocks until the context is
+// cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		err := w.queue.EnsureEventGroup(ctx)
+		if err == nil {
+			break
+		}
+		w.logger.Error("failed to create event consumer group, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	w.logger.Info("starting event workers", "consumer", w.consumer, "concurrency", w.concurrency)
+
+	var wg sync.WaitGroup
+	for range w.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.reclaim(ctx)
+	}()
+	wg.Wait()
+
+	w.logger.Info("event workers stopped")
+}
+
+// consume reads new events until the context is cancelled.
+func (w *Worker) consume(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := w.queue.ReadEvents(ctx, w.consumer, readBatchSize, readBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.Warn("failed to read events", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, event := range events {
+			w.handle(ctx, event)
+		}
+	}
+}
+
+// reclaim periodically takes over events that have been pending for too long,
+// trims acknowledged events from the stream and refreshes the queue metrics.
+func (w *Worker) reclaim(ctx context.Context) {
+	ticker := time.NewTicker(w.claimIdle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events, err := w.queue.ClaimStaleEvents(ctx, w.consumer, w.claimIdle, readBatchSize)
+		if err != nil {
+			w.logger.Warn("failed to reclaim pending events", "error", err)
+		}
+		for _, event := range events {
+			w.handle(ctx, event)
+		}
+
+		if err := w.queue.TrimEvents(ctx); err != nil {
+			w.logger.Warn("failed to trim acknowledged events", "error", err)
+		}
+
+		if stats, err := w.queue.EventQueueStats(ctx); err == nil {
+			metrics.QueuePendingEvents.Set(float64(stats.Pending))
+			metrics.QueueLagEvents.Set(float64(stats.Lag))
+		}
+	}
+}
+
+// handle processes one queued event and acknowledges it unless it should be
+// retried.
+func (w *Worker) handle(ctx context.Context, queued redisclient.QueuedEvent) {
+	if queued.Deliveries <= 1 && !queued.EnqueuedAt.IsZero() {
+		metrics.QueueLatency.Observe(time.Since(queued.EnqueuedAt).Seconds())
+	}
+
+	var event RegistryEvent
+	if err := json.Unmarshal(queued.Payload, &event); err != nil {
+		w.logger.Error("dropping undecodable event", "id", queued.ID, "error", err)
+		metrics.QueueEventsDropped.Inc()
+		w.ack(ctx, queued.ID)
+		return
+	}
+
+	_, err := w.handler.processEvent(ctx, event)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrImmutableTag):
+		// Retrying cannot change the outcome; the violation is already
+		// logged and counted.
+	case queued.Deliveries >= w.maxDeliveries:
+		w.logger.Error("dropping event after repeated failures",
+			"id", queued.ID,
+			"event_id", event.ID,
+			"action", event.Action,
+			"image", event.Target.Repository,
+			"tag", event.Target.Tag,
+			"deliveries", queued.Deliveries,
+			"error", err,
+		)
+		metrics.QueueEventsDropped.Inc()
+	default:
+		w.logger.Warn("failed to process event, will retry",
+			"id", queued.ID,
+			"event_id", event.ID,
+			"action", event.Action,
+			"image", event.Target.Repository,
+			"tag", event.Target.Tag,
+			"deliveries", queued.Deliveries,
+			"retry_after", w.claimIdle.String(),
+			"error", err,
+		)
+		return
+	}
+
+	w.ack(ctx, queued.ID)
+}
+
+func (w *Worker) ack(ctx context.Context, id string) {
+	if err := w.queue.AckEvent(ctx, id); err != nil {
+		w.logger.Warn("failed to acknowledge event", "id", id, "error", err)
+	}
+}
@@ -0,0 +1,184 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// mockQueue is an in-memory implementation of redis.EventQueue for testing.
+type mockQueue struct {
+	enqueued   [][]byte
+	acked      []string
+	enqueueErr error
+}
+
+func (m *mockQueue) EnsureEventGroup(context.Context) error { return nil }
+
+func (m *mockQueue) EnqueueEvents(_ context.Context, payloads [][]byte) error {
+	if m.enqueueErr != nil {
+		return m.enqueueErr
+	}
+	m.enqueued = append(m.enqueued, payloads...)
+	return nil
+}
+
+func (m *mockQueue) ReadEvents(context.Context, string, int64, time.Duration) ([]redisclient.QueuedEvent, error) {
+	return nil, nil
+}
+
+func (m *mockQueue) ClaimStaleEvents(
+	context.Context, string, time.Duration, int64,
+) ([]redisclient.QueuedEvent, error) {
+	return nil, nil
+}
+
+func (m *mockQueue) AckEvent(_ context.Context, id string) error {
+	m.acked = append(m.acked, id)
+	return nil
+}
+
+func (m *mockQueue) EventQueueStats(context.Context) (redisclient.QueueStats, error) {
+	return redisclient.QueueStats{}, nil
+}
+
+func (m *mockQueue) TrimEvents(context.Context) error { return nil }
+
+func queuedEvent(t *testing.T, id string, deliveries int64, event RegistryEvent) redisclient.QueuedEvent {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("encoding event: %v", err)
+	}
+	return redisclient.QueuedEvent{ID: id, Payload: payload, EnqueuedAt: time.Now(), Deliveries: deliveries}
+}
+
+func TestHandler_Queue_EnqueuesAndAccepts(t *testing.T) {
+	queue := &mockQueue{}
+	handler := NewHandler(nil, nil, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithQueue(queue))
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+		{Action: "push", Target: EventTarget{Repository: "myapp", Tag: ""}},
+		{Action: "pull", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+		{Action: "delete", Target: EventTarget{Repository: "myapp", Digest: "sha256:abc"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rr.Code)
+	}
+	if len(queue.enqueued) != 2 {
+		t.Fatalf("expected push and delete to be enqueued, got %d events", len(queue.enqueued))
+	}
+}
+
+func TestHandler_Queue_EnqueueFailure(t *testing.T) {
+	queue := &mockQueue{enqueueErr: errors.New("redis down")}
+	handler := NewHandler(nil, nil, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithQueue(queue))
+
+	body, _ := json.Marshal(EventEnvelope{Events: []RegistryEvent{
+		{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/hook/registry-event", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Token tok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+}
+
+func TestWorker_ProcessesAndAcks(t *testing.T) {
+	store := newMockStore()
+	reg := &mockRegistry{
+		sizes:   map[string]int64{"myapp:1h": 1000},
+		digests: map[string]string{"myapp:1h": "sha256:abc"},
+	}
+	queue := &mockQueue{}
+	handler := NewHandler(store, reg, "tok", time.Hour, 24*time.Hour, nil, slog.Default(), WithQueue(queue))
+	worker := NewWorker(handler, queue, "test", 1, slog.Default())
+
+	worker.handle(t.Context(), queuedEvent(t, "1-0", 1, RegistryEvent{
+		Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"},
+	}))
+
+	if _, exists := store.images["myapp:1h"]; !exists {
+		t.Fatal("expected image to be tracked")
+	}
+	if len(queue.acked) != 1 || queue.acked[0] != "1-0" {
+		t.Fatalf("expected event to be acked, got %v", queue.acked)
+	}
+}
+
+func TestWorker_FailureLeavesEventPending(t *testing.T) {
+	queue := &mockQueue{}
+	handler := NewHandler(&failingStore{newMockStore()}, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil,
+		slog.Default(), WithQueue(queue))
+	worker := NewWorker(handler, queue, "test", 1, slog.Default(), WithMaxDeliveries(3))
+
+	event := RegistryEvent{Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"}}
+
+	worker.handle(t.Context(), queuedEvent(t, "1-0", 2, event))
+	if len(queue.acked) != 0 {
+		t.Fatalf("expected failed event to stay pending, got acks %v", queue.acked)
+	}
+
+	worker.handle(t.Context(), queuedEvent(t, "1-0", 3, event))
+	if len(queue.acked) != 1 {
+		t.Fatalf("expected event to be dropped after max deliveries, got acks %v", queue.acked)
+	}
+}
+
+func TestWorker_UndecodableEventIsDropped(t *testing.T) {
+	queue := &mockQueue{}
+	handler := NewHandler(newMockStore(), &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default())
+	worker := NewWorker(handler, queue, "test", 1, slog.Default())
+
+	worker.handle(t.Context(), redisclient.QueuedEvent{ID: "1-0", Payload: []byte("not json"), Deliveries: 1})
+
+	if len(queue.acked) != 1 {
+		t.Fatalf("expected undecodable event to be acked, got %v", queue.acked)
+	}
+}
+
+// failingStore fails every TrackImage call.
+type failingStore struct {
+	*mockStore
+}
+
+func (f *failingStore) TrackImage(context.Context, string, time.Time, int64, string) error {
+	return errors.New("redis down")
+}
+
+func TestWorker_SkipsProcessedEvents(t *testing.T) {
+	store := newMockStore()
+	store.processed["evt-1"] = true
+	queue := &mockQueue{}
+	handler := NewHandler(store, &mockRegistry{}, "tok", time.Hour, 24*time.Hour, nil, slog.Default(),
+		WithQueue(queue), WithDedup(time.Hour))
+	worker := NewWorker(handler, queue, "test", 1, slog.Default())
+
+	worker.handle(t.Context(), queuedEvent(t, "1-0", 1, RegistryEvent{
+		ID: "evt-1", Action: "push", Target: EventTarget{Repository: "myapp", Tag: "1h"},
+	}))
+
+	if _, exists := store.images["myapp:1h"]; exists {
+		t.Error("expected already processed event not to be applied again")
+	}
+	if len(queue.acked) != 1 {
+		t.Fatalf("expected duplicate event to be acked, got %v", queue.acked)
+	}
+}
@@ -0,0 +1,156 @@
+// Package immutability decides which tags may not be overwritten, from
+// repository-scoped rules with glob or regular expression patterns.
+package immutability
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Rule marks the tags it matches immutable or, with Immutable false, exempts
+// them from every later rule.
+type Rule struct {
+	// Name identifies the rule in logs and metrics.
+	Name       string
+	Repository string
+	Tag        string
+	Immutable  bool
+
+	repo matcher
+	tag  matcher
+}
+
+// Rules is an ordered list of compiled rules; the first match decides.
+type Rules struct {
+	rules []Rule
+}
+
+// matcher matches a compiled pattern. A nil matcher matches everything.
+type matcher func(string) bool
+
+// New combines compiled rules, in order, into a rule set.
+func New(rules ...[]Rule) *Rules {
+	var all []Rule
+	for _, r := range rules {
+		all = append(all, r...)
+	}
+	return &Rules{rules: all}
+}
+
+// ParseRules compiles a list of rules separated by newlines or ";". Each
+// rule is "<name> <repository> <tag> [immutable|mutable]", where the
+// patterns are path.Match globs, or regular expressions anchored to the
+// whole name when written as /expr/. A pattern of "*" matches everything.
+//
+//	releases release/* /v\d+\.\d+\.\d+/; sandbox sandbox/* * mutable
+func ParseRules(spec string) ([]Rule, error) {
+	var (
+		rules []Rule
+		errs  []error
+		names = make(map[string]bool)
+	)
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 || len(fields) > 4 {
+			errs = append(errs, fmt.Errorf("rule %q: want <name> <repository> <tag> [immutable|mutable]", strings.TrimSpace(line)))
+			continue
+		}
+		rule := Rule{Name: fields[0], Repository: fields[1], Tag: fields[2], Immutable: true}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate name", rule.Name))
+		}
+		names[rule.Name] = true
+		if len(fields) == 4 {
+			switch fields[3] {
+			case "immutable":
+			case "mutable":
+				rule.Immutable = false
+			default:
+				errs = append(errs, fmt.Errorf("rule %s: mode must be immutable or mutable, got %q", rule.Name, fields[3]))
+			}
+		}
+		var err error
+		if rule.repo, err = compile(rule.Repository); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: invalid repository pattern: %w", rule.Name, err))
+		}
+		if rule.tag, err = compile(rule.Tag); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: invalid tag pattern: %w", rule.Name, err))
+		}
+		rules = append(rules, rule)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// TagPatterns compiles IMMUTABLE_TAG_PATTERNS globs into rules that apply to
+// every repository, each named after its pattern.
+func TagPatterns(patterns []string) ([]Rule, error) {
+	var (
+		rules []Rule
+		errs  []error
+	)
+	for _, pattern := range patterns {
+		m, err := compileGlob(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern %q: %w", pattern, err))
+			continue
+		}
+		rules = append(rules, Rule{Name: pattern, Tag: pattern, Immutable: true, tag: m})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// compile compiles a glob or a /regex/ pattern.
+func compile(pattern string) (matcher, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr := pattern[1 : len(pattern)-1]
+		if expr == "" {
+			return nil, errors.New("empty regular expression")
+		}
+		re, err := regexp.Compile(`^(?:` + expr + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	return compileGlob(pattern)
+}
+
+func compileGlob(pattern string) (matcher, error) {
+	if pattern == "*" {
+		return nil, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(s string) bool {
+		ok, _ := path.Match(pattern, s)
+		return ok
+	}, nil
+}
+
+// Match returns the first rule matching repo and tag, or nil. It is safe to
+// call on a nil Rules.
+func (r *Rules) Match(repo, tag string) *Rule {
+	if r == nil {
+		return nil
+	}
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if (rule.repo == nil || rule.repo(repo)) && (rule.tag == nil || rule.tag(tag)) {
+			return rule
+		}
+	}
+	return nil
+}
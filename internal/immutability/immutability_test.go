@@ -0,0 +1,77 @@
+package immutability
+
+import "testing"
+
+func TestRules_Match(t *testing.T) {
+	rules, err := ParseRules(`releases release/* /v\d+\.\d+\.\d+/
+sandbox sandbox/* * mutable; base /(base|tools)/.+/ stable`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	patterns, err := TagPatterns([]string{"prod-*", "latest"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := New(rules, patterns)
+
+	tests := []struct {
+		repo, tag string
+		rule      string
+		immutable bool
+	}{
+		{"release/api", "v1.2.3", "releases", true},
+		{"release/api", "v1.2", "", false},
+		{"release/api", "v1.2.3-rc1", "", false},
+		{"release/api/sub", "v1.2.3", "", false},
+		{"sandbox/api", "v1.2.3", "sandbox", false},
+		{"sandbox/api", "prod-1", "sandbox", false},
+		{"tools/x/lint", "stable", "base", true},
+		{"ci/api", "prod-1", "prod-*", true},
+		{"ci/api/sub", "latest", "latest", true},
+		{"ci/api", "1h", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo+":"+tt.tag, func(t *testing.T) {
+			rule := r.Match(tt.repo, tt.tag)
+			if tt.rule == "" {
+				if rule != nil {
+					t.Fatalf("expected no match, got rule %s", rule.Name)
+				}
+				return
+			}
+			if rule == nil || rule.Name != tt.rule || rule.Immutable != tt.immutable {
+				t.Fatalf("got %+v, want rule %s immutable=%v", rule, tt.rule, tt.immutable)
+			}
+		})
+	}
+
+	if (*Rules)(nil).Match("a", "b") != nil {
+		t.Error("expected nil Rules to match nothing")
+	}
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"too few fields", "releases release/*"},
+		{"too many fields", "releases release/* v* mutable extra"},
+		{"bad mode", "releases release/* v* frozen"},
+		{"bad glob", "releases release/[ v*"},
+		{"bad regex", `releases release/* /v(\d+/`},
+		{"empty regex", "releases release/* //"},
+		{"duplicate name", "a x/* v*; a y/* v*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRules(tt.spec); err == nil {
+				t.Fatalf("expected error for %q", tt.spec)
+			}
+		})
+	}
+
+	if _, err := TagPatterns([]string{"[invalid"}); err == nil {
+		t.Error("expected error for invalid tag pattern")
+	}
+}
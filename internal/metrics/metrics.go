@@ -22,13 +22,72 @@ var (
 		Help:      "Total number of images added to TTL tracking.",
 	})
 
-	// ImagesReaped counts images deleted by the reaper.
-	ImagesReaped = promauto.NewCounter(prometheus.CounterOpts{
+	// ImagesDeleted counts tracked images removed because they were deleted
+	// from the registry outside of the reaper.
+	ImagesDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "images_deleted_total",
+		Help:      "Total number of tracked images removed after a registry delete event.",
+	})
+
+	// ExpiryExtensions counts expiry extensions from pulls in sliding expiry mode.
+	ExpiryExtensions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "expiry_extensions_total",
+		Help:      "Total number of image expiries extended by a pull (sliding expiry).",
+	})
+
+	// DuplicateEvents counts webhook events skipped because their ID was already processed.
+	DuplicateEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "duplicate_events_total",
+		Help:      "Total number of webhook events skipped because they were already processed.",
+	})
+
+	// QueueLatency observes the time events spend in the queue before processing.
+	QueueLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "queue_latency_seconds",
+		Help:      "Time between enqueueing a webhook event and its first processing attempt.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	})
+
+	// QueueLagEvents shows the number of queued events not yet delivered to a worker.
+	QueueLagEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "queue_lag_events",
+		Help:      "Number of queued webhook events not yet delivered to a worker.",
+	})
+
+	// QueuePendingEvents shows the number of delivered but unacknowledged events.
+	QueuePendingEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "queue_pending_events",
+		Help:      "Number of webhook events delivered to a worker but not yet acknowledged.",
+	})
+
+	// QueueEventsDropped counts queued events given up on.
+	QueueEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "hooks",
+		Name:      "queue_events_dropped_total",
+		Help:      "Total number of queued webhook events dropped after repeated failures.",
+	})
+
+	// ImagesReaped counts images deleted by the reaper, by reason ("ttl",
+	// "count" or "manual"). Budget evictions are counted by ImagesEvicted.
+	ImagesReaped = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "ephemeron",
 		Subsystem: "reaper",
 		Name:      "images_reaped_total",
-		Help:      "Total number of expired images deleted.",
-	})
+		Help:      "Total number of images deleted by the reaper, by reason.",
+	}, []string{"reason"})
 
 	// ReaperCycleDuration observes the duration of each reap cycle.
 	ReaperCycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
@@ -47,6 +106,59 @@ var (
 		Help:      "Total number of failed reaper cycles.",
 	})
 
+	// ReaperCycleLimited counts reap cycles that stopped at REAP_MAX_DELETIONS
+	// or REAP_MAX_DURATION, by limit: deletions or duration.
+	ReaperCycleLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "cycle_limited_total",
+		Help:      "Total reap cycles that stopped at a per-cycle limit, leaving work for the next cycle.",
+	}, []string{"limit"})
+
+	// ReaperLockAcquisitions counts reaper lock attempts, by result:
+	// acquired, or busy when another replica holds the lock.
+	ReaperLockAcquisitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "lock_acquisitions_total",
+		Help:      "Total reaper lock acquisition attempts, by result.",
+	}, []string{"result"})
+
+	// ReaperLockHeld is 1 while this replica holds the reaper lock.
+	ReaperLockHeld = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "lock_held",
+		Help:      "Whether this replica currently holds the reaper lock (1) or not (0).",
+	})
+
+	// ReaperLockFence shows the fencing token of this replica's latest
+	// reaper lock acquisition.
+	ReaperLockFence = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "lock_fence",
+		Help:      "Fencing token of the latest reaper lock acquired by this replica.",
+	})
+
+	// ReaperLockLost counts reaper locks lost during a cycle, by reason:
+	// taken_over by another replica, or expired after failed renewals.
+	ReaperLockLost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "lock_lost_total",
+		Help:      "Total reaper locks lost before the cycle ended, by reason.",
+	}, []string{"reason"})
+
+	// ReaperDeadLetterImages shows the number of images the reaper gave up
+	// on after repeated failed deletions.
+	ReaperDeadLetterImages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "dead_letter_images",
+		Help:      "Current number of images in the dead-letter set after repeated failed deletions.",
+	})
+
 	// TrackedImagesGauge shows the current number of tracked images.
 	TrackedImagesGauge = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: "ephemeron",
@@ -63,6 +175,31 @@ var (
 		Help:      "Total storage in bytes currently tracked for expiry.",
 	})
 
+	// PinnedImagesSkipped reports the expired images skipped in the last reap
+	// cycle because they are pinned.
+	PinnedImagesSkipped = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "pinned_images_skipped",
+		Help:      "Number of expired images skipped in the last reap cycle because they are pinned.",
+	})
+
+	// ImagesEvicted counts images deleted before expiry to stay within a storage budget.
+	ImagesEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "reaper",
+		Name:      "images_evicted_total",
+		Help:      "Total number of images deleted before expiry to enforce a storage budget.",
+	}, []string{"budget"})
+
+	// BytesEvicted counts storage reclaimed by storage budget evictions.
+	BytesEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "storage",
+		Name:      "bytes_evicted_total",
+		Help:      "Total storage in bytes reclaimed by evicting images to enforce a storage budget.",
+	}, []string{"budget"})
+
 	// BytesReclaimed counts total storage reclaimed by deletion.
 	BytesReclaimed = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "ephemeron",
@@ -120,11 +257,62 @@ var (
 		Help:      "Total failures fetching digest from registry.",
 	})
 
-	// ImmutableTagViolations counts blocked overwrites in enforcement mode.
+	// ImmutableTagViolations counts blocked overwrites in enforcement mode,
+	// by the policy or immutability rule that made the tag immutable.
 	ImmutableTagViolations = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "ephemeron",
 		Subsystem: "immutability",
 		Name:      "immutable_tag_violations_total",
 		Help:      "Total overwrite attempts blocked by immutability enforcement.",
-	}, []string{"repository", "tag"})
+	}, []string{"repository", "rule"})
+
+	// ImmutableTagRollbacks counts rollbacks of immutable tag overwrites in
+	// rollback mode, by result: restored or failed.
+	ImmutableTagRollbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "immutability",
+		Name:      "rollbacks_total",
+		Help:      "Total immutable tag overwrites rolled back, by result.",
+	}, []string{"result"})
+
+	// NotificationsTotal counts outbound notifications by sink and outcome:
+	// delivered, dead_lettered or dropped (queue full).
+	NotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "notify",
+		Name:      "notifications_total",
+		Help:      "Total number of outbound notifications by sink and result.",
+	}, []string{"sink", "result"})
+
+	// NotificationRetries counts failed delivery attempts that were retried.
+	NotificationRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "notify",
+		Name:      "retries_total",
+		Help:      "Total number of notification delivery attempts that failed and were retried.",
+	}, []string{"sink"})
+
+	// ExpiryWarnings counts "expiring soon" warnings sent.
+	ExpiryWarnings = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "warn",
+		Name:      "warnings_total",
+		Help:      "Total number of expiry warnings sent.",
+	})
+
+	// ExpiryWarningMailErrors counts expiry warnings that could not be mailed.
+	ExpiryWarningMailErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "warn",
+		Name:      "mail_errors_total",
+		Help:      "Total number of expiry warnings that failed to send by mail.",
+	})
+
+	// AuditWriteErrors counts image history entries that could not be stored.
+	AuditWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ephemeron",
+		Subsystem: "audit",
+		Name:      "write_errors_total",
+		Help:      "Total number of image history entries that failed to be written.",
+	})
 )
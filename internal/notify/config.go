@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// defaultMaxAttempts is how often a notification is tried before it is
+// dead-lettered, unless a sink sets max_attempts.
+const defaultMaxAttempts = 5
+
+// Config is the notification file (NOTIFY_FILE).
+type Config struct {
+	Sinks []Sink `yaml:"sinks"`
+}
+
+// Sink is an HTTP endpoint that receives events as signed JSON POSTs.
+type Sink struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret keys the HMAC-SHA256 signature of the body. SecretEnv names
+	// an environment variable to read it from instead, so the file can live
+	// in a ConfigMap.
+	Secret    string `yaml:"secret"`
+	SecretEnv string `yaml:"secret_env"`
+	// Events limits the sink to these event types; empty means all.
+	Events []EventType `yaml:"events"`
+	// MaxAttempts is the number of delivery attempts before the event is
+	// dead-lettered.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// Parse decodes and validates a notification document and resolves
+// secret_env.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing notifications: %w", err)
+	}
+	for i := range c.Sinks {
+		s := &c.Sinks[i]
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("sink-%d", i+1)
+		}
+		if s.MaxAttempts == 0 {
+			s.MaxAttempts = defaultMaxAttempts
+		}
+		if s.SecretEnv != "" {
+			s.Secret = os.Getenv(s.SecretEnv)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Load reads and validates a notification file.
+func Load(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading notifications: %w", err)
+	}
+	return Parse(data)
+}
+
+// Validate checks that every sink has a unique name, an http(s) URL, a
+// secret and known event types.
+func (c *Config) Validate() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, s := range c.Sinks {
+		if seen[s.Name] {
+			errs = append(errs, fmt.Errorf("sink %s: duplicate name", s.Name))
+		}
+		seen[s.Name] = true
+
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("sink %s: url must be an http or https URL", s.Name))
+		}
+		if s.Secret == "" {
+			errs = append(errs, fmt.Errorf("sink %s: secret must be set", s.Name))
+		}
+		for _, t := range s.Events {
+			if !slices.Contains(EventTypes, t) {
+				errs = append(errs, fmt.Errorf("sink %s: unknown event type %q", s.Name, t))
+			}
+		}
+		if s.MaxAttempts < 1 {
+			errs = append(errs, fmt.Errorf("sink %s: max_attempts must be at least 1", s.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wants reports whether the sink subscribes to t.
+func (s Sink) wants(t EventType) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, t)
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("PR_BOT_SECRET", "from-env")
+	c, err := Parse([]byte(`
+sinks:
+  - name: pr-bot
+    url: https://bot.example.com/hooks/ephemeron
+    secret_env: PR_BOT_SECRET
+    events: [tracked, reaped]
+  - url: http://preview-controller.default.svc/events
+    secret: inline
+    max_attempts: 10
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Sinks) != 2 {
+		t.Fatalf("expected 2 sinks, got %d", len(c.Sinks))
+	}
+
+	bot, controller := c.Sinks[0], c.Sinks[1]
+	if bot.Secret != "from-env" {
+		t.Errorf("expected secret from environment, got %q", bot.Secret)
+	}
+	if bot.MaxAttempts != defaultMaxAttempts {
+		t.Errorf("expected default max_attempts, got %d", bot.MaxAttempts)
+	}
+	if !bot.wants(EventReaped) || bot.wants(EventOverwritten) {
+		t.Errorf("unexpected event filter: %v", bot.Events)
+	}
+	if controller.Name != "sink-2" || controller.MaxAttempts != 10 || !controller.wants(EventFailed) {
+		t.Errorf("unexpected defaults: %+v", controller)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			"missing secret",
+			"sinks:\n  - url: https://example.com\n",
+			"secret must be set",
+		},
+		{
+			"secret_env unset",
+			"sinks:\n  - url: https://example.com\n    secret_env: EPHEMERON_TEST_UNSET\n",
+			"secret must be set",
+		},
+		{
+			"bad url",
+			"sinks:\n  - url: example.com/hook\n    secret: s\n",
+			"url must be an http or https URL",
+		},
+		{
+			"unknown event",
+			"sinks:\n  - url: https://example.com\n    secret: s\n    events: [pushed]\n",
+			`unknown event type "pushed"`,
+		},
+		{
+			"duplicate name",
+			"sinks:\n  - {name: a, url: https://a.example.com, secret: s}\n  - {name: a, url: https://b.example.com, secret: s}\n",
+			"duplicate name",
+		},
+		{
+			"unknown field",
+			"sinks:\n  - url: https://example.com\n    secret: s\n    retries: 3\n",
+			"parsing notifications",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+)
+
+// Headers sent with every notification.
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the sink secret.
+	SignatureHeader = "X-Ephemeron-Signature"
+	EventHeader     = "X-Ephemeron-Event"
+	// DeliveryHeader carries the event ID, which stays the same across
+	// retries so receivers can deduplicate.
+	DeliveryHeader = "X-Ephemeron-Delivery"
+)
+
+const (
+	defaultQueueSize  = 1000
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+
+	// deadLetterTimeout bounds writing a dead letter, which may happen
+	// after the dispatcher context was cancelled.
+	deadLetterTimeout = 5 * time.Second
+)
+
+// DeadLetterStore persists notifications that exhausted their attempts.
+type DeadLetterStore interface {
+	AddDeadLetter(ctx context.Context, record []byte) error
+}
+
+// DeadLetter is the record stored for an undeliverable notification.
+type DeadLetter struct {
+	Sink     string          `json:"sink"`
+	URL      string          `json:"url"`
+	Event    json.RawMessage `json:"event"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// delivery is an encoded event queued for one sink.
+type delivery struct {
+	id   string
+	typ  EventType
+	body []byte
+}
+
+type worker struct {
+	Sink
+	queue chan delivery
+}
+
+// Dispatcher fans events out to sinks. Each sink has its own bounded queue
+// and worker, so a slow or failing sink neither blocks the caller nor delays
+// the other sinks.
+type Dispatcher struct {
+	workers     []*worker
+	deadLetters DeadLetterStore
+	logger      *slog.Logger
+	httpClient  *http.Client
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	queueSize   int
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Option configures a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithBackoff sets the delay before the first retry, doubled for every
+// further attempt up to maxDelay.
+func WithBackoff(initial, maxDelay time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff, d.maxBackoff = initial, maxDelay
+	}
+}
+
+// WithQueueSize sets how many events may wait per sink before new ones are
+// dropped.
+func WithQueueSize(n int) Option {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.queueSize = n
+		}
+	}
+}
+
+// New creates a dispatcher for the sinks in cfg. Call Start to begin
+// delivering and Close to drain.
+func New(cfg *Config, deadLetters DeadLetterStore, logger *slog.Logger, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		deadLetters: deadLetters,
+		logger:      logger,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		backoff:     defaultBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		queueSize:   defaultQueueSize,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	for _, s := range cfg.Sinks {
+		if s.MaxAttempts < 1 {
+			s.MaxAttempts = defaultMaxAttempts
+		}
+		d.workers = append(d.workers, &worker{Sink: s, queue: make(chan delivery, d.queueSize)})
+	}
+	return d
+}
+
+// Start runs one delivery worker per sink. Once ctx is cancelled, queued
+// events are dead-lettered instead of delivered.
+func (d *Dispatcher) Start(ctx context.Context) {
+	for _, w := range d.workers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for dl := range w.queue {
+				d.deliver(ctx, w, dl)
+			}
+		}()
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are
+// delivered or dead-lettered. It is safe to call on a nil Dispatcher.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, w := range d.workers {
+			close(w.queue)
+		}
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// Emit queues e for every sink subscribed to its type and returns
+// immediately. When a sink's queue is full the event is dropped for that
+// sink. It is safe to call on a nil Dispatcher, which discards the event.
+func (d *Dispatcher) Emit(e Event) {
+	if d == nil {
+		return
+	}
+
+	e.Version = SchemaVersion
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Repository == "" {
+		e.Repository, e.Tag, _ = strings.Cut(e.Image, ":")
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		d.logger.Error("failed to encode notification", "type", e.Type, "image", e.Image, "error", err)
+		return
+	}
+	dl := delivery{id: e.ID, typ: e.Type, body: body}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, w := range d.workers {
+		if !w.wants(e.Type) {
+			continue
+		}
+		select {
+		case w.queue <- dl:
+		default:
+			metrics.NotificationsTotal.WithLabelValues(w.Name, "dropped").Inc()
+			d.logger.Warn("notification queue full, dropping event",
+				"sink", w.Name,
+				"type", e.Type,
+				"image", e.Image,
+			)
+		}
+	}
+}
+
+// deliver posts dl to the sink, retrying with exponential backoff, and
+// dead-letters it once the attempts are exhausted.
+func (d *Dispatcher) deliver(ctx context.Context, w *worker, dl delivery) {
+	var err error
+	attempt := 0
+	for attempt < w.MaxAttempts {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("not delivered before shutdown: %w", ctx.Err())
+			break
+		}
+		attempt++
+
+		var retry bool
+		retry, err = d.post(ctx, w.Sink, dl)
+		if err == nil {
+			metrics.NotificationsTotal.WithLabelValues(w.Name, "delivered").Inc()
+			return
+		}
+		if !retry || attempt == w.MaxAttempts {
+			break
+		}
+
+		metrics.NotificationRetries.WithLabelValues(w.Name).Inc()
+		delay := min(d.backoff<<(attempt-1), d.maxBackoff)
+		d.logger.Debug("notification failed, retrying",
+			"sink", w.Name,
+			"id", dl.id,
+			"attempt", attempt,
+			"delay", delay,
+			"error", err,
+		)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+
+	d.deadLetter(ctx, w.Sink, dl, attempt, err)
+}
+
+// post sends one attempt. It reports whether a failure is worth retrying:
+// client errors other than 408 and 429 are not.
+func (d *Dispatcher) post(ctx context.Context, s Sink, dl delivery) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ephemeron")
+	req.Header.Set(EventHeader, string(dl.typ))
+	req.Header.Set(DeliveryHeader, dl.id)
+	req.Header.Set(SignatureHeader, Sign(s.Secret, dl.body))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("sink returned %d", resp.StatusCode)
+}
+
+func (d *Dispatcher) deadLetter(ctx context.Context, s Sink, dl delivery, attempts int, cause error) {
+	metrics.NotificationsTotal.WithLabelValues(s.Name, "dead_lettered").Inc()
+	d.logger.Error("notification undeliverable, dead-lettering",
+		"sink", s.Name,
+		"id", dl.id,
+		"type", dl.typ,
+		"attempts", attempts,
+		"error", cause,
+	)
+	if d.deadLetters == nil {
+		return
+	}
+
+	record, err := json.Marshal(DeadLetter{
+		Sink:     s.Name,
+		URL:      s.URL,
+		Event:    dl.body,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		d.logger.Error("failed to encode dead letter", "sink", s.Name, "id", dl.id, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deadLetterTimeout)
+	defer cancel()
+	if err := d.deadLetters.AddDeadLetter(ctx, record); err != nil {
+		d.logger.Error("failed to store dead letter", "sink", s.Name, "id", dl.id, "error", err)
+	}
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockDeadLetters struct {
+	mu      sync.Mutex
+	records []DeadLetter
+}
+
+func (m *mockDeadLetters) AddDeadLetter(_ context.Context, record []byte) error {
+	var dl DeadLetter
+	if err := json.Unmarshal(record, &dl); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, dl)
+	return nil
+}
+
+// newTestDispatcher starts a dispatcher with a single sink and millisecond
+// backoff.
+func newTestDispatcher(t *testing.T, sink Sink, dead *mockDeadLetters) *Dispatcher {
+	t.Helper()
+	d := New(&Config{Sinks: []Sink{sink}}, dead, slog.Default(), WithBackoff(time.Millisecond, 5*time.Millisecond))
+	d.Start(t.Context())
+	return d
+}
+
+func TestDispatcher_DeliversSignedEvent(t *testing.T) {
+	var got []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(t, Sink{Name: "bot", URL: srv.URL, Secret: "s3cret", MaxAttempts: 1}, &mockDeadLetters{})
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	d.Emit(Event{
+		Type:      EventTracked,
+		Image:     "myapp:1h",
+		Digest:    "sha256:abc",
+		SizeBytes: 1024,
+		TTL:       "1h0m0s",
+		ExpiresAt: expires,
+		Reason:    "push",
+	})
+	d.Close()
+
+	if want := Sign("s3cret", got); header.Get(SignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", header.Get(SignatureHeader), want)
+	}
+	if header.Get(EventHeader) != "tracked" {
+		t.Errorf("event header = %q, want tracked", header.Get(EventHeader))
+	}
+
+	var e Event
+	if err := json.Unmarshal(got, &e); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if e.Version != SchemaVersion || e.ID == "" || e.ID != header.Get(DeliveryHeader) {
+		t.Errorf("unexpected envelope: version %d, id %q, delivery %q", e.Version, e.ID, header.Get(DeliveryHeader))
+	}
+	if e.Repository != "myapp" || e.Tag != "1h" || e.Digest != "sha256:abc" || e.SizeBytes != 1024 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if !e.ExpiresAt.Equal(expires) || e.TTL != "1h0m0s" || e.Reason != "push" {
+		t.Errorf("unexpected expiry fields: %+v", e)
+	}
+}
+
+func TestDispatcher_FiltersEventTypes(t *testing.T) {
+	var types []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		types = append(types, r.Header.Get(EventHeader))
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(t, Sink{
+		Name:        "bot",
+		URL:         srv.URL,
+		Secret:      "s",
+		Events:      []EventType{EventReaped},
+		MaxAttempts: 1,
+	}, &mockDeadLetters{})
+	d.Emit(Event{Type: EventTracked, Image: "myapp:1h"})
+	d.Emit(Event{Type: EventReaped, Image: "myapp:1h", Reason: "ttl"})
+	d.Close()
+
+	if len(types) != 1 || types[0] != "reaped" {
+		t.Errorf("delivered %v, want only reaped", types)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int32
+	}{
+		{"server error is retried", http.StatusBadGateway, 3},
+		{"rate limit is retried", http.StatusTooManyRequests, 3},
+		{"client error is not retried", http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			dead := &mockDeadLetters{}
+			d := newTestDispatcher(t, Sink{Name: "bot", URL: srv.URL, Secret: "s", MaxAttempts: 3}, dead)
+			d.Emit(Event{Type: EventReaped, Image: "myapp:1h"})
+			d.Close()
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if len(dead.records) != 1 {
+				t.Fatalf("expected 1 dead letter, got %d", len(dead.records))
+			}
+			rec := dead.records[0]
+			if rec.Sink != "bot" || int32(rec.Attempts) != tt.wantAttempts || rec.Error == "" {
+				t.Errorf("unexpected dead letter: %+v", rec)
+			}
+			var e Event
+			if err := json.Unmarshal(rec.Event, &e); err != nil || e.Image != "myapp:1h" {
+				t.Errorf("dead letter does not carry the event: %s", rec.Event)
+			}
+		})
+	}
+}
+
+func TestDispatcher_RecoversAfterRetry(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	dead := &mockDeadLetters{}
+	d := newTestDispatcher(t, Sink{Name: "bot", URL: srv.URL, Secret: "s", MaxAttempts: 3}, dead)
+	d.Emit(Event{Type: EventReaped, Image: "myapp:1h"})
+	d.Close()
+
+	if attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", attempts.Load())
+	}
+	if len(dead.records) != 0 {
+		t.Errorf("expected no dead letters, got %+v", dead.records)
+	}
+}
+
+func TestDispatcher_EmitDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	d := New(&Config{Sinks: []Sink{{Name: "slow", URL: srv.URL, Secret: "s", MaxAttempts: 1}}},
+		&mockDeadLetters{}, slog.Default(), WithQueueSize(1))
+	d.Start(t.Context())
+
+	done := make(chan struct{})
+	go func() {
+		for range 10 {
+			d.Emit(Event{Type: EventTracked, Image: "myapp:1h"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Emit blocked on a slow sink")
+	}
+	close(release)
+	d.Close()
+}
+
+func TestDispatcher_NilIsNoop(t *testing.T) {
+	var d *Dispatcher
+	d.Emit(Event{Type: EventTracked, Image: "myapp:1h"})
+}
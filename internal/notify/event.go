@@ -0,0 +1,62 @@
+// Package notify delivers image lifecycle events to outbound HTTP sinks.
+package notify
+
+import (
+	"time"
+)
+
+// EventType identifies what happened to an image.
+type EventType string
+
+const (
+	// EventTracked is sent when a push starts or refreshes tracking.
+	EventTracked EventType = "tracked"
+	// EventOverwritten is sent when a push moves a tracked tag to a
+	// different digest. If the tag is immutable, Reason is "rejected",
+	// "rolled_back" or "rollback_failed" depending on IMMUTABILITY_MODE and
+	// the outcome.
+	EventOverwritten EventType = "overwritten"
+	// EventReaped is sent after the reaper deleted an image. Reason is the
+	// reap reason: ttl, count, budget or manual.
+	EventReaped EventType = "reaped"
+	// EventFailed is sent when the reaper failed to delete an image. Unless
+	// the deletion was manual, the image is retried after REAP_RETRY_BACKOFF,
+	// doubled per failure, and dead-lettered after REAP_MAX_FAILURES failures
+	// until it is retried by hand.
+	EventFailed EventType = "failed"
+	// EventExpiring is sent once per expiry when an image enters the
+	// EXPIRY_WARNING window.
+	EventExpiring EventType = "expiring"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []EventType{EventTracked, EventOverwritten, EventReaped, EventFailed, EventExpiring}
+
+// SchemaVersion is bumped on incompatible changes to Event.
+const SchemaVersion = 1
+
+// Event is the JSON body of a notification. Fields are only ever added
+// within a schema version.
+type Event struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Image      string    `json:"image"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest,omitempty"`
+	// PreviousDigest is the digest the tag pointed at before an overwrite.
+	PreviousDigest string `json:"previous_digest,omitempty"`
+	SizeBytes      int64  `json:"size_bytes"`
+	// TTL is the lifetime the image was tracked with, as a Go duration.
+	// Only set for tracked events.
+	TTL       string    `json:"ttl,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Reason    string    `json:"reason,omitempty"`
+	// Error describes why a reap failed.
+	Error string `json:"error,omitempty"`
+	// ExtendURL is a signed link that extends the image. Only set for
+	// expiring events when extend links are enabled.
+	ExtendURL string `json:"extend_url,omitempty"`
+}
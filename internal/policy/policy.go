@@ -0,0 +1,221 @@
+// Package policy implements per-repository TTL and immutability rules loaded
+// from a YAML policy file.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Policy is an ordered list of rules. The first rule matching an image
+// applies; fields it leaves unset fall back to the global configuration.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule matches images by repository and tag globs and overrides their
+// lifetime and immutability.
+type Rule struct {
+	// Name identifies the rule in logs. Defaults to its position.
+	Name string `yaml:"name"`
+	// Repository and Tag are path.Match globs. Empty matches everything.
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag"`
+
+	DefaultTTL Duration `yaml:"default_ttl"`
+	MaxTTL     Duration `yaml:"max_ttl"`
+	MinTTL     Duration `yaml:"min_ttl"`
+	// Immutable, when set, replaces IMMUTABLE_TAG_PATTERNS for matching tags.
+	Immutable *bool `yaml:"immutable"`
+	// NeverReap exempts matching images from expiry.
+	NeverReap bool `yaml:"never_reap"`
+	// KeepLast keeps only the newest N matching tags per repository; older
+	// ones are reaped whatever TTL they have left. Zero disables it.
+	KeepLast int `yaml:"keep_last"`
+}
+
+// Duration is a time.Duration that also accepts day and week suffixes
+// ("7d", "2w") in the policy file.
+type Duration time.Duration
+
+var longDurationPattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// UnmarshalYAML parses a duration string.
+func (d *Duration) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if m := longDurationPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := 24 * time.Hour
+		if m[2] == "w" {
+			unit *= 7
+		}
+		*d = Duration(time.Duration(n) * unit)
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Parse decodes and validates a policy document.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	for i := range p.Rules {
+		if p.Rules[i].Name == "" {
+			p.Rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Load reads and validates a policy file.
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy: %w", err)
+	}
+	return Parse(data)
+}
+
+// Validate checks that every rule has valid globs and consistent TTLs.
+func (p *Policy) Validate() error {
+	var errs []error
+	for _, r := range p.Rules {
+		if _, err := path.Match(r.Repository, ""); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: invalid repository pattern %q", r.Name, r.Repository))
+		}
+		if _, err := path.Match(r.Tag, ""); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: invalid tag pattern %q", r.Name, r.Tag))
+		}
+		if r.DefaultTTL < 0 || r.MaxTTL < 0 || r.MinTTL < 0 {
+			errs = append(errs, fmt.Errorf("rule %s: TTLs must not be negative", r.Name))
+		}
+		if r.KeepLast < 0 {
+			errs = append(errs, fmt.Errorf("rule %s: keep_last must not be negative", r.Name))
+		}
+		if r.MaxTTL > 0 && r.MinTTL > r.MaxTTL {
+			errs = append(errs, fmt.Errorf("rule %s: min_ttl exceeds max_ttl", r.Name))
+		}
+		if r.MaxTTL > 0 && r.DefaultTTL > r.MaxTTL {
+			errs = append(errs, fmt.Errorf("rule %s: default_ttl exceeds max_ttl", r.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the first rule matching repo and tag, or nil. It is safe to
+// call on a nil Policy.
+func (p *Policy) Match(repo, tag string) *Rule {
+	if p == nil {
+		return nil
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if matches(r.Repository, repo) && matches(r.Tag, tag) {
+			return r
+		}
+	}
+	return nil
+}
+
+// HasRetention reports whether any rule sets keep_last. It is safe to call
+// on a nil Policy.
+func (p *Policy) HasRetention() bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if r.KeepLast > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRetentionIn reports whether a keep_last rule may apply to tags of repo.
+// It is safe to call on a nil Policy.
+func (p *Policy) HasRetentionIn(repo string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if r.KeepLast > 0 && matches(r.Repository, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// Defaults are the global settings that rules override.
+type Defaults struct {
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+// Effective is the outcome of the policy for one image, with fields the
+// matching rule leaves unset filled from the global defaults.
+type Effective struct {
+	// Rule is the name of the matching rule, empty if none matched.
+	Rule       string
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	MinTTL     time.Duration
+	// Immutable is nil when the global tag patterns decide.
+	Immutable *bool
+	NeverReap bool
+}
+
+// Resolve returns the effective settings for repo:tag. It is safe to call on
+// a nil Policy.
+func (p *Policy) Resolve(repo, tag string, defaults Defaults) Effective {
+	eff := Effective{DefaultTTL: defaults.DefaultTTL, MaxTTL: defaults.MaxTTL}
+	r := p.Match(repo, tag)
+	if r == nil {
+		return eff
+	}
+
+	eff.Rule = r.Name
+	if r.MaxTTL > 0 {
+		eff.MaxTTL = time.Duration(r.MaxTTL)
+	}
+	if r.DefaultTTL > 0 {
+		eff.DefaultTTL = time.Duration(r.DefaultTTL)
+	}
+	eff.DefaultTTL = min(eff.DefaultTTL, eff.MaxTTL)
+	eff.MinTTL = min(time.Duration(r.MinTTL), eff.MaxTTL)
+	eff.Immutable = r.Immutable
+	eff.NeverReap = r.NeverReap
+	return eff
+}
+
+// Bound raises ttl to MinTTL and caps it at MaxTTL.
+func (e Effective) Bound(ttl time.Duration) time.Duration {
+	return min(max(ttl, e.MinTTL), e.MaxTTL)
+}
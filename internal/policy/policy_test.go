@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+rules:
+  - name: release
+    repository: "release/*"
+    immutable: true
+    never_reap: true
+  - name: ci
+    repository: "ci/*"
+    default_ttl: 30m
+    max_ttl: 2h
+  - name: staging
+    repository: "staging/*"
+    max_ttl: 7d
+    min_ttl: 1h
+  - repository: "*"
+    tag: "nightly-*"
+    default_ttl: 1d
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Rules) != 4 {
+		t.Fatalf("expected 4 rules, got %d", len(p.Rules))
+	}
+	if p.Rules[3].Name != "rule-4" {
+		t.Errorf("expected unnamed rule to be named by position, got %q", p.Rules[3].Name)
+	}
+	if time.Duration(p.Rules[2].MaxTTL) != 7*24*time.Hour {
+		t.Errorf("expected 7d max_ttl, got %v", time.Duration(p.Rules[2].MaxTTL))
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"bad repository glob", "rules:\n  - repository: \"[\"\n"},
+		{"bad duration", "rules:\n  - default_ttl: soon\n"},
+		{"min exceeds max", "rules:\n  - min_ttl: 2h\n    max_ttl: 1h\n"},
+		{"default exceeds max", "rules:\n  - default_ttl: 2h\n    max_ttl: 1h\n"},
+		{"unknown field", "rules:\n  - repo: \"ci/*\"\n"},
+		{"negative keep_last", "rules:\n  - keep_last: -1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.policy)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defaults := Defaults{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour}
+
+	tests := []struct {
+		repo, tag     string
+		wantRule      string
+		wantDefault   time.Duration
+		wantMax       time.Duration
+		wantMin       time.Duration
+		wantImmutable bool
+		wantNeverReap bool
+	}{
+		{"release/api", "v1", "release", time.Hour, 24 * time.Hour, 0, true, true},
+		{"ci/frontend", "1h", "ci", 30 * time.Minute, 2 * time.Hour, 0, false, false},
+		{"staging/api", "latest", "staging", time.Hour, 7 * 24 * time.Hour, time.Hour, false, false},
+		{"myapp", "nightly-42", "rule-4", 24 * time.Hour, 24 * time.Hour, 0, false, false},
+		{"myapp", "1h", "", time.Hour, 24 * time.Hour, 0, false, false},
+		// "*" does not cross "/", so nested repositories need their own rule.
+		{"team/app", "nightly-1", "", time.Hour, 24 * time.Hour, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo+":"+tt.tag, func(t *testing.T) {
+			eff := p.Resolve(tt.repo, tt.tag, defaults)
+			if eff.Rule != tt.wantRule {
+				t.Errorf("rule = %q, want %q", eff.Rule, tt.wantRule)
+			}
+			if eff.DefaultTTL != tt.wantDefault || eff.MaxTTL != tt.wantMax || eff.MinTTL != tt.wantMin {
+				t.Errorf("ttls = (%v, %v, %v), want (%v, %v, %v)",
+					eff.DefaultTTL, eff.MaxTTL, eff.MinTTL, tt.wantDefault, tt.wantMax, tt.wantMin)
+			}
+			if (eff.Immutable != nil && *eff.Immutable) != tt.wantImmutable {
+				t.Errorf("immutable = %v, want %v", eff.Immutable, tt.wantImmutable)
+			}
+			if eff.NeverReap != tt.wantNeverReap {
+				t.Errorf("never_reap = %v, want %v", eff.NeverReap, tt.wantNeverReap)
+			}
+		})
+	}
+}
+
+func TestResolve_NilPolicy(t *testing.T) {
+	var p *Policy
+	eff := p.Resolve("myapp", "1h", Defaults{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour})
+	if eff.Rule != "" || eff.DefaultTTL != time.Hour || eff.MaxTTL != 24*time.Hour {
+		t.Fatalf("expected global defaults, got %+v", eff)
+	}
+}
+
+func TestHasRetentionIn(t *testing.T) {
+	p, err := Parse([]byte("rules:\n  - repository: \"ci/*\"\n    tag: \"pr-*\"\n    keep_last: 3\n  - repository: \"staging/*\"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for repo, want := range map[string]bool{"ci/app": true, "staging/app": false, "myapp": false} {
+		if got := p.HasRetentionIn(repo); got != want {
+			t.Errorf("HasRetentionIn(%q) = %v, want %v", repo, got, want)
+		}
+	}
+	if (*Policy)(nil).HasRetentionIn("ci/app") {
+		t.Error("expected no retention without a policy")
+	}
+}
+
+func TestEffective_Bound(t *testing.T) {
+	eff := Effective{MinTTL: time.Hour, MaxTTL: 4 * time.Hour}
+
+	if got := eff.Bound(10 * time.Minute); got != time.Hour {
+		t.Errorf("expected min to apply, got %v", got)
+	}
+	if got := eff.Bound(2 * time.Hour); got != 2*time.Hour {
+		t.Errorf("expected ttl unchanged, got %v", got)
+	}
+	if got := eff.Bound(8 * time.Hour); got != 4*time.Hour {
+		t.Errorf("expected max to apply, got %v", got)
+	}
+}
+
+func TestSource_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - name: first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewSource(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src.Policy().Rules[0].Name != "first" {
+		t.Fatalf("expected first policy, got %+v", src.Policy())
+	}
+
+	if err := os.WriteFile(file, []byte("rules:\n  - repository: \"[\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Reload(); err == nil {
+		t.Fatal("expected invalid policy to be rejected")
+	}
+	if src.Policy().Rules[0].Name != "first" {
+		t.Fatal("expected previous policy to stay active after a failed reload")
+	}
+
+	if err := os.WriteFile(file, []byte("rules:\n  - name: second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src.Policy().Rules[0].Name != "second" {
+		t.Fatalf("expected reloaded policy, got %+v", src.Policy())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger writing from another
+// goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) count(s string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Count(b.buf.String(), s)
+}
+
+func TestSource_WatchLogsFailedReloadOnce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - name: first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewSource(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var logs syncBuffer
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		src.Watch(ctx, 5*time.Millisecond, slog.New(slog.NewTextHandler(&logs, nil)))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	broken := func(modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte("rules:\n  - repository: \"[\"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for logs.count("failed to reload policy") < n && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		// Let several more checks run to catch repeated logging.
+		time.Sleep(50 * time.Millisecond)
+		if got := logs.count("failed to reload policy"); got != n {
+			t.Fatalf("expected %d failed reload logs, got %d", n, got)
+		}
+	}
+
+	broken(time.Now().Add(time.Minute))
+	waitFor(1)
+
+	// A new broken version is reported again.
+	broken(time.Now().Add(2 * time.Minute))
+	waitFor(2)
+
+	if src.Policy().Rules[0].Name != "first" {
+		t.Fatal("expected previous policy to stay active")
+	}
+}
+
+func TestSource_NoFile(t *testing.T) {
+	src, err := NewSource("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src.Policy() != nil {
+		t.Fatal("expected no policy without a file")
+	}
+
+	var nilSrc *Source
+	if nilSrc.Policy() != nil {
+		t.Fatal("expected nil source to have no policy")
+	}
+}
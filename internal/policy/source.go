@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Source holds the active policy and swaps it atomically on reload, so
+// readers never see a partially applied file.
+type Source struct {
+	file    string
+	current atomic.Pointer[Policy]
+	modTime time.Time
+}
+
+// NewSource loads the policy file. An empty path yields a Source without
+// rules.
+func NewSource(file string) (*Source, error) {
+	s := &Source{file: file}
+	if file == "" {
+		return s, nil
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Policy returns the active policy. It is safe to call on a nil Source and
+// returns nil when no policy file is configured.
+func (s *Source) Policy() *Policy {
+	if s == nil {
+		return nil
+	}
+	return s.current.Load()
+}
+
+// Reload reads the policy file again. On error the previous policy stays
+// active.
+func (s *Source) Reload() error {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	p, err := Load(s.file)
+	if err != nil {
+		return err
+	}
+	s.current.Store(p)
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the policy on SIGHUP and whenever the file's modification
+// time changes, checked every interval. A file that fails to load is logged
+// once, not on every check, until it changes again. It blocks until the
+// context is cancelled.
+func (s *Source) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if s.file == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failedModTime time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			info, err := os.Stat(s.file)
+			if err != nil || info.ModTime().Equal(s.modTime) || info.ModTime().Equal(failedModTime) {
+				continue
+			}
+		}
+
+		// Stat before loading, so a change made during the load is picked
+		// up by the next check.
+		info, statErr := os.Stat(s.file)
+		if err := s.Reload(); err != nil {
+			if statErr == nil {
+				failedModTime = info.ModTime()
+			}
+			logger.Error("failed to reload policy, keeping previous rules", "file", s.file, "error", err)
+			continue
+		}
+		failedModTime = time.Time{}
+		logger.Info("reloaded policy", "file", s.file, "rules", len(s.Policy().Rules))
+	}
+}
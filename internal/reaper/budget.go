@@ -0,0 +1,180 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+)
+
+// Budget caps the bytes tracked for repositories starting with Prefix. An
+// empty Prefix is the global budget.
+type Budget struct {
+	Prefix   string
+	MaxBytes int64
+}
+
+// name labels a budget in logs and metrics.
+func (b Budget) name() string {
+	if b.Prefix == "" {
+		return "global"
+	}
+	return b.Prefix
+}
+
+// EvictionOrder selects which images are evicted first when a budget is
+// exceeded.
+type EvictionOrder string
+
+const (
+	// EvictSoonestExpiry evicts the images closest to expiry first.
+	EvictSoonestExpiry EvictionOrder = "expiry"
+	// EvictOldestPush evicts the least recently pushed images first.
+	EvictOldestPush EvictionOrder = "created"
+)
+
+// defaultLowWatermark is the fraction of a budget that eviction brings usage
+// back down to, so a budget is not exceeded again by the next push.
+const defaultLowWatermark = 0.9
+
+// WithStorageBudgets enables eviction of images before their expiry when the
+// tracked bytes exceed a budget. Eviction continues until usage is at or
+// below lowWatermark (a fraction of the budget).
+func WithStorageBudgets(budgets []Budget, lowWatermark float64, order EvictionOrder) Option {
+	return func(r *Reaper) {
+		r.budgets = budgets
+		if lowWatermark > 0 && lowWatermark <= 1 {
+			r.lowWatermark = lowWatermark
+		}
+		if order != "" {
+			r.evictionOrder = order
+		}
+	}
+}
+
+// enforceBudgets evicts images from every budget that is over its limit.
+// Prefix budgets are enforced before the global one, since evicting within a
+// prefix also lowers global usage.
+func (r *Reaper) enforceBudgets(ctx context.Context, c *cycle) error {
+	var global []Budget
+	for _, b := range r.budgets {
+		if b.Prefix == "" {
+			global = append(global, b)
+			continue
+		}
+		if err := r.enforceBudget(ctx, c, b); err != nil {
+			return err
+		}
+	}
+	for _, b := range global {
+		if err := r.enforceBudget(ctx, c, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforceBudget evicts images matching the budget, in the configured order,
+// until usage is back under the low watermark, no candidates remain or the
+// cycle runs out of deletions or time.
+func (r *Reaper) enforceBudget(ctx context.Context, c *cycle, b Budget) error {
+	usage, err := r.budgetUsage(ctx, b)
+	if err != nil {
+		return fmt.Errorf("reading storage usage: %w", err)
+	}
+	if usage <= b.MaxBytes {
+		return nil
+	}
+
+	target := int64(float64(b.MaxBytes) * r.lowWatermark)
+	r.logger.Warn("storage budget exceeded, evicting images",
+		"budget", b.name(),
+		"usage_bytes", usage,
+		"limit_bytes", b.MaxBytes,
+		"target_bytes", target,
+		"order", string(r.evictionOrder),
+	)
+
+	// Evicted images leave the index, so the offset only skips images
+	// that were passed over or failed.
+	var offset int64
+	now := time.Now()
+	for usage > target {
+		batch, err := r.listForEviction(ctx, offset, r.batchSize)
+		if err != nil {
+			return fmt.Errorf("listing images for eviction: %w", err)
+		}
+
+		for _, image := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if usage <= target {
+				break
+			}
+			if !strings.HasPrefix(image, b.Prefix) || r.exempt(image) || r.isPinned(ctx, image, now) || r.isDeferred(ctx, image, now) {
+				offset++
+				continue
+			}
+			if !c.take() {
+				break
+			}
+
+			sizeBytes, err := r.reapImage(ctx, image, ReasonBudget,
+				"budget", b.name(),
+				"limit_bytes", b.MaxBytes,
+			)
+			if err != nil {
+				if !errors.Is(err, errInvalidImage) {
+					offset++
+				}
+				continue
+			}
+			usage -= sizeBytes
+			metrics.ImagesEvicted.WithLabelValues(b.name()).Inc()
+			metrics.BytesEvicted.WithLabelValues(b.name()).Add(float64(sizeBytes))
+		}
+
+		if int64(len(batch)) < r.batchSize || c.limited() != "" {
+			break
+		}
+	}
+
+	if usage > target {
+		r.logger.Warn("storage budget still exceeded after eviction",
+			"budget", b.name(),
+			"usage_bytes", usage,
+			"limit_bytes", b.MaxBytes,
+		)
+	}
+	return nil
+}
+
+// budgetUsage returns the tracked bytes counted against a budget.
+func (r *Reaper) budgetUsage(ctx context.Context, b Budget) (int64, error) {
+	if b.Prefix == "" {
+		return r.redis.TrackedBytes(ctx)
+	}
+
+	repos, err := r.redis.RepoBytes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var usage int64
+	for repo, n := range repos {
+		if strings.HasPrefix(repo, b.Prefix) {
+			usage += n
+		}
+	}
+	return usage, nil
+}
+
+func (r *Reaper) listForEviction(ctx context.Context, offset, limit int64) ([]string, error) {
+	if r.evictionOrder == EvictOldestPush {
+		return r.redis.ListImagesByCreated(ctx, offset, limit)
+	}
+	return r.redis.ListImagesByExpiry(ctx, offset, limit)
+}
@@ -0,0 +1,123 @@
+package reaper
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// deletingRegistry accepts every manifest HEAD and DELETE.
+func deletingRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+// addImage tracks a live image with the given size, expiry and push time.
+func (m *mockStore) addImage(image string, size int64, expiresIn, pushedAgo time.Duration) {
+	now := time.Now()
+	m.images[image] = now.Add(expiresIn).UnixMilli()
+	m.sizes[image] = size
+	m.created[image] = now.Add(-pushedAgo).UnixMilli()
+}
+
+func remaining(m *mockStore) []string {
+	out, _ := m.ListImages(nil)
+	slices.Sort(out)
+	return out
+}
+
+func TestReapOnce_StorageBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		budgets []Budget
+		order   EvictionOrder
+		want    []string
+	}{
+		{
+			name:    "under budget",
+			budgets: []Budget{{MaxBytes: 1000}},
+			want:    []string{"a:1h", "b:2h", "c:3h", "ci/app:4h"},
+		},
+		{
+			name:    "soonest expiry first until low watermark",
+			budgets: []Budget{{MaxBytes: 600}},
+			// 800 tracked, target 540: evicting a and b leaves 400.
+			want: []string{"c:3h", "ci/app:4h"},
+		},
+		{
+			name:    "least recently pushed first",
+			budgets: []Budget{{MaxBytes: 700}},
+			order:   EvictOldestPush,
+			// 800 tracked, target 630: evicting c (pushed first) leaves 600.
+			want: []string{"a:1h", "b:2h", "ci/app:4h"},
+		},
+		{
+			name:    "prefix budget only evicts within prefix",
+			budgets: []Budget{{Prefix: "ci/", MaxBytes: 100}},
+			want:    []string{"a:1h", "b:2h", "c:3h"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			store.addImage("a:1h", 200, time.Hour, time.Hour)
+			store.addImage("b:2h", 200, 2*time.Hour, 2*time.Hour)
+			store.addImage("c:3h", 200, 3*time.Hour, 3*time.Hour)
+			store.addImage("ci/app:4h", 200, 4*time.Hour, time.Minute)
+
+			r := New(store, deletingRegistry(t).URL, slog.Default(), WithStorageBudgets(tt.budgets, 0.9, tt.order))
+			if err := r.ReapOnce(t.Context()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := remaining(store); !slices.Equal(got, tt.want) {
+				t.Errorf("remaining images = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReapOnce_StorageBudget_FailedEvictionsAreSkipped(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/a/manifests/1h" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.addImage("a:1h", 200, time.Hour, time.Hour)
+	store.addImage("b:2h", 200, 2*time.Hour, time.Hour)
+
+	r := New(store, reg.URL, slog.Default(), WithStorageBudgets([]Budget{{MaxBytes: 300}}, 0.9, EvictSoonestExpiry))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := remaining(store); !slices.Equal(got, []string{"a:1h"}) {
+		t.Errorf("expected eviction to move past the failed image, got %v", got)
+	}
+	if f := store.failures["a:1h"]; f.Failures != 1 {
+		t.Errorf("expected the failed eviction to be recorded, got %+v", f)
+	}
+}
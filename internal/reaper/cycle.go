@@ -0,0 +1,139 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+)
+
+const (
+	// defaultLockTTL is how long the reaper lock is held when cycles have no
+	// time limit.
+	defaultLockTTL = 5 * time.Minute
+
+	// lockMargin is added to the cycle time limit for the lock TTL, so that
+	// deletions in flight at the deadline finish under the lock.
+	lockMargin = time.Minute
+)
+
+// Limits that end a reap cycle early, used as the limit label of
+// ReaperCycleLimited.
+const (
+	limitDeletions = "deletions"
+	limitDuration  = "duration"
+)
+
+// cycle tracks the deletions and time left in one reap cycle. Expired,
+// retention and budget deletions all draw from it, so a backlog is worked
+// off over several cycles.
+type cycle struct {
+	mu       sync.Mutex
+	deadline time.Time // zero = no time limit
+	left     int       // deletions left; negative = no limit
+	limit    string    // the limit that ended the cycle, if any
+}
+
+// newCycle starts a cycle at start under the reaper's limits.
+func (r *Reaper) newCycle(start time.Time) *cycle {
+	c := &cycle{left: -1}
+	if r.maxDeletions > 0 {
+		c.left = r.maxDeletions
+	}
+	if r.maxDuration > 0 {
+		c.deadline = start.Add(r.maxDuration)
+	}
+	return c
+}
+
+// lockTTL returns the reaper lock TTL, which outlasts the cycle time limit.
+func (r *Reaper) lockTTL() time.Duration {
+	return max(defaultLockTTL, r.maxDuration+lockMargin)
+}
+
+// take reserves one deletion and reports whether the cycle may make it.
+func (c *cycle) take() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.limit != "" {
+		return false
+	}
+	switch {
+	case c.left == 0:
+		c.limit = limitDeletions
+	case !c.deadline.IsZero() && !time.Now().Before(c.deadline):
+		c.limit = limitDuration
+	default:
+		if c.left > 0 {
+			c.left--
+		}
+		return true
+	}
+	return false
+}
+
+// limited returns the limit that ended the cycle, empty if none did.
+func (c *cycle) limited() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// reapExpired deletes expired images with up to r.concurrency deletions in
+// flight, until the cycle runs out of deletions or time. It returns how many
+// deletions were attempted and how many of them failed, and how many invalid
+// entries were removed without an attempt.
+func (r *Reaper) reapExpired(ctx context.Context, c *cycle, images []string) (attempted, failed, invalid int) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		next = make(chan string)
+	)
+	for range min(r.concurrency, len(images)) {
+		wg.Go(func() {
+			for image := range next {
+				if ctx.Err() != nil || !c.take() {
+					continue
+				}
+				_, err := r.reapImage(ctx, image, ReasonTTL)
+				mu.Lock()
+				switch {
+				case errors.Is(err, errInvalidImage):
+					invalid++
+				case err != nil:
+					attempted++
+					failed++
+				default:
+					attempted++
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for _, image := range images {
+		if ctx.Err() != nil || c.limited() != "" {
+			break
+		}
+		next <- image
+	}
+	close(next)
+	wg.Wait()
+	return attempted, failed, invalid
+}
+
+// reportLimit logs and counts a cycle that ended at one of its limits.
+func (r *Reaper) reportLimit(c *cycle, start time.Time) {
+	limit := c.limited()
+	if limit == "" {
+		return
+	}
+	metrics.ReaperCycleLimited.WithLabelValues(limit).Inc()
+	r.logger.Warn("reap cycle limit reached, remaining images are reaped next cycle",
+		"limit", limit,
+		"max_deletions", r.maxDeletions,
+		"max_duration", r.maxDuration.String(),
+		"elapsed", time.Since(start).String(),
+	)
+}
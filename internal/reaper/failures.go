@@ -0,0 +1,88 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/metrics"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// WithRetryPolicy backs off from images that fail deletion, and moves them
+// to the dead-letter set after p.MaxFailures failures in a row. Without it,
+// failed images are retried every cycle.
+func WithRetryPolicy(p redisclient.RetryPolicy) Option {
+	return func(r *Reaper) {
+		r.retry = p
+	}
+}
+
+// recordFailure counts a failed deletion of img under the retry policy.
+// Manual deletions are reported to the caller instead, and deletions
+// cancelled with the cycle are not the image's fault.
+func (r *Reaper) recordFailure(ctx context.Context, img redisclient.Image, reason string, reapErr error) {
+	if reason == ReasonManual || ctx.Err() != nil {
+		return
+	}
+	f, err := r.redis.RecordReapFailure(ctx, img.Name, reapErr.Error(), time.Now(), r.retry)
+	if err != nil {
+		if !errors.Is(err, redisclient.ErrNotTracked) {
+			r.logger.Warn("failed to record deletion failure", "image", img.Name, "error", err)
+		}
+		return
+	}
+
+	if !f.DeadLettered {
+		if !f.RetryAt.IsZero() {
+			r.logger.Debug("backing off image after failed deletion",
+				"image", img.Name,
+				"failures", f.Failures,
+				"retry_at", f.RetryAt,
+			)
+		}
+		return
+	}
+	r.logger.Warn("moved image to dead-letter set after repeated deletion failures",
+		"image", img.Name,
+		"failures", f.Failures,
+		"error", reapErr,
+	)
+	r.history.Record(ctx, audit.Entry{
+		Action:    audit.ActionDeadLettered,
+		Image:     img.Name,
+		Digest:    img.Digest,
+		SizeBytes: img.SizeBytes,
+		ExpiresAt: img.Expires,
+		Actor:     audit.ActorReaper,
+		Reason:    fmt.Sprintf("%d failures", f.Failures),
+		Error:     reapErr.Error(),
+	})
+}
+
+// isDeferred reports whether the reaper backs off from the image at now
+// after failed deletions, or has dead-lettered it. When the state cannot
+// be read the image is attempted as before.
+func (r *Reaper) isDeferred(ctx context.Context, imageWithTag string, now time.Time) bool {
+	deferred, err := r.redis.IsReapDeferred(ctx, imageWithTag, now)
+	if err != nil {
+		r.logger.Warn("failed to read deletion failures", "image", imageWithTag, "error", err)
+		return false
+	}
+	return deferred
+}
+
+// reportDeadLetters updates the dead-letter gauge.
+func (r *Reaper) reportDeadLetters(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	n, err := r.redis.ReapDeadLetterCount(ctx)
+	if err != nil {
+		r.logger.Warn("failed to count dead-lettered images", "error", err)
+		return
+	}
+	metrics.ReaperDeadLetterImages.Set(float64(n))
+}
@@ -0,0 +1,142 @@
+package reaper
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// refusingRegistry rejects every DELETE like a registry with deletes
+// disabled, counting the attempts.
+func refusingRegistry(t *testing.T, deletes *atomic.Int32) *httptest.Server {
+	t.Helper()
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		deletes.Add(1)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+func TestReapOnce_BacksOffFailedImages(t *testing.T) {
+	var deletes atomic.Int32
+	store := newMockStore()
+	store.addImage("app:1h", 100, -time.Minute, time.Hour)
+
+	r := New(store, refusingRegistry(t, &deletes).URL, slog.Default(),
+		WithRetryPolicy(redisclient.RetryPolicy{Backoff: time.Minute, MaxBackoff: 90 * time.Second}))
+
+	for cycle, want := range []time.Duration{time.Minute, 90 * time.Second} {
+		before := time.Now()
+		if err := r.ReapOnce(t.Context()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := deletes.Load(); got != int32(cycle+1) {
+			t.Fatalf("cycle %d: expected %d delete attempts, got %d", cycle+1, cycle+1, got)
+		}
+		f := store.failures["app:1h"]
+		if f.Failures != int64(cycle+1) {
+			t.Errorf("cycle %d: failures = %d, want %d", cycle+1, f.Failures, cycle+1)
+		}
+		if backoff := f.RetryAt.Sub(before); backoff < want || backoff > want+time.Second {
+			t.Errorf("cycle %d: backoff = %s, want %s", cycle+1, backoff, want)
+		}
+
+		// Backing off: the next cycle leaves the image alone.
+		if err := r.ReapOnce(t.Context()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := deletes.Load(); got != int32(cycle+1) {
+			t.Errorf("cycle %d: expected no attempt while backing off, got %d attempts", cycle+1, got)
+		}
+
+		f.RetryAt = time.Now().Add(-time.Second)
+		store.failures["app:1h"] = f
+	}
+}
+
+func TestReapOnce_DeadLettersRepeatedFailures(t *testing.T) {
+	var deletes atomic.Int32
+	store := newMockStore()
+	store.addImage("app:1h", 100, -time.Minute, time.Hour)
+	store.addImage("app:2h", 100, time.Hour, time.Hour)
+
+	r := New(store, refusingRegistry(t, &deletes).URL, slog.Default(),
+		WithRetryPolicy(redisclient.RetryPolicy{MaxFailures: 3}))
+
+	for range 4 {
+		if err := r.ReapOnce(t.Context()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := deletes.Load(); got != 3 {
+		t.Errorf("expected 3 attempts before dead-lettering, got %d", got)
+	}
+	if dead, _ := store.ListReapDeadLetters(t.Context()); len(dead) != 1 || dead[0] != "app:1h" {
+		t.Fatalf("dead letters = %v, want [app:1h]", dead)
+	}
+	if len(store.images) != 2 {
+		t.Error("expected the dead-lettered image to stay tracked")
+	}
+
+	// A retry clears the failures, so the next cycle tries again.
+	if err := store.RetryReapDeadLetter(t.Context(), "app:1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := deletes.Load(); got != 4 {
+		t.Errorf("expected a new attempt after the retry, got %d attempts", got)
+	}
+}
+
+func TestReapOnce_ReadsSkippedImagesInBatches(t *testing.T) {
+	var deletes atomic.Int32
+	store := newMockStore()
+	for i := range 250 {
+		image := fmt.Sprintf("app:%d", i)
+		store.addImage(image, 100, -time.Minute, time.Hour)
+		store.failures[image] = redisclient.ReapFailure{Failures: 3, DeadLettered: true}
+	}
+
+	r := New(store, refusingRegistry(t, &deletes).URL, slog.Default(), WithBatchSize(100))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := deletes.Load(); got != 0 {
+		t.Errorf("expected dead-lettered images to be skipped, got %d attempts", got)
+	}
+	if store.singleChecks != 0 {
+		t.Errorf("expected no per-image pin or backoff lookups, got %d", store.singleChecks)
+	}
+	if store.stateReads > 3 {
+		t.Errorf("expected one state read per batch, got %d", store.stateReads)
+	}
+}
+
+func TestDeleteImage_FailureNotRecorded(t *testing.T) {
+	var deletes atomic.Int32
+	store := newMockStore()
+	store.addImage("app:1h", 100, time.Hour, time.Hour)
+
+	r := New(store, refusingRegistry(t, &deletes).URL, slog.Default(),
+		WithRetryPolicy(redisclient.RetryPolicy{Backoff: time.Hour, MaxFailures: 1}))
+	if err := r.DeleteImage(t.Context(), "app:1h"); err == nil {
+		t.Fatal("expected an error from the refusing registry")
+	}
+	if len(store.failures) != 0 {
+		t.Errorf("expected manual deletions not to count as failures, got %v", store.failures)
+	}
+}
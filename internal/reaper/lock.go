@@ -0,0 +1,186 @@
+package reaper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// ErrLockLost is returned by ReapOnce when the reaper lock expired or was
+// taken over by another replica during the cycle. The cycle stops at the
+// next image; work left over is picked up by the new holder.
+var ErrLockLost = errors.New("reaper lock lost")
+
+// Reasons a lease is lost, used as the reason label of ReaperLockLost.
+const (
+	lostTakenOver = "taken_over"
+	lostExpired   = "expired"
+)
+
+// lease is one hold of the reaper lock. It is renewed in the background
+// while the cycle runs, and cancels the cycle context when the lock is lost.
+type lease struct {
+	redis  redisclient.Store
+	logger *slog.Logger
+	owner  string
+	fence  int64
+	ttl    time.Duration
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	reason string // why the lease was lost; empty while held
+}
+
+// newOwner returns a lock owner token unique to this acquisition, prefixed
+// with the hostname so the holder can be identified in Redis.
+func newOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "reaper"
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// acquireLock takes the reaper lock. It returns a nil lease if another
+// replica holds it. The returned context is cancelled with ErrLockLost if the
+// lease is lost; the caller must release the lease when the cycle ends.
+func (r *Reaper) acquireLock(ctx context.Context) (*lease, context.Context, error) {
+	owner := newOwner()
+	ttl := r.lockTTL()
+	fence, err := r.redis.AcquireReaperLock(ctx, owner, ttl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquiring reaper lock: %w", err)
+	}
+	if fence == 0 {
+		metrics.ReaperLockAcquisitions.WithLabelValues("busy").Inc()
+		return nil, nil, nil
+	}
+	metrics.ReaperLockAcquisitions.WithLabelValues("acquired").Inc()
+	metrics.ReaperLockHeld.Set(1)
+	metrics.ReaperLockFence.Set(float64(fence))
+	r.logger.Debug("acquired reaper lock", "owner", owner, "fence", fence)
+
+	cctx, cancel := context.WithCancelCause(ctx)
+	l := &lease{
+		redis:  r.redis,
+		logger: r.logger,
+		owner:  owner,
+		fence:  fence,
+		ttl:    ttl,
+		cancel: cancel,
+	}
+	go l.keepAlive(cctx, ttl/3)
+	return l, cctx, nil
+}
+
+// keepAlive renews the lease every interval until ctx is done. The lease is
+// lost when another owner holds the lock, or when renewals keep failing
+// until the lock must have expired.
+func (l *lease) keepAlive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := l.redis.RenewReaperLock(ctx, l.owner, l.ttl)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(renewed) >= l.ttl {
+				l.lose(lostExpired)
+				return
+			}
+			l.logger.Warn("failed to renew reaper lock", "owner", l.owner, "error", err)
+		case !ok:
+			l.lose(lostTakenOver)
+			return
+		default:
+			renewed = time.Now()
+		}
+	}
+}
+
+// check compares the lease's fencing token with the latest one and loses
+// the lease if another replica acquired the lock since. It returns the
+// cause if the lease is lost.
+func (l *lease) check(ctx context.Context) error {
+	if err := l.err(); err != nil {
+		return err
+	}
+	fence, err := l.redis.ReaperLockFence(ctx)
+	if err != nil {
+		// Renewal decides whether the lock is lost when Redis is unreachable.
+		l.logger.Warn("failed to read reaper lock fence", "error", err)
+		return nil
+	}
+	if fence != l.fence {
+		l.lose(lostTakenOver)
+	}
+	return l.err()
+}
+
+// lose marks the lease lost and stops the cycle.
+func (l *lease) lose(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reason != "" {
+		return
+	}
+	l.reason = reason
+	metrics.ReaperLockLost.WithLabelValues(reason).Inc()
+	metrics.ReaperLockHeld.Set(0)
+	l.logger.Warn("reaper lock lost, stopping reap cycle",
+		"owner", l.owner,
+		"fence", l.fence,
+		"reason", reason,
+	)
+	l.cancel(ErrLockLost)
+}
+
+// err returns ErrLockLost once the lease is lost.
+func (l *lease) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reason != "" {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// release stops renewal and deletes the lock if the lease still owns it.
+// It runs even when ctx is cancelled, so a shutdown does not leave the lock
+// to expire.
+func (l *lease) release(ctx context.Context) {
+	lost := l.err() != nil
+	l.cancel(context.Canceled)
+	metrics.ReaperLockHeld.Set(0)
+	if lost {
+		return
+	}
+	released, err := l.redis.ReleaseReaperLock(context.WithoutCancel(ctx), l.owner)
+	switch {
+	case err != nil:
+		l.logger.Warn("failed to release reaper lock, it expires on its own", "owner", l.owner, "error", err)
+	case !released:
+		l.logger.Warn("reaper lock was taken over before release", "owner", l.owner, "fence", l.fence)
+		metrics.ReaperLockLost.WithLabelValues(lostTakenOver).Inc()
+	}
+}
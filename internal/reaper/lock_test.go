@@ -0,0 +1,143 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReapOnce_ReleasesLock(t *testing.T) {
+	store := newMockStore()
+	store.addImage("app:1h", 100, -time.Minute, time.Hour)
+
+	r := New(store, deletingRegistry(t).URL, slog.Default())
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.lockOwner != "" {
+		t.Errorf("expected lock to be released, held by %q", store.lockOwner)
+	}
+	if store.fence != 1 {
+		t.Errorf("fence = %d, want 1", store.fence)
+	}
+}
+
+func TestReapOnce_LockBusy(t *testing.T) {
+	store := newMockStore()
+	store.addImage("app:1h", 100, -time.Minute, time.Hour)
+	store.takeOverLock("other")
+
+	r := New(store, deletingRegistry(t).URL, slog.Default())
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.images) != 1 {
+		t.Error("expected no images reaped while another replica holds the lock")
+	}
+	if store.lockOwner != "other" {
+		t.Errorf("expected the other replica's lock to be kept, held by %q", store.lockOwner)
+	}
+}
+
+func TestReapOnce_LockTakenOver(t *testing.T) {
+	store := newMockStore()
+	for _, image := range []string{"a:1h", "b:1h", "c:1h"} {
+		store.addImage(image, 100, -time.Minute, time.Hour)
+	}
+
+	// Another replica acquires the lock after the first deletion, as if
+	// ours had expired mid-cycle.
+	var once sync.Once
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		once.Do(func() { store.takeOverLock("other") })
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reg.Close()
+
+	r := New(store, reg.URL, slog.Default(), WithBatchSize(1))
+	err := r.ReapOnce(t.Context())
+	if !errors.Is(err, ErrLockLost) {
+		t.Fatalf("expected ErrLockLost, got %v", err)
+	}
+	if len(store.images) != 2 {
+		t.Errorf("expected the cycle to stop after the takeover, %d images left", len(store.images))
+	}
+	if store.lockOwner != "other" {
+		t.Errorf("expected the new holder's lock to be kept, held by %q", store.lockOwner)
+	}
+}
+
+// renewFailingStore fails every lock renewal, as if Redis were unreachable.
+type renewFailingStore struct {
+	*mockStore
+}
+
+func (renewFailingStore) RenewReaperLock(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestLease_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name  string
+		lease func(*mockStore) *lease
+		want  error
+	}{
+		{
+			name: "renewed",
+			lease: func(m *mockStore) *lease {
+				return &lease{redis: m, owner: "me", fence: 1}
+			},
+		},
+		{
+			name: "taken over",
+			lease: func(m *mockStore) *lease {
+				m.lockOwner = "other"
+				return &lease{redis: m, owner: "me", fence: 1}
+			},
+			want: ErrLockLost,
+		},
+		{
+			name: "renewals fail until expiry",
+			lease: func(m *mockStore) *lease {
+				return &lease{redis: renewFailingStore{m}, owner: "me", fence: 1}
+			},
+			want: ErrLockLost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockStore()
+			m.lockOwner = "me"
+			l := tt.lease(m)
+			l.logger = slog.Default()
+			l.ttl = 30 * time.Millisecond
+
+			ctx, cancel := context.WithCancelCause(t.Context())
+			l.cancel = cancel
+			go l.keepAlive(ctx, 5*time.Millisecond)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			cancel(context.Canceled)
+
+			if err := l.err(); !errors.Is(err, tt.want) {
+				t.Fatalf("err() = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil && !errors.Is(context.Cause(ctx), ErrLockLost) {
+				t.Errorf("expected the cycle context to be cancelled with ErrLockLost, got %v", context.Cause(ctx))
+			}
+		})
+	}
+}
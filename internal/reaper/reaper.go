@@ -2,16 +2,26 @@ package reaper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/immutability"
 	"github.com/tamcore/ephemeron/internal/metrics"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
 	redisclient "github.com/tamcore/ephemeron/internal/redis"
+	"github.com/tamcore/ephemeron/internal/registry"
 )
 
+// errInvalidImage is returned by deleteImage for a tracked entry that is not
+// a repo:tag reference. The entry is removed without contacting the registry.
+var errInvalidImage = errors.New("invalid image format")
+
 // HealthReporter is called by the reaper to report registry interaction outcomes.
 type HealthReporter interface {
 	ReportSuccess()
@@ -25,8 +35,28 @@ type Reaper struct {
 	logger      *slog.Logger
 	httpClient  *http.Client
 	health      HealthReporter
+	batchSize   int64
+	policy      *policy.Source
+	notifier    *notify.Dispatcher
+	history     *audit.Recorder
+
+	immutable *immutability.Rules
+
+	budgets       []Budget
+	lowWatermark  float64
+	evictionOrder EvictionOrder
+
+	concurrency  int
+	maxDeletions int
+	maxDuration  time.Duration
+
+	retry redisclient.RetryPolicy
 }
 
+// defaultBatchSize is the number of expired images fetched from the expiry
+// index per round trip.
+const defaultBatchSize = 500
+
 // Option configures a Reaper.
 type Option func(*Reaper)
 
@@ -37,6 +67,65 @@ func WithHealthReporter(h HealthReporter) Option {
 	}
 }
 
+// WithBatchSize sets how many expired images are fetched from Redis at a time.
+func WithBatchSize(n int64) Option {
+	return func(r *Reaper) {
+		if n > 0 {
+			r.batchSize = n
+		}
+	}
+}
+
+// WithConcurrency sets how many expired images are deleted in parallel.
+// Values below one are ignored.
+func WithConcurrency(n int) Option {
+	return func(r *Reaper) {
+		if n > 0 {
+			r.concurrency = n
+		}
+	}
+}
+
+// WithCycleLimits caps the deletions and the time of each reap cycle; the
+// rest of a backlog is left for the following cycles. Zero disables a limit.
+func WithCycleLimits(maxDeletions int, maxDuration time.Duration) Option {
+	return func(r *Reaper) {
+		r.maxDeletions = maxDeletions
+		r.maxDuration = maxDuration
+	}
+}
+
+// WithPolicy makes the reaper skip images that a never_reap rule exempts,
+// even if they were tracked before the rule was added.
+func WithPolicy(src *policy.Source) Option {
+	return func(r *Reaper) {
+		r.policy = src
+	}
+}
+
+// WithImmutability sets the rules of immutable tags, which keep_last
+// retention neither counts nor deletes. A policy rule that sets immutable
+// overrides them.
+func WithImmutability(rules *immutability.Rules) Option {
+	return func(r *Reaper) {
+		r.immutable = rules
+	}
+}
+
+// WithNotifier sends reaped and failed events to n.
+func WithNotifier(n *notify.Dispatcher) Option {
+	return func(r *Reaper) {
+		r.notifier = n
+	}
+}
+
+// WithHistory records reaped and failed deletions in the image history.
+func WithHistory(h *audit.Recorder) Option {
+	return func(r *Reaper) {
+		r.history = h
+	}
+}
+
 // New creates a new Reaper.
 func New(redis redisclient.Store, registryURL string, logger *slog.Logger, opts ...Option) *Reaper {
 	r := &Reaper{
@@ -44,6 +133,11 @@ func New(redis redisclient.Store, registryURL string, logger *slog.Logger, opts
 		registryURL: strings.TrimRight(registryURL, "/"),
 		logger:      logger,
 		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		batchSize:   defaultBatchSize,
+		concurrency: 1,
+
+		lowWatermark:  defaultLowWatermark,
+		evictionOrder: EvictSoonestExpiry,
 	}
 	for _, opt := range opts {
 		opt(r)
@@ -72,84 +166,125 @@ func (r *Reaper) RunLoop(ctx context.Context, interval time.Duration) {
 	}
 }
 
-// ReapOnce performs a single reap pass — checking all tracked images and
-// deleting those that have expired. Uses a Redis lock to ensure only one
-// replica runs the reaper at a time.
+// ReapOnce performs a single reap pass — fetching expired images from the
+// expiry index in batches and deleting them, up to the cycle limits. Uses a
+// Redis lock to ensure only one replica runs the reaper at a time, and
+// returns ErrLockLost if the lock is lost before the pass completes.
 func (r *Reaper) ReapOnce(ctx context.Context) error {
-	acquired, err := r.redis.AcquireReaperLock(ctx, 5*time.Minute)
+	l, cctx, err := r.acquireLock(ctx)
 	if err != nil {
-		return fmt.Errorf("acquiring reaper lock: %w", err)
+		return err
 	}
-	if !acquired {
+	if l == nil {
 		r.logger.Debug("another replica holds the reaper lock, skipping")
 		return nil
 	}
-	defer func() { _ = r.redis.ReleaseReaperLock(ctx) }()
+	defer l.release(ctx)
 
+	err = r.reap(cctx, l)
+	if lerr := l.err(); lerr != nil {
+		return lerr
+	}
+	return err
+}
+
+// reap runs one reap pass under the lease l, checking its fencing token
+// before each batch of deletions.
+func (r *Reaper) reap(ctx context.Context, l *lease) error {
 	start := time.Now()
 	defer func() {
 		metrics.ReaperCycleDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	images, err := r.redis.ListImages(ctx)
+	total, err := r.redis.ImageCount(ctx)
 	if err != nil {
 		metrics.ReaperCycleErrors.Inc()
-		return fmt.Errorf("listing images: %w", err)
+		return fmt.Errorf("counting images: %w", err)
 	}
 
-	r.logger.Info("reap cycle starting", "total_images", len(images))
-	metrics.TrackedImagesGauge.Set(float64(len(images)))
+	r.logger.Info("reap cycle starting", "total_images", total)
+	metrics.TrackedImagesGauge.Set(float64(total))
 
-	now := time.Now().UnixMilli()
+	now := time.Now()
+	c := r.newCycle(start)
+	defer r.reportLimit(c, start)
+	defer r.reportDeadLetters(ctx)
 
-	var attempted, failed int
+	// Images that fail deletion stay at the head of the expiry index, so
+	// skip past them when fetching the next batch.
+	var attempted, failed, skipped, pinned, deferred, invalid int
+	var offset int64
 
-	for _, image := range images {
-		if err := ctx.Err(); err != nil {
+	for c.limited() == "" {
+		if err := l.check(ctx); err != nil {
 			return err
 		}
 
-		expiresAt, err := r.redis.GetExpiry(ctx, image)
+		batch, err := r.redis.ListExpiredImages(ctx, now, offset, r.batchSize)
 		if err != nil {
-			r.logger.Warn("failed to get expiry, cleaning up", "image", image, "error", err)
-			_ = r.redis.RemoveImage(ctx, image)
-			continue
+			metrics.ReaperCycleErrors.Inc()
+			return fmt.Errorf("listing expired images: %w", err)
 		}
 
-		if expiresAt > now {
-			remaining := time.Duration(expiresAt-now) * time.Millisecond
-			r.logger.Debug("image not expired yet",
-				"image", image,
-				"remaining", remaining.Round(time.Second).String(),
-			)
+		states, err := r.redis.ReapStates(ctx, batch)
+		if err != nil {
+			// Pins cannot be told apart, and deleting is not undoable.
+			r.logger.Warn("failed to read pins, skipping batch", "images", len(batch), "error", err)
+			offset += int64(len(batch))
+			if int64(len(batch)) < r.batchSize {
+				break
+			}
 			continue
 		}
 
-		// Get image size before deletion for metrics
-		sizeBytes, err := r.redis.GetImageSize(ctx, image)
-		if err != nil {
-			r.logger.Warn("failed to get image size for metrics", "image", image, "error", err)
-			sizeBytes = 0
+		candidates := make([]string, 0, len(batch))
+		for _, img := range states {
+			switch {
+			case r.exempt(img.Name):
+				r.logger.Debug("skipping image exempt by policy", "image", img.Name)
+				skipped++
+				offset++
+			case img.PinnedAt(now):
+				r.logger.Debug("skipping pinned image", "image", img.Name)
+				pinned++
+				offset++
+			case img.DeferredAt(now):
+				r.logger.Debug("skipping image backing off after failed deletions", "image", img.Name)
+				deferred++
+				offset++
+			default:
+				candidates = append(candidates, img.Name)
+			}
 		}
 
-		attempted++
-		if err := r.deleteImage(ctx, image); err != nil {
-			r.logger.Error("failed to delete image", "image", image, "error", err)
-			failed++
-			continue
+		// Invalid entries are gone from the index like reaped images, so
+		// only failures are skipped.
+		n, nFailed, nInvalid := r.reapExpired(ctx, c, candidates)
+		attempted += n
+		failed += nFailed
+		invalid += nInvalid
+		offset += int64(nFailed)
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		// Update storage metrics
-		metrics.ImagesReaped.Inc()
-		metrics.BytesReclaimed.Add(float64(sizeBytes))
-		metrics.TrackedBytesTotal.Sub(float64(sizeBytes))
+		if int64(len(batch)) < r.batchSize {
+			break
+		}
+	}
 
-		sizeMB := float64(sizeBytes) / (1024 * 1024)
-		r.logger.Info("reaped expired image",
-			"image", image,
-			"size_bytes", sizeBytes,
-			"size_mb", fmt.Sprintf("%.2f", sizeMB),
-		)
+	if skipped > 0 {
+		r.logger.Info("skipped expired images exempt by policy", "count", skipped)
+	}
+	if pinned > 0 {
+		r.logger.Info("skipped pinned expired images", "count", pinned)
+	}
+	metrics.PinnedImagesSkipped.Set(float64(pinned))
+	if deferred > 0 {
+		r.logger.Info("skipped expired images backing off or dead-lettered after failed deletions", "count", deferred)
+	}
+	if invalid > 0 {
+		r.logger.Warn("removed invalid entries from the expiry index", "count", invalid)
 	}
 
 	// Report registry health based on deletion outcomes.
@@ -163,14 +298,165 @@ func (r *Reaper) ReapOnce(ctx context.Context) error {
 		}
 	}
 
+	if err := l.check(ctx); err != nil {
+		return err
+	}
+	if err := r.enforceRetention(ctx, c); err != nil {
+		metrics.ReaperCycleErrors.Inc()
+		return fmt.Errorf("enforcing retention: %w", err)
+	}
+
+	if err := l.check(ctx); err != nil {
+		return err
+	}
+	if err := r.enforceBudgets(ctx, c); err != nil {
+		metrics.ReaperCycleErrors.Inc()
+		return fmt.Errorf("enforcing storage budgets: %w", err)
+	}
+
 	return nil
 }
 
+// Reasons an image is reaped, used in logs and as the reason label of
+// ImagesReaped.
+const (
+	// ReasonTTL marks images reaped because they expired.
+	ReasonTTL = "ttl"
+	// ReasonCount marks images reaped by a keep_last retention rule.
+	ReasonCount = "count"
+	// ReasonManual marks images deleted on request, e.g. by a bulk delete.
+	ReasonManual = "manual"
+	// ReasonBudget marks images evicted over a storage budget. They are
+	// counted by ImagesEvicted instead of ImagesReaped.
+	ReasonBudget = "budget"
+)
+
+// DeleteImage deletes a tracked image right away through the same path as
+// expired images, recording it as reaped for ReasonManual.
+func (r *Reaper) DeleteImage(ctx context.Context, imageWithTag string) error {
+	_, err := r.reapImage(ctx, imageWithTag, ReasonManual)
+	return err
+}
+
+// reapImage deletes an image and records it as reaped for reason, returning
+// the bytes it reclaimed. Extra attrs are added to the log line.
+func (r *Reaper) reapImage(ctx context.Context, image, reason string, attrs ...any) (int64, error) {
+	// Get image size before deletion for metrics
+	sizeBytes, err := r.redis.GetImageSize(ctx, image)
+	if err != nil {
+		r.logger.Warn("failed to get image size for metrics", "image", image, "error", err)
+		sizeBytes = 0
+	}
+
+	record := r.notifyRecord(ctx, image)
+	if err := r.deleteImage(ctx, image); err != nil {
+		if errors.Is(err, errInvalidImage) {
+			r.logger.Warn("removed tracked entry that is not an image reference", "image", image)
+			return 0, err
+		}
+		r.logger.Error("failed to delete image", "image", image, "reason", reason, "error", err)
+		r.notifyReap(ctx, record, reason, err)
+		r.recordFailure(ctx, record, reason, err)
+		return 0, err
+	}
+	r.notifyReap(ctx, record, reason, nil)
+
+	// Update storage metrics; the caller counts budget evictions.
+	if reason != ReasonBudget {
+		metrics.ImagesReaped.WithLabelValues(reason).Inc()
+		metrics.BytesReclaimed.Add(float64(sizeBytes))
+	}
+	metrics.TrackedBytesTotal.Sub(float64(sizeBytes))
+
+	sizeMB := float64(sizeBytes) / (1024 * 1024)
+	r.logger.Info("reaped image",
+		append([]any{
+			"image", image,
+			"reason", reason,
+			"size_bytes", sizeBytes,
+			"size_mb", fmt.Sprintf("%.2f", sizeMB),
+		}, attrs...)...,
+	)
+	return sizeBytes, nil
+}
+
+// notifyRecord reads the record of an image about to be deleted, for the
+// event and history entry written afterwards. It is skipped without a
+// notifier or history.
+func (r *Reaper) notifyRecord(ctx context.Context, image string) redisclient.Image {
+	if r.notifier == nil && r.history == nil {
+		return redisclient.Image{Name: image}
+	}
+	img, err := r.redis.GetImage(ctx, image)
+	if err != nil {
+		r.logger.Debug("failed to read image record for notification", "image", image, "error", err)
+		return redisclient.Image{Name: image}
+	}
+	return img
+}
+
+// notifyReap emits a reaped event, or a failed event if err is set, and
+// records the outcome in the image history.
+func (r *Reaper) notifyReap(ctx context.Context, img redisclient.Image, reason string, err error) {
+	entry := audit.Entry{
+		Action:    audit.ActionReaped,
+		Image:     img.Name,
+		Digest:    img.Digest,
+		SizeBytes: img.SizeBytes,
+		ExpiresAt: img.Expires,
+		Actor:     audit.ActorReaper,
+		Reason:    reason,
+	}
+	if err != nil {
+		entry.Action, entry.Error = audit.ActionDeleteFailed, err.Error()
+	}
+	r.history.Record(ctx, entry)
+
+	if r.notifier == nil {
+		return
+	}
+	event := notify.Event{
+		Type:      notify.EventReaped,
+		Image:     img.Name,
+		Digest:    img.Digest,
+		SizeBytes: img.SizeBytes,
+		ExpiresAt: img.Expires,
+		Reason:    reason,
+	}
+	if err != nil {
+		event.Type, event.Error = notify.EventFailed, err.Error()
+	}
+	r.notifier.Emit(event)
+}
+
+// exempt reports whether a never_reap policy rule matches the image.
+func (r *Reaper) exempt(imageWithTag string) bool {
+	repo, tag, ok := strings.Cut(imageWithTag, ":")
+	if !ok {
+		return false
+	}
+	rule := r.policy.Policy().Match(repo, tag)
+	return rule != nil && rule.NeverReap
+}
+
+// isPinned reports whether the image is pinned at now. When the pin cannot
+// be read the image is treated as pinned, since deleting it is not undoable.
+func (r *Reaper) isPinned(ctx context.Context, imageWithTag string, now time.Time) bool {
+	pinned, err := r.redis.IsPinned(ctx, imageWithTag, now)
+	if err != nil {
+		r.logger.Warn("failed to read pin, skipping image", "image", imageWithTag, "error", err)
+		return true
+	}
+	return pinned
+}
+
 func (r *Reaper) deleteImage(ctx context.Context, imageWithTag string) error {
 	parts := strings.SplitN(imageWithTag, ":", 2)
 	if len(parts) != 2 {
-		_ = r.redis.RemoveImage(ctx, imageWithTag)
-		return fmt.Errorf("invalid image format: %s", imageWithTag)
+		if err := r.redis.RemoveImage(ctx, imageWithTag); err != nil {
+			return fmt.Errorf("removing invalid image %s: %w", imageWithTag, err)
+		}
+		return fmt.Errorf("%w: %s", errInvalidImage, imageWithTag)
 	}
 	repo, tag := parts[0], parts[1]
 
@@ -180,7 +466,9 @@ func (r *Reaper) deleteImage(ctx context.Context, imageWithTag string) error {
 	if err != nil {
 		return fmt.Errorf("creating HEAD request: %w", err)
 	}
-	headReq.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	// Accept index types too, so a multi-arch tag resolves to the index
+	// digest rather than a platform-specific child manifest.
+	headReq.Header.Set("Accept", registry.ManifestAccept)
 
 	headResp, err := r.httpClient.Do(headReq)
 	if err != nil {
@@ -205,26 +493,113 @@ func (r *Reaper) deleteImage(ctx context.Context, imageWithTag string) error {
 		return fmt.Errorf("no digest found for %s", imageWithTag)
 	}
 
-	// Delete the manifest by digest.
-	deleteURL := fmt.Sprintf("%s/v2/%s/manifests/%s", r.registryURL, repo, digest)
-	delReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, deleteURL, nil)
+	// Deleting by digest removes every tag pointing at the manifest, so only
+	// do that once no other live tag still references it.
+	shared, err := r.liveTagsSharingDigest(ctx, repo, digest, imageWithTag)
 	if err != nil {
-		return fmt.Errorf("creating DELETE request: %w", err)
+		return fmt.Errorf("checking tags sharing %s: %w", digest, err)
+	}
+	if len(shared) > 0 {
+		return r.untagImage(ctx, repo, tag, imageWithTag, shared)
 	}
-	delReq.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
 
-	delResp, err := r.httpClient.Do(delReq)
+	status, err := r.deleteManifest(ctx, repo, digest)
 	if err != nil {
-		return fmt.Errorf("DELETE manifest: %w", err)
+		return err
 	}
-	defer func() { _ = delResp.Body.Close() }()
-
-	validStatus := delResp.StatusCode == http.StatusAccepted ||
-		delResp.StatusCode == http.StatusOK ||
-		delResp.StatusCode == http.StatusNotFound
+	validStatus := status == http.StatusAccepted ||
+		status == http.StatusOK ||
+		status == http.StatusNotFound
 	if !validStatus {
-		return fmt.Errorf("DELETE manifest returned %d", delResp.StatusCode)
+		return fmt.Errorf("DELETE manifest returned %d", status)
 	}
 
 	return r.redis.RemoveImage(ctx, imageWithTag)
 }
+
+// liveTagsSharingDigest returns the other tracked tags in repo that point at
+// digest and are not about to be reaped with it: tags that have not expired
+// yet, and expired tags the reaper leaves alone because they are exempt,
+// pinned or backing off. Untracked tags left in the set are dropped from it.
+func (r *Reaper) liveTagsSharingDigest(ctx context.Context, repo, digest, imageWithTag string) ([]string, error) {
+	tags, err := r.redis.ListDigestTags(ctx, repo, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var live []string
+	for _, other := range tags {
+		if other == imageWithTag {
+			continue
+		}
+		expiresAt, err := r.redis.GetExpiry(ctx, other)
+		if errors.Is(err, redisclient.ErrNotTracked) {
+			r.logger.Debug("dropping untracked tag from digest references", "image", other, "digest", digest)
+			if err := r.redis.RemoveDigestTag(ctx, repo, digest, other); err != nil {
+				r.logger.Warn("failed to drop untracked tag from digest references", "image", other, "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt > now.UnixMilli() || r.retained(ctx, other, now) {
+			live = append(live, other)
+		}
+	}
+	return live, nil
+}
+
+// retained reports whether the expiry loop skips an expired image for now,
+// so it keeps pointing at its manifest.
+func (r *Reaper) retained(ctx context.Context, imageWithTag string, now time.Time) bool {
+	return r.exempt(imageWithTag) || r.isPinned(ctx, imageWithTag, now) || r.isDeferred(ctx, imageWithTag, now)
+}
+
+// untagImage removes only the tag via the OCI tag-deletion endpoint, leaving
+// the manifest in place for the other tags that still reference it.
+func (r *Reaper) untagImage(ctx context.Context, repo, tag, imageWithTag string, shared []string) error {
+	status, err := r.deleteManifest(ctx, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		r.logger.Info("deleted tag, manifest still referenced",
+			"image", imageWithTag,
+			"shared_with", shared,
+		)
+	case http.StatusMethodNotAllowed, http.StatusBadRequest:
+		// Registry does not support deleting tags. The tag disappears
+		// together with the manifest once the last sharing tag expires.
+		r.logger.Warn("registry does not support tag deletion, leaving tag in place",
+			"image", imageWithTag,
+			"shared_with", shared,
+		)
+	default:
+		return fmt.Errorf("DELETE tag returned %d", status)
+	}
+
+	return r.redis.RemoveImage(ctx, imageWithTag)
+}
+
+// deleteManifest issues DELETE /v2/<repo>/manifests/<reference>, where
+// reference is either a digest or a tag, and returns the response status.
+func (r *Reaper) deleteManifest(ctx context.Context, repo, reference string) (int, error) {
+	deleteURL := fmt.Sprintf("%s/v2/%s/manifests/%s", r.registryURL, repo, reference)
+	delReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, deleteURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating DELETE request: %w", err)
+	}
+	delReq.Header.Set("Accept", registry.ManifestAccept)
+
+	delResp, err := r.httpClient.Do(delReq)
+	if err != nil {
+		return 0, fmt.Errorf("DELETE manifest: %w", err)
+	}
+	defer func() { _ = delResp.Body.Close() }()
+
+	return delResp.StatusCode, nil
+}
@@ -2,20 +2,46 @@ package reaper
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
 )
 
-// mockStore is an in-memory implementation of redis.Store for testing.
+// mockStore is an in-memory implementation of redis.Store for testing. mu
+// guards the methods parallel deleters call.
 type mockStore struct {
+	mu      sync.Mutex
 	images  map[string]int64 // imageWithTag -> expiresAt (epoch millis)
 	sizes   map[string]int64 // imageWithTag -> sizeBytes
 	digests map[string]string
 	created map[string]int64
+	pinned  map[string]int64 // imageWithTag -> pinned until (0 = indefinitely)
 	removed []string
+
+	repoReads []string // repositories read by ListRepoImagesByCreated
+
+	failures map[string]redisclient.ReapFailure
+
+	stateReads   int // ReapStates calls
+	singleChecks int // IsPinned and IsReapDeferred calls
+
+	lockOwner string
+	fence     int64
 }
 
 func newMockStore() *mockStore {
@@ -24,6 +50,9 @@ func newMockStore() *mockStore {
 		sizes:   make(map[string]int64),
 		digests: make(map[string]string),
 		created: make(map[string]int64),
+		pinned:  make(map[string]int64),
+
+		failures: make(map[string]redisclient.ReapFailure),
 	}
 }
 
@@ -52,11 +81,152 @@ func (m *mockStore) ListImages(context.Context) ([]string, error) {
 	return out, nil
 }
 
+func (m *mockStore) IsTracked(_ context.Context, imageWithTag string) (bool, error) {
+	_, ok := m.images[imageWithTag]
+	return ok, nil
+}
+
+func (m *mockStore) ListExpiredImages(_ context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	var out []string
+	for k, expiresAt := range m.images {
+		if expiresAt <= now.UnixMilli() {
+			out = append(out, k)
+		}
+	}
+	return page(out, m.images, offset, limit), nil
+}
+
+func (m *mockStore) ListImagesByExpiryAfter(
+	context.Context, redisclient.ExpiryCursor, int64,
+) ([]redisclient.ExpiryCursor, error) {
+	return nil, nil
+}
+
+func (m *mockStore) ListImagesExpiringBetween(_ context.Context, from, to time.Time, offset, limit int64) ([]string, error) {
+	var out []string
+	for k, expiresAt := range m.images {
+		if expiresAt > from.UnixMilli() && expiresAt <= to.UnixMilli() {
+			out = append(out, k)
+		}
+	}
+	return page(out, m.images, offset, limit), nil
+}
+
+func (m *mockStore) ListImagesByExpiry(_ context.Context, offset, limit int64) ([]string, error) {
+	out, _ := m.ListImages(context.Background())
+	return page(out, m.images, offset, limit), nil
+}
+
+func (m *mockStore) ListImagesByCreated(_ context.Context, offset, limit int64) ([]string, error) {
+	out, _ := m.ListImages(context.Background())
+	return page(out, m.created, offset, limit), nil
+}
+
+func (m *mockStore) ListRepositories(context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for image := range m.images {
+		if repo := repoOf(image); !seen[repo] {
+			seen[repo] = true
+			out = append(out, repo)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) ListRepoImagesByCreated(_ context.Context, repo string) ([]string, error) {
+	m.repoReads = append(m.repoReads, repo)
+	var out []string
+	for image := range m.images {
+		if repoOf(image) == repo {
+			out = append(out, image)
+		}
+	}
+	return page(out, m.created, 0, int64(len(out))), nil
+}
+
+// repoOf returns the repository part of a repo:tag reference.
+func repoOf(imageWithTag string) string {
+	if i := strings.LastIndex(imageWithTag, ":"); i >= 0 {
+		return imageWithTag[:i]
+	}
+	return imageWithTag
+}
+
+func (m *mockStore) ReapStates(_ context.Context, images []string) ([]redisclient.Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stateReads++
+	out := make([]redisclient.Image, len(images))
+	for i, image := range images {
+		until, pinned := m.pinned[image]
+		out[i] = redisclient.Image{Name: image, Expires: time.UnixMilli(m.images[image]), Pinned: pinned, RetryAt: m.failures[image].RetryAt}
+		if until > 0 {
+			out[i].PinnedUntil = time.UnixMilli(until)
+		}
+		if m.failures[image].DeadLettered {
+			out[i].DeadLettered = time.Now()
+		}
+	}
+	return out, nil
+}
+
+// page sorts images by score, then name, like a Redis sorted set, and
+// returns the requested window.
+func page(images []string, scores map[string]int64, offset, limit int64) []string {
+	sort.Slice(images, func(i, j int) bool {
+		if scores[images[i]] != scores[images[j]] {
+			return scores[images[i]] < scores[images[j]]
+		}
+		return images[i] < images[j]
+	})
+	if offset >= int64(len(images)) {
+		return nil
+	}
+	images = images[offset:]
+	if int64(len(images)) > limit {
+		images = images[:limit]
+	}
+	return images
+}
+
+func (m *mockStore) TrackedBytes(context.Context) (int64, error) {
+	var total int64
+	for image := range m.images {
+		total += m.sizes[image]
+	}
+	return total, nil
+}
+
+func (m *mockStore) RepoBytes(context.Context) (map[string]int64, error) {
+	out := make(map[string]int64)
+	for image := range m.images {
+		repo, _, _ := strings.Cut(image, ":")
+		out[repo] += m.sizes[image]
+	}
+	return out, nil
+}
+
 func (m *mockStore) GetExpiry(_ context.Context, imageWithTag string) (int64, error) {
-	return m.images[imageWithTag], nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt, ok := m.images[imageWithTag]
+	if !ok {
+		return 0, redisclient.ErrNotTracked
+	}
+	return expiresAt, nil
 }
 
+func (m *mockStore) SetExpiry(_ context.Context, imageWithTag string, expiresAt time.Time) error {
+	m.images[imageWithTag] = expiresAt.UnixMilli()
+	return nil
+}
+
+func (m *mockStore) SetLastPulled(context.Context, string, time.Time) error { return nil }
+
 func (m *mockStore) GetImageSize(_ context.Context, imageWithTag string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.sizes[imageWithTag], nil
 }
 
@@ -68,20 +238,191 @@ func (m *mockStore) GetCreatedTimestamp(_ context.Context, imageWithTag string)
 	return m.created[imageWithTag], nil
 }
 
+func (m *mockStore) ListDigestTags(_ context.Context, repo, digest string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for image, d := range m.digests {
+		if d == digest && strings.HasPrefix(image, repo+":") {
+			out = append(out, image)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) RemoveDigestTag(_ context.Context, _, _, imageWithTag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.digests, imageWithTag)
+	return nil
+}
+
 func (m *mockStore) RemoveImage(_ context.Context, imageWithTag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.images, imageWithTag)
+	delete(m.digests, imageWithTag)
+	delete(m.failures, imageWithTag)
 	m.removed = append(m.removed, imageWithTag)
 	return nil
 }
 
-func (m *mockStore) AcquireReaperLock(context.Context, time.Duration) (bool, error) {
+func (m *mockStore) GetImage(_ context.Context, imageWithTag string) (redisclient.Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.Image{}, redisclient.ErrNotTracked
+	}
+	until, pinned := m.pinned[imageWithTag]
+	img := redisclient.Image{
+		Name:      imageWithTag,
+		Created:   time.UnixMilli(m.created[imageWithTag]),
+		Expires:   time.UnixMilli(expires),
+		SizeBytes: m.sizes[imageWithTag],
+		Digest:    m.digests[imageWithTag],
+		Pinned:    pinned,
+	}
+	if until > 0 {
+		img.PinnedUntil = time.UnixMilli(until)
+	}
+	return img, nil
+}
+
+func (m *mockStore) PinImage(_ context.Context, imageWithTag string, until time.Time) error {
+	var untilMs int64
+	if !until.IsZero() {
+		untilMs = until.UnixMilli()
+	}
+	m.pinned[imageWithTag] = untilMs
+	return nil
+}
+
+func (m *mockStore) UnpinImage(_ context.Context, imageWithTag string) error {
+	delete(m.pinned, imageWithTag)
+	return nil
+}
+
+func (m *mockStore) IsPinned(_ context.Context, imageWithTag string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.singleChecks++
+	until, ok := m.pinned[imageWithTag]
+	return ok && (until == 0 || until > now.UnixMilli()), nil
+}
+
+func (m *mockStore) ClaimExpiryWarning(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) TagDigests(context.Context, string) ([]redisclient.TagDigest, error) {
+	return nil, nil
+}
+
+// RecordReapFailure backs off and dead-letters like the Redis script.
+func (m *mockStore) RecordReapFailure(_ context.Context, imageWithTag, _ string, now time.Time, p redisclient.RetryPolicy) (redisclient.ReapFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.images[imageWithTag]; !ok {
+		return redisclient.ReapFailure{}, redisclient.ErrNotTracked
+	}
+	f := redisclient.ReapFailure{Failures: m.failures[imageWithTag].Failures + 1}
+	switch {
+	case p.MaxFailures > 0 && f.Failures >= int64(p.MaxFailures):
+		f.DeadLettered = true
+	case p.Backoff > 0:
+		f.RetryAt = now.Add(min(p.Backoff<<(f.Failures-1), max(p.MaxBackoff, p.Backoff)))
+	}
+	m.failures[imageWithTag] = f
+	return f, nil
+}
+
+func (m *mockStore) IsReapDeferred(_ context.Context, imageWithTag string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.singleChecks++
+	f := m.failures[imageWithTag]
+	return f.DeadLettered || f.RetryAt.After(now), nil
+}
+
+func (m *mockStore) ListReapDeadLetters(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for image, f := range m.failures {
+		if f.DeadLettered {
+			out = append(out, image)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *mockStore) ReapDeadLetterCount(ctx context.Context) (int64, error) {
+	out, _ := m.ListReapDeadLetters(ctx)
+	return int64(len(out)), nil
+}
+
+func (m *mockStore) RetryReapDeadLetter(_ context.Context, imageWithTag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.failures[imageWithTag].DeadLettered {
+		return redisclient.ErrNotDeadLettered
+	}
+	delete(m.failures, imageWithTag)
+	return nil
+}
+
+// AcquireReaperLock, RenewReaperLock, ReleaseReaperLock and ReaperLockFence
+// behave like the Redis scripts: the lock is owned by lockOwner until
+// released.
+func (m *mockStore) AcquireReaperLock(_ context.Context, owner string, _ time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lockOwner != "" {
+		return 0, nil
+	}
+	m.lockOwner = owner
+	m.fence++
+	return m.fence, nil
+}
+
+func (m *mockStore) RenewReaperLock(_ context.Context, owner string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lockOwner == owner, nil
+}
+
+func (m *mockStore) ReleaseReaperLock(_ context.Context, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lockOwner != owner {
+		return false, nil
+	}
+	m.lockOwner = ""
 	return true, nil
 }
 
-func (m *mockStore) ReleaseReaperLock(context.Context) error { return nil }
+func (m *mockStore) ReaperLockFence(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fence, nil
+}
 
-func (m *mockStore) IsInitialized(context.Context) (bool, error) { return false, nil }
-func (m *mockStore) SetInitialized(context.Context) error        { return nil }
+// takeOverLock hands the lock to another replica, as if it had expired.
+func (m *mockStore) takeOverLock(owner string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lockOwner = owner
+	m.fence++
+}
+
+func (m *mockStore) IsEventProcessed(context.Context, string) (bool, error)            { return false, nil }
+func (m *mockStore) MarkEventProcessed(context.Context, string, time.Duration) error   { return nil }
+func (m *mockStore) MarkRollback(context.Context, string, string, time.Duration) error { return nil }
+func (m *mockStore) ClaimRollback(context.Context, string, string) (bool, error)       { return false, nil }
+func (m *mockStore) IsInitialized(context.Context) (bool, error)                       { return false, nil }
+func (m *mockStore) SetInitialized(context.Context) error                              { return nil }
 
 func (m *mockStore) ImageCount(context.Context) (int64, error) {
 	return int64(len(m.images)), nil
@@ -141,8 +482,30 @@ func TestDeleteImage_InvalidFormat(t *testing.T) {
 	store := newMockStore()
 	r := New(store, "http://localhost", slog.Default())
 	err := r.deleteImage(t.Context(), "no-colon-here")
-	if err == nil {
-		t.Error("expected error for invalid image format")
+	if !errors.Is(err, errInvalidImage) {
+		t.Errorf("expected errInvalidImage, got %v", err)
+	}
+}
+
+func TestReapOnce_InvalidEntriesDoNotAdvanceOffset(t *testing.T) {
+	store := newMockStore()
+	store.addImage("no-colon-here", 100, -2*time.Hour, time.Hour)
+	store.addImage("app:1h", 100, -time.Hour, time.Hour)
+	store.addImage("app:2h", 100, -time.Minute, time.Hour)
+
+	hr := &mockHealthReporter{}
+	r := New(store, deletingRegistry(t).URL, slog.Default(), WithBatchSize(1), WithHealthReporter(hr))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := remaining(store); len(got) != 0 {
+		t.Errorf("expected every expired entry to be removed, got %v", got)
+	}
+	if len(store.failures) != 0 {
+		t.Errorf("expected the invalid entry not to count as a failure, got %v", store.failures)
+	}
+	if hr.successes != 1 || hr.failures != 0 {
+		t.Errorf("expected 1 success report, got %d successes and %d failures", hr.successes, hr.failures)
 	}
 }
 
@@ -315,3 +678,527 @@ func TestReapOnce_PartialFailure_ReportsSuccess(t *testing.T) {
 		t.Errorf("expected 0 failure reports for partial failure, got %d", hr.failures)
 	}
 }
+
+func TestReapOnce_BatchesExpiredImages(t *testing.T) {
+	var deletes int
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			deletes++
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	for _, image := range []string{"a:1h", "b:1h", "c:1h", "d:1h", "e:1h"} {
+		store.images[image] = time.Now().Add(-time.Minute).UnixMilli()
+	}
+	store.images["later:1h"] = time.Now().Add(time.Hour).UnixMilli()
+
+	r := New(store, reg.URL, slog.Default(), WithBatchSize(2))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deletes != 5 {
+		t.Errorf("expected 5 deletes, got %d", deletes)
+	}
+	if len(store.images) != 1 {
+		t.Errorf("expected only the unexpired image to remain, got %d images", len(store.images))
+	}
+}
+
+func TestReapOnce_FailedDeletesDoNotStallBatches(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	for _, image := range []string{"a:1h", "b:1h", "c:1h"} {
+		store.images[image] = time.Now().Add(-time.Minute).UnixMilli()
+	}
+
+	hr := &mockHealthReporter{}
+	r := New(store, reg.URL, slog.Default(), WithBatchSize(2), WithHealthReporter(hr))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.images) != 3 {
+		t.Errorf("expected failed images to remain tracked, got %d images", len(store.images))
+	}
+	if hr.failures != 1 {
+		t.Errorf("expected 1 failure report, got %d", hr.failures)
+	}
+}
+
+func TestReapOnce_Concurrency(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, peak, deletes int
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		deletes++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	for i := range 12 {
+		store.images[fmt.Sprintf("app:%d", i)] = time.Now().Add(-time.Minute).UnixMilli()
+	}
+
+	hr := &mockHealthReporter{}
+	r := New(store, reg.URL, slog.Default(), WithConcurrency(4), WithBatchSize(5), WithHealthReporter(hr))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deletes != 12 || len(store.images) != 0 {
+		t.Errorf("expected all 12 images reaped, got %d deletes and %d left", deletes, len(store.images))
+	}
+	if peak < 2 || peak > 4 {
+		t.Errorf("peak concurrent deletes = %d, want 2-4", peak)
+	}
+	if hr.successes != 1 || hr.failures != 0 {
+		t.Errorf("expected one success report, got %d successes and %d failures", hr.successes, hr.failures)
+	}
+}
+
+func TestReapOnce_CycleLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxDeletions int
+		maxDuration  time.Duration
+		// remaining images after each of two cycles
+		want []int
+	}{
+		{name: "deletions", maxDeletions: 3, want: []int{4, 1}},
+		{name: "duration", maxDuration: time.Nanosecond, want: []int{7, 7}},
+		{name: "unlimited", want: []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			for i := range 5 {
+				store.addImage(fmt.Sprintf("app:%d", i), 100, -time.Minute, time.Hour)
+			}
+			// Retention draws from the same limit: the older of these is
+			// beyond keep_last.
+			for i := range 2 {
+				store.addImage(fmt.Sprintf("ci/app:%d", i), 100, time.Hour, time.Duration(2-i)*time.Hour)
+			}
+			src := loadPolicy(t, "rules:\n  - repository: \"ci/*\"\n    keep_last: 1\n")
+
+			r := New(store, deletingRegistry(t).URL, slog.Default(),
+				WithPolicy(src),
+				WithConcurrency(2),
+				WithBatchSize(2),
+				WithCycleLimits(tt.maxDeletions, tt.maxDuration),
+			)
+			for cycle, want := range tt.want {
+				if err := r.ReapOnce(t.Context()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got := len(remaining(store)); got != want {
+					t.Errorf("cycle %d: %d images remaining, want %d: %v", cycle+1, got, want, remaining(store))
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteImage_SharedDigestWithLiveTag_DeletesTagOnly(t *testing.T) {
+	var deletedPaths []string
+
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:shared")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			deletedPaths = append(deletedPaths, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["app:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.digests["app:1h"] = "sha256:shared"
+	store.images["app:1w"] = time.Now().Add(time.Hour).UnixMilli()
+	store.digests["app:1w"] = "sha256:shared"
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.deleteImage(t.Context(), "app:1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(deletedPaths) != 1 || deletedPaths[0] != "/v2/app/manifests/1h" {
+		t.Fatalf("expected only the tag to be deleted, got %v", deletedPaths)
+	}
+	if _, exists := store.images["app:1h"]; exists {
+		t.Error("expected expired tag to be removed from store")
+	}
+	if _, exists := store.images["app:1w"]; !exists {
+		t.Error("expected live tag to remain tracked")
+	}
+}
+
+func TestDeleteImage_SharedDigestTagDeleteUnsupported(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:shared")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			if strings.HasSuffix(r.URL.Path, "sha256:shared") {
+				t.Error("manifest must not be deleted while another tag is live")
+			}
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["app:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.digests["app:1h"] = "sha256:shared"
+	store.images["app:1w"] = time.Now().Add(time.Hour).UnixMilli()
+	store.digests["app:1w"] = "sha256:shared"
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.deleteImage(t.Context(), "app:1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists := store.images["app:1h"]; exists {
+		t.Error("expected expired tag to be removed from store")
+	}
+}
+
+func TestReapOnce_LastTagSharingDigest_DeletesManifest(t *testing.T) {
+	var deletedPaths []string
+
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			if len(deletedPaths) > 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:shared")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			deletedPaths = append(deletedPaths, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["app:1h"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	store.digests["app:1h"] = "sha256:shared"
+	store.images["app:2h"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.digests["app:2h"] = "sha256:shared"
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(deletedPaths) != 1 || deletedPaths[0] != "/v2/app/manifests/sha256:shared" {
+		t.Fatalf("expected a single manifest delete by digest, got %v", deletedPaths)
+	}
+	if len(store.images) != 0 {
+		t.Errorf("expected store to be empty, got %d images", len(store.images))
+	}
+}
+
+func TestReapOnce_ExpiredPinnedSiblingKeepsManifest(t *testing.T) {
+	var deletedPaths []string
+
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:shared")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			deletedPaths = append(deletedPaths, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["app:1h"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	store.digests["app:1h"] = "sha256:shared"
+	store.images["app:pinned"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.digests["app:pinned"] = "sha256:shared"
+	store.pinned["app:pinned"] = 0
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(deletedPaths) != 1 || deletedPaths[0] != "/v2/app/manifests/1h" {
+		t.Fatalf("expected only the tag to be deleted, got %v", deletedPaths)
+	}
+	if _, exists := store.images["app:pinned"]; !exists {
+		t.Error("expected pinned tag to remain tracked")
+	}
+}
+
+func TestDeleteImage_StaleDigestTagDropped(t *testing.T) {
+	var deletedPaths []string
+
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:shared")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			deletedPaths = append(deletedPaths, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["app:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.digests["app:1h"] = "sha256:shared"
+	// Left in the digest references without an image record.
+	store.digests["app:gone"] = "sha256:shared"
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.deleteImage(t.Context(), "app:1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deletedPaths) != 1 || deletedPaths[0] != "/v2/app/manifests/sha256:shared" {
+		t.Fatalf("expected the manifest to be deleted by digest, got %v", deletedPaths)
+	}
+	if _, exists := store.digests["app:gone"]; exists {
+		t.Error("expected the stale tag to be dropped from the digest references")
+	}
+}
+
+func TestDeleteImage_HeadAcceptsImageIndex(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+				t.Errorf("HEAD must accept OCI image index, got %q", r.Header.Get("Accept"))
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			if r.URL.Path != "/v2/multiarch/manifests/sha256:index" {
+				t.Errorf("expected index to be deleted, got %s", r.URL.Path)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["multiarch:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+
+	r := New(store, reg.URL, slog.Default())
+	if err := r.deleteImage(t.Context(), "multiarch:1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReapOnce_NeverReapPolicySkipsImage(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reg.Close()
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - repository: \"base/*\"\n    never_reap: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := policy.NewSource(file)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+
+	store := newMockStore()
+	store.images["base/alpine:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+	store.images["myapp:1h"] = time.Now().Add(-time.Minute).UnixMilli()
+
+	r := New(store, reg.URL, slog.Default(), WithPolicy(src), WithBatchSize(1))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, exists := store.images["base/alpine:1h"]; !exists {
+		t.Error("expected never_reap image to be kept")
+	}
+	if _, exists := store.images["myapp:1h"]; exists {
+		t.Error("expected other expired image to be reaped")
+	}
+}
+
+func TestReapOnce_SkipsPinnedImages(t *testing.T) {
+	store := newMockStore()
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	store.images["myapp:pinned"] = expired
+	store.images["myapp:pinned-until"] = expired
+	store.images["myapp:pin-lapsed"] = expired
+	store.images["myapp:1h"] = expired
+	store.pinned["myapp:pinned"] = 0
+	store.pinned["myapp:pinned-until"] = time.Now().Add(time.Hour).UnixMilli()
+	store.pinned["myapp:pin-lapsed"] = time.Now().Add(-time.Second).UnixMilli()
+
+	r := New(store, deletingRegistry(t).URL, slog.Default(), WithBatchSize(1))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, image := range []string{"myapp:pinned", "myapp:pinned-until"} {
+		if _, exists := store.images[image]; !exists {
+			t.Errorf("expected pinned image %s to be kept", image)
+		}
+	}
+	for _, image := range []string{"myapp:pin-lapsed", "myapp:1h"} {
+		if _, exists := store.images[image]; exists {
+			t.Errorf("expected %s to be reaped", image)
+		}
+	}
+}
+
+func TestReapOnce_Notifications(t *testing.T) {
+	var mu sync.Mutex
+	var events []notify.Event
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}))
+	defer sink.Close()
+	notifier := notify.New(&notify.Config{Sinks: []notify.Sink{{Name: "test", URL: sink.URL, Secret: "s"}}}, nil, slog.Default())
+	notifier.Start(t.Context())
+
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/broken/") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["myapp:5m"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	store.sizes["myapp:5m"] = 2048
+	store.digests["myapp:5m"] = "sha256:abc123"
+	store.images["broken:5m"] = time.Now().Add(-time.Minute).UnixMilli()
+
+	r := New(store, reg.URL, slog.Default(), WithNotifier(notifier))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notifier.Close()
+
+	byImage := make(map[string]notify.Event)
+	for _, e := range events {
+		byImage[e.Image] = e
+	}
+	reaped := byImage["myapp:5m"]
+	if reaped.Type != notify.EventReaped || reaped.Reason != ReasonTTL ||
+		reaped.Digest != "sha256:abc123" || reaped.SizeBytes != 2048 {
+		t.Errorf("unexpected reaped event: %+v", reaped)
+	}
+	failed := byImage["broken:5m"]
+	if failed.Type != notify.EventFailed || failed.Reason != ReasonTTL || failed.Error == "" {
+		t.Errorf("unexpected failed event: %+v", failed)
+	}
+}
+
+// historyStore keeps image history in memory.
+type historyStore struct {
+	mu      sync.Mutex
+	entries map[string][][]byte
+}
+
+func (s *historyStore) AppendHistory(_ context.Context, imageWithTag string, entry []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string][][]byte)
+	}
+	s.entries[imageWithTag] = append(s.entries[imageWithTag], entry)
+	return nil
+}
+
+func (s *historyStore) ImageHistory(_ context.Context, imageWithTag string, _ int64) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[imageWithTag], nil
+}
+
+func TestReapOnce_History(t *testing.T) {
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/broken/") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:abc123")
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer reg.Close()
+
+	store := newMockStore()
+	store.images["myapp:5m"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	store.sizes["myapp:5m"] = 2048
+	store.digests["myapp:5m"] = "sha256:abc123"
+	store.images["broken:5m"] = time.Now().Add(-time.Minute).UnixMilli()
+
+	history := audit.New(&historyStore{}, time.Hour, slog.Default())
+	r := New(store, reg.URL, slog.Default(), WithHistory(history))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, _ := history.History(t.Context(), "myapp:5m", 100)
+	tomb := audit.Tombstone(entries)
+	if tomb == nil || tomb.Action != audit.ActionReaped || tomb.Reason != ReasonTTL ||
+		tomb.Digest != "sha256:abc123" || tomb.SizeBytes != 2048 || tomb.Actor != audit.ActorReaper {
+		t.Errorf("unexpected tombstone: %+v", tomb)
+	}
+
+	entries, _ = history.History(t.Context(), "broken:5m", 100)
+	if len(entries) != 1 || entries[0].Action != audit.ActionDeleteFailed || entries[0].Error == "" {
+		t.Errorf("expected a delete_failed entry, got %+v", entries)
+	}
+}
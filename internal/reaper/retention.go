@@ -0,0 +1,133 @@
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// enforceRetention reaps images beyond the newest N of every keep_last
+// rule, per repository, whatever TTL they have left. Pinned, immutable and
+// never_reap tags are neither counted nor deleted. Only repositories a
+// keep_last rule may apply to are read. It stops when the cycle runs out of
+// deletions or time.
+func (r *Reaper) enforceRetention(ctx context.Context, c *cycle) error {
+	p := r.policy.Policy()
+	if !p.HasRetention() {
+		return nil
+	}
+
+	repos, err := r.redis.ListRepositories(ctx)
+	if err != nil {
+		return fmt.Errorf("listing repositories: %w", err)
+	}
+	// Visit repositories in a stable order so logs read the same every cycle.
+	slices.Sort(repos)
+
+	now := time.Now()
+	for _, repo := range repos {
+		if !p.HasRetentionIn(repo) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.enforceRepoRetention(ctx, c, p, repo, now); err != nil {
+			return err
+		}
+		if c.limited() != "" {
+			return nil
+		}
+	}
+	return nil
+}
+
+// enforceRepoRetention applies the keep_last rules to the tags of one
+// repository.
+func (r *Reaper) enforceRepoRetention(ctx context.Context, c *cycle, p *policy.Policy, repo string, now time.Time) error {
+	// The index is ordered oldest first, so every rule collects its images
+	// in push order.
+	images, err := r.redis.ListRepoImagesByCreated(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("listing images of %s by push time: %w", repo, err)
+	}
+
+	var counted []string
+	var rules []*policy.Rule
+	for _, image := range images {
+		tag := strings.TrimPrefix(image, repo+":")
+		rule := p.Match(repo, tag)
+		if rule == nil || rule.KeepLast <= 0 || rule.NeverReap || r.isImmutable(rule, repo, tag) {
+			continue
+		}
+		counted = append(counted, image)
+		rules = append(rules, rule)
+	}
+	if len(counted) == 0 {
+		return nil
+	}
+
+	states, err := r.redis.ReapStates(ctx, counted)
+	if err != nil {
+		// Pins cannot be told apart, and deleting is not undoable.
+		r.logger.Warn("failed to read pins, skipping retention", "repository", repo, "error", err)
+		return nil
+	}
+
+	groups := make(map[string][]redisclient.Image)
+	keepLast := make(map[string]int)
+	var names []string
+	for i, img := range states {
+		if img.PinnedAt(now) {
+			continue
+		}
+		name := rules[i].Name
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], img)
+		keepLast[name] = rules[i].KeepLast
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		excess := len(groups[name]) - keepLast[name]
+		if excess <= 0 {
+			continue
+		}
+		for _, img := range groups[name][:excess] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if img.DeferredAt(now) {
+				continue
+			}
+			if !c.take() {
+				return nil
+			}
+			// Failures are logged by reapImage and retried next cycle.
+			_, _ = r.reapImage(ctx, img.Name, ReasonCount,
+				"rule", name,
+				"keep_last", keepLast[name],
+			)
+		}
+	}
+	return nil
+}
+
+// isImmutable reports whether repo:tag is immutable under rule, falling back
+// to the immutability rules when the policy rule does not decide.
+func (r *Reaper) isImmutable(rule *policy.Rule, repo, tag string) bool {
+	if rule != nil && rule.Immutable != nil {
+		return *rule.Immutable
+	}
+	if m := r.immutable.Match(repo, tag); m != nil {
+		return m.Immutable
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package reaper
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/immutability"
+	"github.com/tamcore/ephemeron/internal/policy"
+)
+
+func loadPolicy(t *testing.T, rules string) *policy.Source {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := policy.NewSource(file)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+	return src
+}
+
+func tagPatterns(t *testing.T, patterns ...string) *immutability.Rules {
+	t.Helper()
+	rules, err := immutability.TagPatterns(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return immutability.New(rules)
+}
+
+func TestReapOnce_KeepLast(t *testing.T) {
+	src := loadPolicy(t, `
+rules:
+  - name: ci
+    repository: "ci/*"
+    keep_last: 2
+`)
+
+	store := newMockStore()
+	store.addImage("ci/frontend:a", 100, 24*time.Hour, 5*time.Hour)
+	store.addImage("ci/frontend:b", 100, 24*time.Hour, 4*time.Hour)
+	store.addImage("ci/frontend:v1.0.0", 100, 24*time.Hour, 3*time.Hour)
+	store.addImage("ci/frontend:c", 100, 24*time.Hour, 2*time.Hour)
+	store.addImage("ci/frontend:d", 100, 24*time.Hour, time.Hour)
+	store.addImage("ci/backend:a", 100, 24*time.Hour, 5*time.Hour)
+	store.addImage("myapp:a", 100, 24*time.Hour, 5*time.Hour)
+
+	r := New(store, deletingRegistry(t).URL, slog.Default(),
+		WithPolicy(src),
+		WithImmutability(tagPatterns(t, "v*")),
+		WithBatchSize(2),
+	)
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The immutable tag neither counts toward the two kept nor is reaped,
+	// and each repository is counted on its own.
+	want := []string{"ci/backend:a", "ci/frontend:c", "ci/frontend:d", "ci/frontend:v1.0.0", "myapp:a"}
+	if got := remaining(store); !slices.Equal(got, want) {
+		t.Errorf("remaining images = %v, want %v", got, want)
+	}
+	// Repositories without a keep_last rule are not read.
+	if slices.Contains(store.repoReads, "myapp") {
+		t.Errorf("expected myapp not to be read, read %v", store.repoReads)
+	}
+}
+
+func TestReapOnce_KeepLast_RuleImmutableOverridesPatterns(t *testing.T) {
+	src := loadPolicy(t, `
+rules:
+  - repository: "ci/*"
+    immutable: false
+    keep_last: 1
+`)
+
+	store := newMockStore()
+	store.addImage("ci/app:v1", 100, 24*time.Hour, 2*time.Hour)
+	store.addImage("ci/app:v2", 100, 24*time.Hour, time.Hour)
+
+	r := New(store, deletingRegistry(t).URL, slog.Default(),
+		WithPolicy(src),
+		WithImmutability(tagPatterns(t, "v*")),
+	)
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := remaining(store); !slices.Equal(got, []string{"ci/app:v2"}) {
+		t.Errorf("remaining images = %v, want [ci/app:v2]", got)
+	}
+}
+
+func TestReapOnce_KeepLast_PinnedNotCounted(t *testing.T) {
+	src := loadPolicy(t, "rules:\n  - repository: \"ci/*\"\n    keep_last: 1\n")
+
+	store := newMockStore()
+	store.addImage("ci/app:a", 100, 24*time.Hour, 3*time.Hour)
+	store.addImage("ci/app:b", 100, 24*time.Hour, 2*time.Hour)
+	store.addImage("ci/app:c", 100, 24*time.Hour, time.Hour)
+	store.pinned["ci/app:c"] = 0
+
+	r := New(store, deletingRegistry(t).URL, slog.Default(), WithPolicy(src))
+	if err := r.ReapOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := remaining(store); !slices.Equal(got, []string{"ci/app:b", "ci/app:c"}) {
+		t.Errorf("remaining images = %v, want [ci/app:b ci/app:c]", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/tamcore/ephemeron/internal/hooks"
+	"github.com/tamcore/ephemeron/internal/policy"
 	redisclient "github.com/tamcore/ephemeron/internal/redis"
 	"github.com/tamcore/ephemeron/internal/registry"
 )
@@ -18,6 +19,28 @@ type Runner struct {
 	defaultTTL time.Duration
 	maxTTL     time.Duration
 	logger     *slog.Logger
+
+	ttlAnnotationKeys []string
+	policy            *policy.Source
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithTTLAnnotations makes recovery read the TTL from the first of keys found
+// in the manifest annotations or image config labels, like the webhook
+// handler does for pushes.
+func WithTTLAnnotations(keys []string) Option {
+	return func(r *Runner) {
+		r.ttlAnnotationKeys = keys
+	}
+}
+
+// WithPolicy applies per-repository TTL rules to recovered images.
+func WithPolicy(src *policy.Source) Option {
+	return func(r *Runner) {
+		r.policy = src
+	}
 }
 
 // New creates a new recovery runner.
@@ -26,14 +49,19 @@ func New(
 	registry *registry.Client,
 	defaultTTL, maxTTL time.Duration,
 	logger *slog.Logger,
+	opts ...Option,
 ) *Runner {
-	return &Runner{
+	r := &Runner{
 		redis:      redis,
 		registry:   registry,
 		defaultTTL: defaultTTL,
 		maxTTL:     maxTTL,
 		logger:     logger,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Run scans the registry catalog, parses TTLs from tags, and re-populates
@@ -57,10 +85,23 @@ func (r *Runner) Run(ctx context.Context) error {
 		}
 
 		for _, tag := range tags {
-			ttl := hooks.ClampTTL(hooks.ParseTTL(tag), r.defaultTTL, r.maxTTL)
-			expiresAt := time.Now().Add(ttl)
 			imageWithTag := fmt.Sprintf("%s:%s", repo, tag)
 
+			eff := r.policy.Policy().Resolve(repo, tag, policy.Defaults{DefaultTTL: r.defaultTTL, MaxTTL: r.maxTTL})
+			if eff.NeverReap {
+				r.logger.Debug("image exempt by policy, not recovering", "image", imageWithTag, "rule", eff.Rule)
+				continue
+			}
+
+			ttl, keep := hooks.ResolveTTL(tag, r.annotations(ctx, repo, tag), r.ttlAnnotationKeys,
+				eff.DefaultTTL, eff.MaxTTL)
+			if keep {
+				r.logger.Debug("image kept by annotation, not recovering", "image", imageWithTag)
+				continue
+			}
+			ttl = eff.Bound(ttl)
+			expiresAt := time.Now().Add(ttl)
+
 			// Fetch manifest info - best effort
 			var sizeBytes int64
 			var digest string
@@ -103,6 +144,24 @@ func (r *Runner) Run(ctx context.Context) error {
 	return nil
 }
 
+// annotations fetches the annotations and labels of an image when TTL
+// annotation keys are configured. Failures fall back to the tag TTL.
+func (r *Runner) annotations(ctx context.Context, repo, tag string) map[string]string {
+	if len(r.ttlAnnotationKeys) == 0 {
+		return nil
+	}
+
+	annotations, err := r.registry.GetImageAnnotations(ctx, repo, tag)
+	if err != nil {
+		r.logger.Warn("failed to fetch annotations during recovery, using tag TTL",
+			"image", fmt.Sprintf("%s:%s", repo, tag),
+			"error", err,
+		)
+		return nil
+	}
+	return annotations
+}
+
 // RunIfNeeded checks whether Redis has been initialized. If not, it runs
 // recovery and marks Redis as initialized.
 func (r *Runner) RunIfNeeded(ctx context.Context) error {
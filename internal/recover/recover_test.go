@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
 	"github.com/tamcore/ephemeron/internal/registry"
 )
 
@@ -51,10 +52,48 @@ func (m *mockStore) ListImages(_ context.Context) ([]string, error) {
 	return keys, nil
 }
 
+func (m *mockStore) IsTracked(_ context.Context, imageWithTag string) (bool, error) {
+	_, ok := m.images[imageWithTag]
+	return ok, nil
+}
+
+func (m *mockStore) ListExpiredImages(_ context.Context, now time.Time, _, _ int64) ([]string, error) {
+	var out []string
+	for k, expiresAt := range m.images {
+		if !expiresAt.After(now) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) ListImagesByExpiryAfter(
+	context.Context, redisclient.ExpiryCursor, int64,
+) ([]redisclient.ExpiryCursor, error) {
+	return nil, nil
+}
+
+func (m *mockStore) ListImagesExpiringBetween(_ context.Context, from, to time.Time, _, _ int64) ([]string, error) {
+	var out []string
+	for k, expiresAt := range m.images {
+		if expiresAt.After(from) && !expiresAt.After(to) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
 func (m *mockStore) GetExpiry(_ context.Context, imageWithTag string) (int64, error) {
 	return m.images[imageWithTag].UnixMilli(), nil
 }
 
+func (m *mockStore) SetExpiry(_ context.Context, imageWithTag string, expiresAt time.Time) error {
+	m.images[imageWithTag] = expiresAt
+	return nil
+}
+
+func (m *mockStore) SetLastPulled(_ context.Context, _ string, _ time.Time) error { return nil }
+
 func (m *mockStore) GetImageSize(_ context.Context, imageWithTag string) (int64, error) {
 	return m.sizes[imageWithTag], nil
 }
@@ -67,16 +106,79 @@ func (m *mockStore) GetCreatedTimestamp(_ context.Context, imageWithTag string)
 	return m.created[imageWithTag], nil
 }
 
+func (m *mockStore) RemoveDigestTag(context.Context, string, string, string) error { return nil }
+
+func (m *mockStore) ListDigestTags(_ context.Context, _, _ string) ([]string, error) {
+	return nil, nil
+}
+
 func (m *mockStore) RemoveImage(_ context.Context, imageWithTag string) error {
 	delete(m.images, imageWithTag)
 	return nil
 }
 
-func (m *mockStore) AcquireReaperLock(_ context.Context, _ time.Duration) (bool, error) {
+func (m *mockStore) GetImage(context.Context, string) (redisclient.Image, error) {
+	return redisclient.Image{}, redisclient.ErrNotTracked
+}
+func (m *mockStore) PinImage(context.Context, string, time.Time) error { return nil }
+func (m *mockStore) UnpinImage(context.Context, string) error          { return nil }
+func (m *mockStore) IsPinned(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+func (m *mockStore) ClaimExpiryWarning(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) TagDigests(context.Context, string) ([]redisclient.TagDigest, error) {
+	return nil, nil
+}
+
+func (m *mockStore) AcquireReaperLock(context.Context, string, time.Duration) (int64, error) {
+	return 1, nil
+}
+
+func (m *mockStore) RenewReaperLock(context.Context, string, time.Duration) (bool, error) {
 	return true, nil
 }
 
-func (m *mockStore) ReleaseReaperLock(_ context.Context) error { return nil }
+func (m *mockStore) ReleaseReaperLock(context.Context, string) (bool, error) { return true, nil }
+
+func (m *mockStore) ReaperLockFence(context.Context) (int64, error) { return 1, nil }
+
+func (m *mockStore) RecordReapFailure(context.Context, string, string, time.Time, redisclient.RetryPolicy) (redisclient.ReapFailure, error) {
+	return redisclient.ReapFailure{}, nil
+}
+
+func (m *mockStore) IsReapDeferred(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) ListReapDeadLetters(context.Context) ([]string, error) { return nil, nil }
+
+func (m *mockStore) ReapDeadLetterCount(context.Context) (int64, error) { return 0, nil }
+
+func (m *mockStore) RetryReapDeadLetter(context.Context, string) error { return nil }
+
+func (m *mockStore) ListImagesByExpiry(context.Context, int64, int64) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ListImagesByCreated(context.Context, int64, int64) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ListRepositories(context.Context) ([]string, error) { return nil, nil }
+func (m *mockStore) ListRepoImagesByCreated(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+func (m *mockStore) ReapStates(context.Context, []string) ([]redisclient.Image, error) {
+	return nil, nil
+}
+func (m *mockStore) TrackedBytes(context.Context) (int64, error)         { return 0, nil }
+func (m *mockStore) RepoBytes(context.Context) (map[string]int64, error) { return nil, nil }
+
+func (m *mockStore) IsEventProcessed(context.Context, string) (bool, error)            { return false, nil }
+func (m *mockStore) MarkEventProcessed(context.Context, string, time.Duration) error   { return nil }
+func (m *mockStore) MarkRollback(context.Context, string, string, time.Duration) error { return nil }
+func (m *mockStore) ClaimRollback(context.Context, string, string) (bool, error)       { return false, nil }
 
 func (m *mockStore) IsInitialized(_ context.Context) (bool, error) {
 	return m.initialized, nil
@@ -2,19 +2,208 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 const (
-	imagesKey      = "current.images"
-	reaperLockKey  = "reaper.lock"
-	initializedKey = "ephemeron:initialized"
+	imagesKey       = "current.images"
+	expiryIndexKey  = "current.expiries"
+	createdIndexKey = "current.created"
+	initializedKey  = "ephemeron:initialized"
+
+	// storageBytesKey and repoBytesKey hold the summed size_bytes of all
+	// tracked images, in total and per repository.
+	storageBytesKey = "storage.bytes"
+	repoBytesKey    = "storage.repo_bytes"
+
+	// indexVersionKey records which secondary indexes have been built.
+	// Bump currentIndexVersion whenever MigrateIndexes learns a new index.
+	indexVersionKey     = "ephemeron:index_version"
+	currentIndexVersion = 3
+
+	// processedEventPrefix prefixes the markers of processed webhook event IDs.
+	processedEventPrefix = "hooks.processed:"
+
+	// rollbackPrefix prefixes the markers of immutable tag rollbacks in
+	// flight, keyed as hooks.rollback:<repo:tag>@<digest>.
+	rollbackPrefix = "hooks.rollback:"
+
+	// digestTagsPrefix prefixes the per-manifest sets of tracked tags,
+	// keyed as digest.tags:<repo>@<digest>.
+	digestTagsPrefix = "digest.tags:"
 )
 
+// ErrNotTracked is returned when updating an image that is not tracked.
+var ErrNotTracked = errors.New("image not tracked")
+
+// setExpiryScript updates the expiry of a tracked image in both the hash and
+// the expiry index, without recreating records the reaper already removed.
+var setExpiryScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'expires', ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[1], KEYS[2])
+return 1
+`)
+
+// setFieldsScript sets hash fields on a tracked image only.
+var setFieldsScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], unpack(ARGV))
+return 1
+`)
+
+// pinScript pins a tracked image, until ARGV[1] (Unix milliseconds) or
+// indefinitely when ARGV[1] is 0.
+var pinScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'pinned', '1')
+if ARGV[1] == '0' then
+	redis.call('HDEL', KEYS[2], 'pinned_until')
+else
+	redis.call('HSET', KEYS[2], 'pinned_until', ARGV[1])
+end
+return 1
+`)
+
+// unpinScript removes the pin of a tracked image.
+var unpinScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], 'pinned', 'pinned_until')
+return 1
+`)
+
+// expiryPageScript returns up to ARGV[3] entries of the expiry index, with
+// scores, that sort after member ARGV[2] at score ARGV[1]. While the member
+// is still at that score, the page starts right after its rank. Otherwise
+// the page starts with the remaining entries at that score that sort after
+// it, then continues at later scores.
+var expiryPageScript = redis.NewScript(`
+local limit = tonumber(ARGV[3])
+local score = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if score and tonumber(score) == tonumber(ARGV[1]) then
+	local rank = redis.call('ZRANK', KEYS[1], ARGV[2])
+	return redis.call('ZRANGE', KEYS[1], rank + 1, rank + limit, 'WITHSCORES')
+end
+local out = {}
+local ties = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1], 'WITHSCORES')
+for i = 1, #ties, 2 do
+	if ties[i] > ARGV[2] then
+		table.insert(out, ties[i])
+		table.insert(out, ties[i + 1])
+		if #out == limit * 2 then
+			return out
+		end
+	end
+end
+local rest = redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. ARGV[1], '+inf', 'WITHSCORES', 'LIMIT', 0, limit - #out / 2)
+for _, v in ipairs(rest) do
+	table.insert(out, v)
+end
+return out
+`)
+
+// claimWarningScript records that the expiry warning for expiry ARGV[1] of a
+// tracked image was sent. Returns 1 if this call claimed it, 0 if it was
+// already claimed and -1 if the image is not tracked.
+var claimWarningScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return -1
+end
+if redis.call('HGET', KEYS[2], 'warned') == ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'warned', ARGV[1])
+return 1
+`)
+
+// accountSizeScript adjusts the storage counters for an image whose size
+// becomes ARGV[2] (0 when it is removed). The previous size only counts if
+// the image is tracked, so concurrent removals cannot subtract it twice. It
+// must run in the same transaction as the write it accounts for.
+var accountSizeScript = redis.NewScript(`
+local old = 0
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 1 then
+	old = tonumber(redis.call('HGET', KEYS[2], 'size_bytes')) or 0
+end
+local delta = tonumber(ARGV[2]) - old
+if delta ~= 0 then
+	redis.call('INCRBY', KEYS[3], delta)
+	if redis.call('HINCRBY', KEYS[4], ARGV[1], delta) <= 0 then
+		redis.call('HDEL', KEYS[4], ARGV[1])
+	end
+end
+return delta
+`)
+
+// accountSize queues accountSizeScript on a transaction.
+func accountSize(ctx context.Context, tx redis.Pipeliner, imageWithTag string, sizeBytes int64) {
+	accountSizeScript.Eval(ctx, tx,
+		[]string{imagesKey, imageWithTag, storageBytesKey, repoBytesKey},
+		repoOf(imageWithTag), sizeBytes,
+	)
+}
+
+func digestTagsKey(repo, digest string) string {
+	return digestTagsPrefix + repo + "@" + digest
+}
+
+// repoOf returns the repository part of a repo:tag reference.
+func repoOf(imageWithTag string) string {
+	if i := strings.LastIndex(imageWithTag, ":"); i >= 0 {
+		return imageWithTag[:i]
+	}
+	return imageWithTag
+}
+
+// Image is the stored record of a tracked image. Unset timestamps are zero.
+type Image struct {
+	Name        string
+	Created     time.Time
+	Expires     time.Time
+	SizeBytes   int64
+	Digest      string
+	LastPulled  time.Time
+	Pinned      bool
+	PinnedUntil time.Time
+
+	// ReapFailures counts consecutive failed deletions, the last of which
+	// failed at LastReapFailure with LastReapError. The reaper leaves the
+	// image alone until RetryAt, or for good once it is DeadLettered.
+	ReapFailures    int64
+	LastReapError   string
+	LastReapFailure time.Time
+	RetryAt         time.Time
+	DeadLettered    time.Time
+}
+
+// PinnedAt reports whether the image is pinned at now.
+func (i Image) PinnedAt(now time.Time) bool {
+	return i.Pinned && (i.PinnedUntil.IsZero() || i.PinnedUntil.After(now))
+}
+
+// msTime converts a Unix milliseconds hash field, zero when unset.
+func msTime(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
 // Client wraps the Redis client with ephemeron-specific operations.
 type Client struct {
 	rdb *redis.Client
@@ -40,6 +229,11 @@ func (c *Client) Close() error {
 }
 
 // TrackImage adds an image to the tracking set and stores its expiry metadata.
+// A push clears the deletion failures of the image, taking it out of the
+// dead-letter set.
+// It also moves the tag between digest reference sets when the digest changed,
+// and adds the digest to the tag's digest history unless it is already the
+// latest entry.
 func (c *Client) TrackImage(
 	ctx context.Context,
 	imageWithTag string,
@@ -47,15 +241,49 @@ func (c *Client) TrackImage(
 	sizeBytes int64,
 	digest string,
 ) error {
-	pipe := c.rdb.Pipeline()
+	previousDigest, err := c.GetImageDigest(ctx, imageWithTag)
+	if err != nil {
+		return err
+	}
+	latestDigest, err := c.latestTagDigest(ctx, imageWithTag)
+	if err != nil {
+		return err
+	}
+
+	repo := repoOf(imageWithTag)
+	now := time.Now().UnixMilli()
+	pipe := c.rdb.TxPipeline()
+	if digest != "" {
+		if digest != latestDigest {
+			d := TagDigest{Digest: digest, PushedAt: time.UnixMilli(now), SizeBytes: sizeBytes}
+			if err := addTagDigest(ctx, pipe, imageWithTag, d); err != nil {
+				return err
+			}
+		}
+		pipe.Expire(ctx, tagDigestsKey(imageWithTag), tagDigestsRetention)
+	}
+	accountSize(ctx, pipe, imageWithTag, sizeBytes)
+	if previousDigest != "" && previousDigest != digest {
+		pipe.SRem(ctx, digestTagsKey(repo, previousDigest), imageWithTag)
+	}
+	if digest != "" {
+		pipe.SAdd(ctx, digestTagsKey(repo, digest), imageWithTag)
+	}
 	pipe.SAdd(ctx, imagesKey, imageWithTag)
+	resetReapFailures(ctx, pipe, imageWithTag)
 	pipe.HSet(ctx, imageWithTag,
-		"created", strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"created", strconv.FormatInt(now, 10),
 		"expires", strconv.FormatInt(expiresAt.UnixMilli(), 10),
 		"size_bytes", strconv.FormatInt(sizeBytes, 10),
 		"digest", digest,
 	)
-	_, err := pipe.Exec(ctx)
+	pipe.ZAdd(ctx, expiryIndexKey, redis.Z{
+		Score:  float64(expiresAt.UnixMilli()),
+		Member: imageWithTag,
+	})
+	pipe.ZAdd(ctx, createdIndexKey, redis.Z{Score: float64(now), Member: imageWithTag})
+	indexRepo(ctx, pipe, imageWithTag, now)
+	_, err = pipe.Exec(ctx)
 	return err
 }
 
@@ -64,15 +292,320 @@ func (c *Client) ListImages(ctx context.Context) ([]string, error) {
 	return c.rdb.SMembers(ctx, imagesKey).Result()
 }
 
+// IsTracked reports whether an image is in the tracking set.
+func (c *Client) IsTracked(ctx context.Context, imageWithTag string) (bool, error) {
+	return c.rdb.SIsMember(ctx, imagesKey, imageWithTag).Result()
+}
+
+// GetImage returns the record of a tracked image. Returns ErrNotTracked if
+// the image is not tracked.
+func (c *Client) GetImage(ctx context.Context, imageWithTag string) (Image, error) {
+	pipe := c.rdb.Pipeline()
+	tracked := pipe.SIsMember(ctx, imagesKey, imageWithTag)
+	fields := pipe.HGetAll(ctx, imageWithTag)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Image{}, err
+	}
+	if !tracked.Val() {
+		return Image{}, ErrNotTracked
+	}
+
+	f := fields.Val()
+	size, _ := strconv.ParseInt(f["size_bytes"], 10, 64)
+	img := Image{
+		Name:        imageWithTag,
+		Created:     msTime(f["created"]),
+		Expires:     msTime(f["expires"]),
+		SizeBytes:   size,
+		Digest:      f["digest"],
+		LastPulled:  msTime(f["last_pulled"]),
+		Pinned:      f["pinned"] == "1",
+		PinnedUntil: msTime(f["pinned_until"]),
+	}
+	parseReapFailures(&img, f)
+	return img, nil
+}
+
+// ListExpiredImages returns up to limit images whose expiry is at or before
+// now, ordered by expiry (oldest first). Offset skips entries at the head of
+// the index, e.g. images that already failed deletion in the current cycle.
+func (c *Client) ListExpiredImages(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	return c.rdb.ZRangeByScore(ctx, expiryIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    strconv.FormatInt(now.UnixMilli(), 10),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+}
+
+// ListImagesExpiringBetween returns up to limit images whose expiry is after
+// from and at or before to, ordered by expiry (soonest first).
+func (c *Client) ListImagesExpiringBetween(ctx context.Context, from, to time.Time, offset, limit int64) ([]string, error) {
+	return c.rdb.ZRangeByScore(ctx, expiryIndexKey, &redis.ZRangeBy{
+		Min:    "(" + strconv.FormatInt(from.UnixMilli(), 10),
+		Max:    strconv.FormatInt(to.UnixMilli(), 10),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+}
+
+// ListImagesByExpiry returns up to limit tracked images ordered by expiry,
+// soonest first.
+func (c *Client) ListImagesByExpiry(ctx context.Context, offset, limit int64) ([]string, error) {
+	return c.rdb.ZRange(ctx, expiryIndexKey, offset, offset+limit-1).Result()
+}
+
+// ExpiryCursor is a position in the expiry index: an image and its expiry in
+// Unix milliseconds. The zero value is the start of the index.
+type ExpiryCursor struct {
+	Image   string
+	Expires int64
+}
+
+// ListImagesByExpiryAfter returns up to limit entries of the expiry index
+// that sort after the cursor, by expiry and then name. Unlike an offset,
+// the cursor neither skips nor repeats entries when earlier ones are added
+// or removed between pages.
+func (c *Client) ListImagesByExpiryAfter(ctx context.Context, after ExpiryCursor, limit int64) ([]ExpiryCursor, error) {
+	if after.Image == "" {
+		entries, err := c.rdb.ZRangeWithScores(ctx, expiryIndexKey, 0, limit-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		out := make([]ExpiryCursor, 0, len(entries))
+		for _, z := range entries {
+			image, _ := z.Member.(string)
+			out = append(out, ExpiryCursor{Image: image, Expires: int64(z.Score)})
+		}
+		return out, nil
+	}
+
+	vals, err := expiryPageScript.Run(ctx, c.rdb, []string{expiryIndexKey},
+		after.Expires, after.Image, limit,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ExpiryCursor, 0, len(vals)/2)
+	for i := 0; i+1 < len(vals); i += 2 {
+		score, err := strconv.ParseFloat(vals[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing expiry of %s: %w", vals[i], err)
+		}
+		out = append(out, ExpiryCursor{Image: vals[i], Expires: int64(score)})
+	}
+	return out, nil
+}
+
+// ListImagesByCreated returns up to limit tracked images ordered by push
+// time, oldest first.
+func (c *Client) ListImagesByCreated(ctx context.Context, offset, limit int64) ([]string, error) {
+	return c.rdb.ZRange(ctx, createdIndexKey, offset, offset+limit-1).Result()
+}
+
+// TrackedBytes returns the summed size of all tracked images.
+func (c *Client) TrackedBytes(ctx context.Context) (int64, error) {
+	n, err := c.rdb.Get(ctx, storageBytesKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// RepoBytes returns the summed size of tracked images per repository.
+func (c *Client) RepoBytes(ctx context.Context) (map[string]int64, error) {
+	vals, err := c.rdb.HGetAll(ctx, repoBytesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(vals))
+	for repo, v := range vals {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		out[repo] = n
+	}
+	return out, nil
+}
+
+// MigrateIndexes rebuilds the secondary indexes (expiry and created
+// indexes, repository indexes, digest reference sets, storage counters)
+// from the per-image hashes when they were written by an older version. It
+// is a no-op once the stored index version is current. Returns the number of
+// images indexed.
+func (c *Client) MigrateIndexes(ctx context.Context) (int, error) {
+	version, err := c.rdb.Get(ctx, indexVersionKey).Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if version >= currentIndexVersion {
+		return 0, nil
+	}
+
+	images, err := c.rdb.SMembers(ctx, imagesKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(images))
+	for i, image := range images {
+		cmds[i] = pipe.HMGet(ctx, image, "expires", "digest", "size_bytes", "created")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var indexed int
+	var totalBytes int64
+	repoBytes := make(map[string]int64)
+	pipe = c.rdb.TxPipeline()
+	pipe.Del(ctx, storageBytesKey, repoBytesKey)
+	for i, image := range images {
+		vals := cmds[i].Val()
+		expiresStr, _ := vals[0].(string)
+		expires, err := strconv.ParseInt(expiresStr, 10, 64)
+		if err != nil {
+			// Missing or corrupt expiry: drop the record, as the reaper
+			// used to do when it came across one.
+			if err := c.RemoveImage(ctx, image); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		pipe.ZAdd(ctx, expiryIndexKey, redis.Z{Score: float64(expires), Member: image})
+		if digest, _ := vals[1].(string); digest != "" {
+			pipe.SAdd(ctx, digestTagsKey(repoOf(image), digest), image)
+		}
+		sizeStr, _ := vals[2].(string)
+		size, _ := strconv.ParseInt(sizeStr, 10, 64)
+		totalBytes += size
+		repoBytes[repoOf(image)] += size
+		createdStr, _ := vals[3].(string)
+		created, _ := strconv.ParseInt(createdStr, 10, 64)
+		pipe.ZAdd(ctx, createdIndexKey, redis.Z{Score: float64(created), Member: image})
+		indexRepo(ctx, pipe, image, created)
+		indexed++
+	}
+	pipe.Set(ctx, storageBytesKey, totalBytes, 0)
+	for repo, n := range repoBytes {
+		if n > 0 {
+			pipe.HSet(ctx, repoBytesKey, repo, n)
+		}
+	}
+	pipe.Set(ctx, indexVersionKey, currentIndexVersion, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return indexed, nil
+}
+
 // GetExpiry returns the expiry timestamp (in epoch milliseconds) for an image.
+// Returns ErrNotTracked if the image has no expiry.
 func (c *Client) GetExpiry(ctx context.Context, imageWithTag string) (int64, error) {
 	val, err := c.rdb.HGet(ctx, imageWithTag, "expires").Result()
+	if err == redis.Nil {
+		return 0, ErrNotTracked
+	}
 	if err != nil {
 		return 0, err
 	}
 	return strconv.ParseInt(val, 10, 64)
 }
 
+// SetExpiry moves the expiry of a tracked image. Returns ErrNotTracked if the
+// image is not tracked.
+func (c *Client) SetExpiry(ctx context.Context, imageWithTag string, expiresAt time.Time) error {
+	ok, err := setExpiryScript.Run(ctx, c.rdb,
+		[]string{imagesKey, imageWithTag, expiryIndexKey},
+		expiresAt.UnixMilli(),
+	).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotTracked
+	}
+	return nil
+}
+
+// SetLastPulled records when a tracked image was last pulled. Returns
+// ErrNotTracked if the image is not tracked.
+func (c *Client) SetLastPulled(ctx context.Context, imageWithTag string, pulledAt time.Time) error {
+	return c.setFields(ctx, imageWithTag, "last_pulled", strconv.FormatInt(pulledAt.UnixMilli(), 10))
+}
+
+// PinImage exempts a tracked image from reaping until the given time, or
+// indefinitely when until is zero. Returns ErrNotTracked if the image is not
+// tracked.
+func (c *Client) PinImage(ctx context.Context, imageWithTag string, until time.Time) error {
+	var untilMs int64
+	if !until.IsZero() {
+		untilMs = until.UnixMilli()
+	}
+	return c.runTracked(ctx, pinScript, imageWithTag, strconv.FormatInt(untilMs, 10))
+}
+
+// UnpinImage removes the pin of a tracked image. Returns ErrNotTracked if
+// the image is not tracked.
+func (c *Client) UnpinImage(ctx context.Context, imageWithTag string) error {
+	return c.runTracked(ctx, unpinScript, imageWithTag)
+}
+
+// IsPinned reports whether an image is pinned at now. A pin whose expiry has
+// passed no longer counts.
+func (c *Client) IsPinned(ctx context.Context, imageWithTag string, now time.Time) (bool, error) {
+	vals, err := c.rdb.HMGet(ctx, imageWithTag, "pinned", "pinned_until").Result()
+	if err != nil {
+		return false, err
+	}
+	pinned, _ := vals[0].(string)
+	until, _ := vals[1].(string)
+	return Image{Pinned: pinned == "1", PinnedUntil: msTime(until)}.PinnedAt(now), nil
+}
+
+// ClaimExpiryWarning atomically marks the expiry warning for expiresAt as
+// sent and reports whether this call claimed it, so only one replica warns
+// per expiry. Extending an image changes its expiry and re-arms the warning.
+// Returns ErrNotTracked if the image is not tracked.
+func (c *Client) ClaimExpiryWarning(ctx context.Context, imageWithTag string, expiresAt time.Time) (bool, error) {
+	n, err := claimWarningScript.Run(ctx, c.rdb,
+		[]string{imagesKey, imageWithTag},
+		strconv.FormatInt(expiresAt.UnixMilli(), 10),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 {
+		return false, ErrNotTracked
+	}
+	return n == 1, nil
+}
+
+// runTracked runs a script that only acts on tracked images and reports
+// ErrNotTracked when it did not.
+func (c *Client) runTracked(ctx context.Context, script *redis.Script, imageWithTag string, args ...any) error {
+	ok, err := script.Run(ctx, c.rdb, []string{imagesKey, imageWithTag}, args...).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotTracked
+	}
+	return nil
+}
+
+// setFields sets hash fields on a tracked image.
+func (c *Client) setFields(ctx context.Context, imageWithTag string, fieldsAndValues ...string) error {
+	args := make([]any, len(fieldsAndValues))
+	for i, v := range fieldsAndValues {
+		args[i] = v
+	}
+	return c.runTracked(ctx, setFieldsScript, imageWithTag, args...)
+}
+
 // GetImageSize returns the size in bytes for an image.
 // Returns 0 for missing field (backward compatibility with old records).
 func (c *Client) GetImageSize(ctx context.Context, imageWithTag string) (int64, error) {
@@ -110,24 +643,65 @@ func (c *Client) GetCreatedTimestamp(ctx context.Context, imageWithTag string) (
 	return strconv.ParseInt(val, 10, 64)
 }
 
+// ListDigestTags returns the tracked tags (as repo:tag) in repo that
+// currently point at digest.
+func (c *Client) ListDigestTags(ctx context.Context, repo, digest string) ([]string, error) {
+	return c.rdb.SMembers(ctx, digestTagsKey(repo, digest)).Result()
+}
+
+// RemoveDigestTag removes a tag from the set of tags pointing at digest,
+// e.g. when it was left behind by an image removed without its digest.
+func (c *Client) RemoveDigestTag(ctx context.Context, repo, digest, imageWithTag string) error {
+	return c.rdb.SRem(ctx, digestTagsKey(repo, digest), imageWithTag).Err()
+}
+
 // RemoveImage removes an image from the tracking set and deletes its metadata.
 func (c *Client) RemoveImage(ctx context.Context, imageWithTag string) error {
-	pipe := c.rdb.Pipeline()
+	digest, err := c.GetImageDigest(ctx, imageWithTag)
+	if err != nil {
+		return err
+	}
+
+	pipe := c.rdb.TxPipeline()
+	accountSize(ctx, pipe, imageWithTag, 0)
+	if digest != "" {
+		pipe.SRem(ctx, digestTagsKey(repoOf(imageWithTag), digest), imageWithTag)
+	}
 	pipe.SRem(ctx, imagesKey, imageWithTag)
+	pipe.ZRem(ctx, expiryIndexKey, imageWithTag)
+	pipe.ZRem(ctx, createdIndexKey, imageWithTag)
+	unindexRepo(ctx, pipe, imageWithTag)
+	pipe.ZRem(ctx, reapDeadLetterKey, imageWithTag)
 	pipe.Del(ctx, imageWithTag)
-	_, err := pipe.Exec(ctx)
+	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// AcquireReaperLock attempts to acquire a distributed lock for the reaper.
-// Returns true if the lock was acquired. The lock auto-expires after the given TTL.
-func (c *Client) AcquireReaperLock(ctx context.Context, ttl time.Duration) (bool, error) {
-	return c.rdb.SetNX(ctx, reaperLockKey, "locked", ttl).Result()
+// IsEventProcessed reports whether a webhook event ID was already processed.
+func (c *Client) IsEventProcessed(ctx context.Context, id string) (bool, error) {
+	n, err := c.rdb.Exists(ctx, processedEventPrefix+id).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MarkEventProcessed records a webhook event ID as processed for retention.
+func (c *Client) MarkEventProcessed(ctx context.Context, id string, retention time.Duration) error {
+	return c.rdb.Set(ctx, processedEventPrefix+id, "1", retention).Err()
+}
+
+// MarkRollback records that imageWithTag is about to be restored to digest,
+// so the push event of the restore can be recognised for ttl.
+func (c *Client) MarkRollback(ctx context.Context, imageWithTag, digest string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, rollbackPrefix+imageWithTag+"@"+digest, "1", ttl).Err()
 }
 
-// ReleaseReaperLock releases the distributed reaper lock.
-func (c *Client) ReleaseReaperLock(ctx context.Context) error {
-	return c.rdb.Del(ctx, reaperLockKey).Err()
+// ClaimRollback consumes the rollback marker of imageWithTag at digest and
+// reports whether it was present.
+func (c *Client) ClaimRollback(ctx context.Context, imageWithTag, digest string) (bool, error) {
+	n, err := c.rdb.Del(ctx, rollbackPrefix+imageWithTag+"@"+digest).Result()
+	return n == 1, err
 }
 
 // IsInitialized checks if ephemeron has been initialized (i.e. Redis has been populated).
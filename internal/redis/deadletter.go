@@ -0,0 +1,19 @@
+package redis
+
+import "context"
+
+const (
+	// deadLetterKey is a list of notifications that could not be delivered,
+	// newest first, capped at deadLetterLimit entries.
+	deadLetterKey   = "notify.deadletter"
+	deadLetterLimit = 10000
+)
+
+// AddDeadLetter records an undeliverable notification.
+func (c *Client) AddDeadLetter(ctx context.Context, record []byte) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.LPush(ctx, deadLetterKey, record)
+	pipe.LTrim(ctx, deadLetterKey, 0, deadLetterLimit-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// tagDigestsPrefix prefixes the per-tag digest histories, keyed as
+	// tag.digests:<repo:tag>. They are kept after the image is reaped.
+	tagDigestsPrefix = "tag.digests:"
+
+	// tagDigestsLimit caps the digests remembered per tag.
+	tagDigestsLimit = 20
+
+	// tagDigestsRetention is how long a tag's digest history is kept after
+	// its last push.
+	tagDigestsRetention = 30 * 24 * time.Hour
+)
+
+// TagDigest is one digest a tag pointed at.
+type TagDigest struct {
+	Digest string `json:"digest"`
+	// PushedAt is when the tag moved to this digest. Re-pushes of the same
+	// digest do not update it.
+	PushedAt  time.Time `json:"pushed_at"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+func tagDigestsKey(imageWithTag string) string {
+	return tagDigestsPrefix + imageWithTag
+}
+
+// latestTagDigest returns the digest at the head of a tag's history, empty
+// when there is none.
+func (c *Client) latestTagDigest(ctx context.Context, imageWithTag string) (string, error) {
+	raw, err := c.rdb.LIndex(ctx, tagDigestsKey(imageWithTag), 0).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var d TagDigest
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return "", nil
+	}
+	return d.Digest, nil
+}
+
+// addTagDigest queues prepending digest to a tag's history on a transaction.
+func addTagDigest(ctx context.Context, tx redis.Pipeliner, imageWithTag string, d TagDigest) error {
+	entry, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	key := tagDigestsKey(imageWithTag)
+	tx.LPush(ctx, key, entry)
+	tx.LTrim(ctx, key, 0, tagDigestsLimit-1)
+	return nil
+}
+
+// TagDigests returns the digests a tag pointed at, newest first. The first
+// entry is the current digest unless the tag was since pushed without one.
+func (c *Client) TagDigests(ctx context.Context, imageWithTag string) ([]TagDigest, error) {
+	raw, err := c.rdb.LRange(ctx, tagDigestsKey(imageWithTag), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	digests := make([]TagDigest, 0, len(raw))
+	for _, s := range raw {
+		var d TagDigest
+		if err := json.Unmarshal([]byte(s), &d); err != nil {
+			continue
+		}
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reapDeadLetterKey is a sorted set of images that failed deletion too
+// often to be retried automatically, scored by when they were moved there.
+const reapDeadLetterKey = "reaper.deadletter"
+
+// reapFailureFields are the image hash fields tracking failed deletions.
+var reapFailureFields = []string{"reap_failures", "reap_error", "reap_failed", "reap_retry", "dead_lettered"}
+
+// ErrNotDeadLettered is returned when retrying an image that is not in the
+// dead-letter set.
+var ErrNotDeadLettered = errors.New("image not dead-lettered")
+
+// RetryPolicy decides when an image that failed deletion is retried.
+type RetryPolicy struct {
+	// Backoff is the delay after the first failure, doubled with every
+	// further failure up to MaxBackoff. Zero retries every cycle.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxFailures moves an image to the dead-letter set once it failed
+	// this many times in a row. Zero never dead-letters.
+	MaxFailures int
+}
+
+// ReapFailure is the outcome of recording a failed deletion.
+type ReapFailure struct {
+	Failures     int64
+	RetryAt      time.Time // zero when retried next cycle or dead-lettered
+	DeadLettered bool
+}
+
+// recordFailureScript counts a failed deletion of a tracked image and either
+// schedules the next attempt or moves it to the dead-letter set. Returns
+// {failures, dead-lettered, retry at} or {0, 0, 0} if the image is not
+// tracked.
+var recordFailureScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return {0, 0, 0}
+end
+local now = tonumber(ARGV[1])
+local n = redis.call('HINCRBY', KEYS[2], 'reap_failures', 1)
+redis.call('HSET', KEYS[2], 'reap_error', ARGV[2], 'reap_failed', ARGV[1])
+local maxFailures = tonumber(ARGV[5])
+if maxFailures > 0 and n >= maxFailures then
+	redis.call('HDEL', KEYS[2], 'reap_retry')
+	redis.call('HSET', KEYS[2], 'dead_lettered', ARGV[1])
+	redis.call('ZADD', KEYS[3], now, KEYS[2])
+	return {n, 1, 0}
+end
+local backoff = tonumber(ARGV[3])
+if backoff <= 0 then
+	return {n, 0, 0}
+end
+local retry = now + math.min(backoff * 2 ^ math.min(n - 1, 40), tonumber(ARGV[4]))
+redis.call('HSET', KEYS[2], 'reap_retry', string.format('%d', retry))
+return {n, 0, retry}
+`)
+
+// retryReapDeadLetterScript takes a tracked image out of the dead-letter set
+// and clears its failures. Returns 1 on success, 0 if it is not
+// dead-lettered and -1 if it is not tracked.
+var retryReapDeadLetterScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], KEYS[2]) == 0 then
+	return -1
+end
+if redis.call('ZREM', KEYS[3], KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], unpack(ARGV))
+return 1
+`)
+
+// RecordReapFailure counts a failed deletion of a tracked image with the
+// error that caused it, and schedules the next attempt under p or moves the
+// image to the dead-letter set. Returns ErrNotTracked if the image is not
+// tracked.
+func (c *Client) RecordReapFailure(ctx context.Context, imageWithTag, reapErr string, now time.Time, p RetryPolicy) (ReapFailure, error) {
+	vals, err := recordFailureScript.Run(ctx, c.rdb,
+		[]string{imagesKey, imageWithTag, reapDeadLetterKey},
+		now.UnixMilli(), reapErr,
+		p.Backoff.Milliseconds(), max(p.MaxBackoff, p.Backoff).Milliseconds(), p.MaxFailures,
+	).Int64Slice()
+	if err != nil {
+		return ReapFailure{}, err
+	}
+	if vals[0] == 0 {
+		return ReapFailure{}, ErrNotTracked
+	}
+	f := ReapFailure{Failures: vals[0], DeadLettered: vals[1] == 1}
+	if vals[2] > 0 {
+		f.RetryAt = time.UnixMilli(vals[2])
+	}
+	return f, nil
+}
+
+// IsReapDeferred reports whether the reaper should leave an image alone at
+// now, because it is backing off after a failed deletion or dead-lettered.
+func (c *Client) IsReapDeferred(ctx context.Context, imageWithTag string, now time.Time) (bool, error) {
+	vals, err := c.rdb.HMGet(ctx, imageWithTag, "reap_retry", "dead_lettered").Result()
+	if err != nil {
+		return false, err
+	}
+	retry, _ := vals[0].(string)
+	deadLettered, _ := vals[1].(string)
+	return Image{RetryAt: msTime(retry), DeadLettered: msTime(deadLettered)}.DeferredAt(now), nil
+}
+
+// ListReapDeadLetters returns the dead-lettered images, oldest first.
+func (c *Client) ListReapDeadLetters(ctx context.Context) ([]string, error) {
+	return c.rdb.ZRange(ctx, reapDeadLetterKey, 0, -1).Result()
+}
+
+// ReapDeadLetterCount returns the number of dead-lettered images.
+func (c *Client) ReapDeadLetterCount(ctx context.Context) (int64, error) {
+	return c.rdb.ZCard(ctx, reapDeadLetterKey).Result()
+}
+
+// RetryReapDeadLetter takes an image out of the dead-letter set and clears its
+// failures, so the next reap cycle tries to delete it again if it expired.
+// Returns ErrNotTracked if the image is not tracked and ErrNotDeadLettered
+// if it is not dead-lettered.
+func (c *Client) RetryReapDeadLetter(ctx context.Context, imageWithTag string) error {
+	args := make([]any, len(reapFailureFields))
+	for i, f := range reapFailureFields {
+		args[i] = f
+	}
+	n, err := retryReapDeadLetterScript.Run(ctx, c.rdb,
+		[]string{imagesKey, imageWithTag, reapDeadLetterKey}, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case -1:
+		return ErrNotTracked
+	case 0:
+		return ErrNotDeadLettered
+	}
+	return nil
+}
+
+// resetReapFailures queues clearing the failures of an image on a
+// transaction, e.g. when it is pushed again.
+func resetReapFailures(ctx context.Context, tx redis.Pipeliner, imageWithTag string) {
+	tx.HDel(ctx, imageWithTag, reapFailureFields...)
+	tx.ZRem(ctx, reapDeadLetterKey, imageWithTag)
+}
+
+// parseReapFailures fills the failure fields of an image record.
+func parseReapFailures(img *Image, f map[string]string) {
+	img.ReapFailures, _ = strconv.ParseInt(f["reap_failures"], 10, 64)
+	img.LastReapError = f["reap_error"]
+	img.LastReapFailure = msTime(f["reap_failed"])
+	img.RetryAt = msTime(f["reap_retry"])
+	img.DeadLettered = msTime(f["dead_lettered"])
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// historyKeyPrefix prefixes the per-image history streams. Tags cannot
+// contain a colon, so "audit:<repo:tag>" never collides with an image key.
+const historyKeyPrefix = "audit:"
+
+func historyKey(imageWithTag string) string {
+	return historyKeyPrefix + imageWithTag
+}
+
+// AppendHistory appends an entry to the history stream of an image. Entries
+// older than retention are trimmed, and the stream expires retention after
+// its last entry, so the history of a reaped image outlives its record by
+// that long.
+func (c *Client) AppendHistory(ctx context.Context, imageWithTag string, entry []byte, retention time.Duration) error {
+	key := historyKey(imageWithTag)
+	minID := time.Now().Add(-retention).UnixMilli()
+
+	pipe := c.rdb.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MinID:  strconv.FormatInt(minID, 10),
+		Approx: true,
+		Values: map[string]any{"entry": entry},
+	})
+	pipe.Expire(ctx, key, retention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ImageHistory returns up to limit of the newest history entries of an
+// image, oldest first. An image without history returns no entries.
+func (c *Client) ImageHistory(ctx context.Context, imageWithTag string, limit int64) ([][]byte, error) {
+	msgs, err := c.rdb.XRevRangeN(ctx, historyKey(imageWithTag), "+", "-", limit).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		if s, ok := msg.Values["entry"].(string); ok {
+			entries = append(entries, []byte(s))
+		}
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// reaperLockKey holds the owner token of the replica running the reaper.
+	reaperLockKey = "reaper.lock"
+
+	// reaperFenceKey counts reaper lock acquisitions. Each holder gets the
+	// value after its acquisition as fencing token, so a holder whose lock
+	// expired sees a higher value once another replica took over.
+	reaperFenceKey = "reaper.lock.fence"
+)
+
+// acquireLockScript sets the lock to owner ARGV[1] for ARGV[2] milliseconds
+// if it is free and returns the new fencing token, or 0 if it is held.
+var acquireLockScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+return redis.call('INCR', KEYS[2])
+`)
+
+// renewLockScript extends the lock to ARGV[2] milliseconds if ARGV[1] still
+// owns it.
+var renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`)
+
+// releaseLockScript deletes the lock if ARGV[1] still owns it.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// AcquireReaperLock takes the reaper lock for owner, a token unique to the
+// caller, if no one holds it. It returns the fencing token of the new lease,
+// or 0 if another owner holds the lock. The lock expires after ttl unless
+// renewed.
+func (c *Client) AcquireReaperLock(ctx context.Context, owner string, ttl time.Duration) (int64, error) {
+	return acquireLockScript.Run(ctx, c.rdb, []string{reaperLockKey, reaperFenceKey},
+		owner, ttl.Milliseconds()).Int64()
+}
+
+// RenewReaperLock extends the reaper lock to ttl from now. It reports false
+// if owner no longer holds the lock.
+func (c *Client) RenewReaperLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLockScript.Run(ctx, c.rdb, []string{reaperLockKey}, owner, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+// ReleaseReaperLock releases the reaper lock if owner still holds it, and
+// reports whether it did. A lock taken over by another owner is left alone.
+func (c *Client) ReleaseReaperLock(ctx context.Context, owner string) (bool, error) {
+	n, err := releaseLockScript.Run(ctx, c.rdb, []string{reaperLockKey}, owner).Int64()
+	return n == 1, err
+}
+
+// ReaperLockFence returns the fencing token of the latest reaper lock
+// acquisition. A holder whose token is lower has lost the lock.
+func (c *Client) ReaperLockFence(ctx context.Context) (int64, error) {
+	n, err := c.rdb.Get(ctx, reaperFenceKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,230 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	eventStreamKey  = "hooks.events"
+	eventGroup      = "hooks"
+	eventPayloadKey = "event"
+)
+
+// QueuedEvent is a webhook event read from the event stream.
+type QueuedEvent struct {
+	// ID is the stream entry ID, used to acknowledge the event.
+	ID string
+	// Payload is the JSON-encoded registry event.
+	Payload []byte
+	// EnqueuedAt is derived from the stream entry ID.
+	EnqueuedAt time.Time
+	// Deliveries is how many times the event has been delivered, including
+	// this one. Only known for reclaimed events; 1 for fresh reads.
+	Deliveries int64
+}
+
+// QueueStats describes the backlog of the event stream.
+type QueueStats struct {
+	// Pending is the number of events delivered but not yet acknowledged.
+	Pending int64
+	// Lag is the number of events not yet delivered to any worker.
+	Lag int64
+}
+
+// EnsureEventGroup creates the event stream and its consumer group if they
+// do not exist yet.
+func (c *Client) EnsureEventGroup(ctx context.Context) error {
+	err := c.rdb.XGroupCreateMkStream(ctx, eventStreamKey, eventGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// EnqueueEvents appends events to the event stream in a single round trip.
+// The stream is not capped, so unacknowledged events are never trimmed; see
+// TrimEvents.
+func (c *Client) EnqueueEvents(ctx context.Context, payloads [][]byte) error {
+	pipe := c.rdb.Pipeline()
+	for _, payload := range payloads {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: eventStreamKey,
+			Values: []any{eventPayloadKey, payload},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ReadEvents reads up to count new events for consumer, blocking for up to
+// block when none are available.
+func (c *Client) ReadEvents(
+	ctx context.Context, consumer string, count int64, block time.Duration,
+) ([]QueuedEvent, error) {
+	streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    eventGroup,
+		Consumer: consumer,
+		Streams:  []string{eventStreamKey, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []QueuedEvent
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			events = append(events, toQueuedEvent(msg, 1))
+		}
+	}
+	return events, nil
+}
+
+// ClaimStaleEvents transfers up to count events that have been pending for
+// longer than minIdle (failed or owned by a crashed worker) to consumer.
+func (c *Client) ClaimStaleEvents(
+	ctx context.Context, consumer string, minIdle time.Duration, count int64,
+) ([]QueuedEvent, error) {
+	msgs, _, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   eventStreamKey,
+		Group:    eventGroup,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed lookup only loses the delivery counts; the events are still
+	// handed out as first deliveries.
+	deliveries, _ := c.deliveryCounts(ctx, consumer, msgs)
+
+	events := make([]QueuedEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		n, ok := deliveries[msg.ID]
+		if !ok {
+			n = 1
+		}
+		events = append(events, toQueuedEvent(msg, n))
+	}
+	return events, nil
+}
+
+// deliveryCounts returns the delivery counts of events just claimed by
+// consumer, keyed by entry ID. The claimed entries come back in ID order, so
+// one XPENDING over their range normally covers them all; it pages on only
+// when the consumer holds further entries inside that range.
+func (c *Client) deliveryCounts(ctx context.Context, consumer string, msgs []redis.XMessage) (map[string]int64, error) {
+	counts := make(map[string]int64, len(msgs))
+	if len(msgs) == 0 {
+		return counts, nil
+	}
+	claimed := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		claimed[msg.ID] = true
+	}
+
+	start, end := msgs[0].ID, msgs[len(msgs)-1].ID
+	for {
+		pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   eventStreamKey,
+			Group:    eventGroup,
+			Start:    start,
+			End:      end,
+			Count:    int64(len(msgs)),
+			Consumer: consumer,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pending {
+			if claimed[p.ID] {
+				counts[p.ID] = p.RetryCount
+			}
+		}
+		if len(pending) < len(msgs) || len(counts) == len(msgs) {
+			return counts, nil
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+}
+
+// AckEvent acknowledges an event so it is not redelivered.
+func (c *Client) AckEvent(ctx context.Context, id string) error {
+	return c.rdb.XAck(ctx, eventStreamKey, eventGroup, id).Err()
+}
+
+// TrimEvents removes acknowledged events from the event stream. Entries older
+// than both the oldest pending event and the last delivered one have been
+// acknowledged and are dropped; everything else is kept.
+func (c *Client) TrimEvents(ctx context.Context) error {
+	groups, err := c.rdb.XInfoGroups(ctx, eventStreamKey).Result()
+	if err != nil {
+		return err
+	}
+	minID := ""
+	for _, g := range groups {
+		if g.Name == eventGroup {
+			minID = g.LastDeliveredID
+		}
+	}
+	if minID == "" || minID == "0-0" {
+		return nil
+	}
+
+	pending, err := c.rdb.XPending(ctx, eventStreamKey, eventGroup).Result()
+	if err != nil {
+		return err
+	}
+	if pending.Count > 0 {
+		minID = pending.Lower
+	}
+	return c.rdb.XTrimMinIDApprox(ctx, eventStreamKey, minID, 0).Err()
+}
+
+// EventQueueStats returns the pending count and lag of the consumer group.
+func (c *Client) EventQueueStats(ctx context.Context) (QueueStats, error) {
+	groups, err := c.rdb.XInfoGroups(ctx, eventStreamKey).Result()
+	if err != nil {
+		return QueueStats{}, err
+	}
+	for _, g := range groups {
+		if g.Name == eventGroup {
+			return QueueStats{Pending: g.Pending, Lag: g.Lag}, nil
+		}
+	}
+	return QueueStats{}, fmt.Errorf("consumer group %s not found", eventGroup)
+}
+
+func toQueuedEvent(msg redis.XMessage, deliveries int64) QueuedEvent {
+	var payload []byte
+	if v, ok := msg.Values[eventPayloadKey].(string); ok {
+		payload = []byte(v)
+	}
+
+	var enqueuedAt time.Time
+	if ms, _, ok := strings.Cut(msg.ID, "-"); ok {
+		if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			enqueuedAt = time.UnixMilli(n)
+		}
+	}
+
+	return QueuedEvent{
+		ID:         msg.ID,
+		Payload:    payload,
+		EnqueuedAt: enqueuedAt,
+		Deliveries: deliveries,
+	}
+}
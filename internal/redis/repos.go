@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// reposKey is the set of repositories with tracked images.
+	reposKey = "current.repos"
+
+	// repoCreatedPrefix prefixes the per-repository indexes of tracked
+	// images by push time, keyed as repo.created:<repo>.
+	repoCreatedPrefix = "repo.created:"
+)
+
+// removeFromRepoScript removes an image from its repository's push time
+// index, and the repository from the repository set once it has no images
+// left. It must run in the same transaction as the removal.
+var removeFromRepoScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+if redis.call('ZCARD', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+func repoCreatedKey(repo string) string {
+	return repoCreatedPrefix + repo
+}
+
+// indexRepo queues adding an image pushed at createdMs to its repository's
+// index on a transaction.
+func indexRepo(ctx context.Context, tx redis.Pipeliner, imageWithTag string, createdMs int64) {
+	repo := repoOf(imageWithTag)
+	tx.SAdd(ctx, reposKey, repo)
+	tx.ZAdd(ctx, repoCreatedKey(repo), redis.Z{Score: float64(createdMs), Member: imageWithTag})
+}
+
+// unindexRepo queues removeFromRepoScript on a transaction.
+func unindexRepo(ctx context.Context, tx redis.Pipeliner, imageWithTag string) {
+	repo := repoOf(imageWithTag)
+	removeFromRepoScript.Eval(ctx, tx, []string{repoCreatedKey(repo), reposKey}, imageWithTag, repo)
+}
+
+// ListRepositories returns the repositories with tracked images.
+func (c *Client) ListRepositories(ctx context.Context) ([]string, error) {
+	return c.rdb.SMembers(ctx, reposKey).Result()
+}
+
+// ListRepoImagesByCreated returns the tracked images of a repository,
+// ordered by push time (oldest first).
+func (c *Client) ListRepoImagesByCreated(ctx context.Context, repo string) ([]string, error) {
+	return c.rdb.ZRange(ctx, repoCreatedKey(repo), 0, -1).Result()
+}
+
+// ReapStates returns the expiry, pin and deletion failure fields of images
+// in one round trip, in the order given. Untracked images come back with
+// only their name set.
+func (c *Client) ReapStates(ctx context.Context, images []string) ([]Image, error) {
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(images))
+	for i, image := range images {
+		cmds[i] = pipe.HMGet(ctx, image, "expires", "pinned", "pinned_until", "reap_retry", "dead_lettered")
+	}
+	if len(images) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Image, len(images))
+	for i, image := range images {
+		vals := cmds[i].Val()
+		field := func(n int) string {
+			s, _ := vals[n].(string)
+			return s
+		}
+		out[i] = Image{
+			Name:         image,
+			Expires:      msTime(field(0)),
+			Pinned:       field(1) == "1",
+			PinnedUntil:  msTime(field(2)),
+			RetryAt:      msTime(field(3)),
+			DeadLettered: msTime(field(4)),
+		}
+	}
+	return out, nil
+}
+
+// DeferredAt reports whether the reaper leaves the image alone at now,
+// because it is backing off after a failed deletion or dead-lettered.
+func (i Image) DeferredAt(now time.Time) bool {
+	return !i.DeadLettered.IsZero() || i.RetryAt.After(now)
+}
@@ -11,14 +11,57 @@ type Store interface {
 	Close() error
 	TrackImage(ctx context.Context, imageWithTag string, expiresAt time.Time, sizeBytes int64, digest string) error
 	ListImages(ctx context.Context) ([]string, error)
+	IsTracked(ctx context.Context, imageWithTag string) (bool, error)
+	GetImage(ctx context.Context, imageWithTag string) (Image, error)
+	ListExpiredImages(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+	ListImagesExpiringBetween(ctx context.Context, from, to time.Time, offset, limit int64) ([]string, error)
+	ListImagesByExpiry(ctx context.Context, offset, limit int64) ([]string, error)
+	ListImagesByExpiryAfter(ctx context.Context, after ExpiryCursor, limit int64) ([]ExpiryCursor, error)
+	ListImagesByCreated(ctx context.Context, offset, limit int64) ([]string, error)
+	ListRepositories(ctx context.Context) ([]string, error)
+	ListRepoImagesByCreated(ctx context.Context, repo string) ([]string, error)
+	ReapStates(ctx context.Context, images []string) ([]Image, error)
+	TrackedBytes(ctx context.Context) (int64, error)
+	RepoBytes(ctx context.Context) (map[string]int64, error)
 	GetExpiry(ctx context.Context, imageWithTag string) (int64, error)
+	SetExpiry(ctx context.Context, imageWithTag string, expiresAt time.Time) error
+	SetLastPulled(ctx context.Context, imageWithTag string, pulledAt time.Time) error
 	GetImageSize(ctx context.Context, imageWithTag string) (int64, error)
 	GetImageDigest(ctx context.Context, imageWithTag string) (string, error)
 	GetCreatedTimestamp(ctx context.Context, imageWithTag string) (int64, error)
+	ListDigestTags(ctx context.Context, repo, digest string) ([]string, error)
+	RemoveDigestTag(ctx context.Context, repo, digest, imageWithTag string) error
+	TagDigests(ctx context.Context, imageWithTag string) ([]TagDigest, error)
 	RemoveImage(ctx context.Context, imageWithTag string) error
-	AcquireReaperLock(ctx context.Context, ttl time.Duration) (bool, error)
-	ReleaseReaperLock(ctx context.Context) error
+	PinImage(ctx context.Context, imageWithTag string, until time.Time) error
+	UnpinImage(ctx context.Context, imageWithTag string) error
+	IsPinned(ctx context.Context, imageWithTag string, now time.Time) (bool, error)
+	ClaimExpiryWarning(ctx context.Context, imageWithTag string, expiresAt time.Time) (bool, error)
+	RecordReapFailure(ctx context.Context, imageWithTag, reapErr string, now time.Time, p RetryPolicy) (ReapFailure, error)
+	IsReapDeferred(ctx context.Context, imageWithTag string, now time.Time) (bool, error)
+	ListReapDeadLetters(ctx context.Context) ([]string, error)
+	ReapDeadLetterCount(ctx context.Context) (int64, error)
+	RetryReapDeadLetter(ctx context.Context, imageWithTag string) error
+	AcquireReaperLock(ctx context.Context, owner string, ttl time.Duration) (int64, error)
+	RenewReaperLock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	ReleaseReaperLock(ctx context.Context, owner string) (bool, error)
+	ReaperLockFence(ctx context.Context) (int64, error)
+	IsEventProcessed(ctx context.Context, id string) (bool, error)
+	MarkEventProcessed(ctx context.Context, id string, retention time.Duration) error
+	MarkRollback(ctx context.Context, imageWithTag, digest string, ttl time.Duration) error
+	ClaimRollback(ctx context.Context, imageWithTag, digest string) (bool, error)
 	IsInitialized(ctx context.Context) (bool, error)
 	SetInitialized(ctx context.Context) error
 	ImageCount(ctx context.Context) (int64, error)
 }
+
+// EventQueue defines the durable work queue for registry webhook events.
+type EventQueue interface {
+	EnsureEventGroup(ctx context.Context) error
+	EnqueueEvents(ctx context.Context, payloads [][]byte) error
+	ReadEvents(ctx context.Context, consumer string, count int64, block time.Duration) ([]QueuedEvent, error)
+	ClaimStaleEvents(ctx context.Context, consumer string, minIdle time.Duration, count int64) ([]QueuedEvent, error)
+	AckEvent(ctx context.Context, id string) error
+	EventQueueStats(ctx context.Context) (QueueStats, error)
+	TrimEvents(ctx context.Context) error
+}
@@ -1,14 +1,21 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 )
 
+// ErrManifestNotFound is returned when the registry has no manifest for a
+// reference.
+var ErrManifestNotFound = errors.New("manifest not found")
+
 // Client talks to the OCI distribution registry HTTP API.
 type Client struct {
 	baseURL    string
@@ -31,16 +38,47 @@ type tagsResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// ManifestV2 represents an OCI/Docker image manifest v2.
+// Manifest media types understood by the client.
+const (
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ManifestAccept is the Accept header value for manifest requests. It lists
+// index types too, so the registry returns the manifest that was pushed
+// rather than converting or resolving it to a single platform.
+const ManifestAccept = MediaTypeOCIManifest + "," +
+	MediaTypeDockerManifest + "," +
+	MediaTypeOCIIndex + "," +
+	MediaTypeDockerManifestList
+
+// maxIndexDepth bounds recursion into nested image indexes.
+const maxIndexDepth = 2
+
+// ManifestV2 represents an OCI/Docker image manifest v2 or image index.
+// For an index, Manifests is set and Config/Layers are empty.
 type ManifestV2 struct {
-	SchemaVersion int             `json:"schemaVersion"`
-	Config        ManifestConfig  `json:"config"`
-	Layers        []ManifestLayer `json:"layers"`
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType,omitempty"`
+	Config        ManifestConfig       `json:"config"`
+	Layers        []ManifestLayer      `json:"layers"`
+	Manifests     []ManifestDescriptor `json:"manifests,omitempty"`
+	Annotations   map[string]string    `json:"annotations,omitempty"`
 }
 
 // ManifestConfig contains the image configuration descriptor.
 type ManifestConfig struct {
-	Size int64 `json:"size"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// imageConfig is the subset of an image config blob needed for labels.
+type imageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
 }
 
 // ManifestLayer represents a single layer in the image.
@@ -48,12 +86,30 @@ type ManifestLayer struct {
 	Size int64 `json:"size"`
 }
 
+// ManifestDescriptor references a child manifest of an image index.
+type ManifestDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
 // ManifestInfo contains metadata about an image manifest.
 type ManifestInfo struct {
-	Digest    string
+	// Digest is the digest of the manifest the tag points at. For a
+	// multi-arch image this is the index digest.
+	Digest string
+	// MediaType is the media type of that manifest.
+	MediaType string
+	// SizeBytes is the config plus layer sizes, summed across all child
+	// manifests for an index.
 	SizeBytes int64
 }
 
+// IsIndex reports whether mediaType is an OCI image index or Docker manifest list.
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList
+}
+
 // ListRepositories returns all repository names from the registry catalog.
 func (c *Client) ListRepositories(ctx context.Context) ([]string, error) {
 	var all []string
@@ -117,64 +173,222 @@ func (c *Client) ListTags(ctx context.Context, repo string) ([]string, error) {
 // GetImageSize fetches the total size of an image by fetching its manifest
 // and summing the config size and all layer sizes.
 func (c *Client) GetImageSize(ctx context.Context, repo, tag string) (int64, error) {
+	info, err := c.GetImageManifestInfo(ctx, repo, tag)
+	if err != nil {
+		return 0, err
+	}
+	return info.SizeBytes, nil
+}
+
+// GetImageManifestInfo fetches both the digest and size of an image manifest.
+// This is more efficient than separate method calls since it uses a single HTTP
+// request for single-platform images. For an image index, each child manifest
+// is fetched as well and their sizes are summed.
+func (c *Client) GetImageManifestInfo(ctx context.Context, repo, tag string) (*ManifestInfo, error) {
+	manifest, digest, mediaType, err := c.fetchManifest(ctx, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	totalSize, err := c.manifestSize(ctx, repo, manifest, mediaType, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManifestInfo{
+		Digest:    digest,
+		MediaType: mediaType,
+		SizeBytes: totalSize,
+	}, nil
+}
+
+// GetImageAnnotations returns the labels of the image config merged with the
+// manifest annotations, which take precedence. For an image index, the first
+// child manifest is consulted and the index annotations are applied on top.
+func (c *Client) GetImageAnnotations(ctx context.Context, repo, reference string) (map[string]string, error) {
+	manifest, _, mediaType, err := c.fetchManifest(ctx, repo, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make(map[string]string)
+	if IsIndex(mediaType) {
+		if len(manifest.Manifests) > 0 {
+			child, err := c.GetImageAnnotations(ctx, repo, manifest.Manifests[0].Digest)
+			if err != nil {
+				return nil, err
+			}
+			annotations = child
+		}
+	} else if manifest.Config.Digest != "" {
+		labels, err := c.fetchConfigLabels(ctx, repo, manifest.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range labels {
+			annotations[k] = v
+		}
+	}
+
+	for k, v := range manifest.Annotations {
+		annotations[k] = v
+	}
+	return annotations, nil
+}
+
+// RestoreTag points tag back at the manifest with the given digest by
+// fetching that manifest unchanged and PUTting it under the tag.
+func (c *Client) RestoreTag(ctx context.Context, repo, tag, digest string) error {
+	body, mediaType, err := c.fetchRawManifest(ctx, repo, digest)
+	if err != nil {
+		return err
+	}
+
 	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repo, tag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating manifest PUT request: %w", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("putting manifest %s:%s: %w", repo, tag, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("manifest PUT failed for %s:%s: status %d", repo, tag, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Docker-Content-Digest"); got != "" && got != digest {
+		return fmt.Errorf("manifest PUT for %s:%s stored digest %s, want %s", repo, tag, got, digest)
+	}
+	return nil
+}
+
+// fetchRawManifest GETs a manifest by reference and returns its bytes as
+// stored, so it can be re-PUT without changing its digest, and its media type.
+func (c *Client) fetchRawManifest(ctx context.Context, repo, reference string) ([]byte, string, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repo, reference)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return 0, fmt.Errorf("creating manifest request: %w", err)
+		return nil, "", fmt.Errorf("creating manifest request: %w", err)
 	}
+	req.Header.Set("Accept", ManifestAccept)
 
-	// Accept both OCI and Docker manifest formats
-	req.Header.Set("Accept",
-		"application/vnd.oci.image.manifest.v1+json,"+
-			"application/vnd.docker.distribution.manifest.v2+json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetching manifest for %s@%s: %w", repo, reference, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("manifest %s@%s: %w", repo, reference, ErrManifestNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("manifest request failed for %s@%s: status %d", repo, reference, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading manifest for %s@%s: %w", repo, reference, err)
+	}
+
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if mediaType == "" {
+		var manifest ManifestV2
+		if err := json.Unmarshal(body, &manifest); err == nil {
+			mediaType = manifest.MediaType
+		}
+	}
+	if mediaType == "" {
+		mediaType = MediaTypeOCIManifest
+	}
+	return body, mediaType, nil
+}
+
+// fetchConfigLabels GETs an image config blob and returns its labels.
+func (c *Client) fetchConfigLabels(ctx context.Context, repo, digest string) (map[string]string, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/%s", c.baseURL, repo, digest)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating config request: %w", err)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("fetching manifest for %s:%s: %w", repo, tag, err)
+		return nil, fmt.Errorf("fetching config for %s@%s: %w", repo, digest, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("manifest request failed for %s:%s: status %d", repo, tag, resp.StatusCode)
+		return nil, fmt.Errorf("config request failed for %s@%s: status %d", repo, digest, resp.StatusCode)
 	}
 
-	var manifest ManifestV2
-	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return 0, fmt.Errorf("decoding manifest for %s:%s: %w", repo, tag, err)
+	var config imageConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("decoding config for %s@%s: %w", repo, digest, err)
+	}
+	return config.Config.Labels, nil
+}
+
+// manifestSize returns the config plus layer sizes of a manifest, recursing
+// into the children of an image index.
+func (c *Client) manifestSize(
+	ctx context.Context, repo string, manifest *ManifestV2, mediaType string, depth int,
+) (int64, error) {
+	if !IsIndex(mediaType) {
+		totalSize := manifest.Config.Size
+		for _, layer := range manifest.Layers {
+			totalSize += layer.Size
+		}
+		return totalSize, nil
 	}
 
-	// Sum config size + all layer sizes
-	totalSize := manifest.Config.Size
-	for _, layer := range manifest.Layers {
-		totalSize += layer.Size
+	if depth >= maxIndexDepth {
+		return 0, fmt.Errorf("image index in %s nested too deeply", repo)
 	}
 
+	var totalSize int64
+	for _, child := range manifest.Manifests {
+		childManifest, _, childType, err := c.fetchManifest(ctx, repo, child.Digest)
+		if err != nil {
+			return 0, err
+		}
+		size, err := c.manifestSize(ctx, repo, childManifest, childType, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		totalSize += size
+	}
 	return totalSize, nil
 }
 
-// GetImageManifestInfo fetches both the digest and size of an image manifest.
-// This is more efficient than separate method calls since it uses a single HTTP request.
-func (c *Client) GetImageManifestInfo(ctx context.Context, repo, tag string) (*ManifestInfo, error) {
-	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repo, tag)
+// fetchManifest GETs a manifest by tag or digest and returns it together
+// with its digest and media type.
+func (c *Client) fetchManifest(ctx context.Context, repo, reference string) (*ManifestV2, string, string, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repo, reference)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating manifest request: %w", err)
+		return nil, "", "", fmt.Errorf("creating manifest request: %w", err)
 	}
-
-	req.Header.Set("Accept",
-		"application/vnd.oci.image.manifest.v1+json,"+
-			"application/vnd.docker.distribution.manifest.v2+json")
+	req.Header.Set("Accept", ManifestAccept)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching manifest for %s:%s: %w", repo, tag, err)
+		return nil, "", "", fmt.Errorf("fetching manifest for %s:%s: %w", repo, reference, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", "", fmt.Errorf("manifest %s:%s: %w", repo, reference, ErrManifestNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("manifest request failed for %s:%s: status %d", repo, tag, resp.StatusCode)
+		return nil, "", "", fmt.Errorf("manifest request failed for %s:%s: status %d", repo, reference, resp.StatusCode)
 	}
 
 	// Extract digest from header
@@ -185,18 +399,20 @@ func (c *Client) GetImageManifestInfo(ctx context.Context, repo, tag string) (*M
 
 	var manifest ManifestV2
 	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return nil, fmt.Errorf("decoding manifest for %s:%s: %w", repo, tag, err)
+		return nil, "", "", fmt.Errorf("decoding manifest for %s:%s: %w", repo, reference, err)
 	}
 
-	totalSize := manifest.Config.Size
-	for _, layer := range manifest.Layers {
-		totalSize += layer.Size
+	// Prefer the mediaType field in the manifest; fall back to Content-Type.
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType, _, _ = strings.Cut(resp.Header.Get("Content-Type"), ";")
+		mediaType = strings.TrimSpace(mediaType)
+	}
+	if mediaType == "" && len(manifest.Manifests) > 0 {
+		mediaType = MediaTypeOCIIndex
 	}
 
-	return &ManifestInfo{
-		Digest:    digest,
-		SizeBytes: totalSize,
-	}, nil
+	return &manifest, digest, mediaType, nil
 }
 
 // nextLink parses the Link header for pagination.
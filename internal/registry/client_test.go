@@ -3,8 +3,11 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -264,3 +267,262 @@ func TestGetImageManifestInfo_InvalidJSON(t *testing.T) {
 		t.Fatal("expected error for invalid JSON, got nil")
 	}
 }
+
+func TestGetImageManifestInfo_Index(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), MediaTypeOCIIndex) {
+			t.Errorf("expected Accept to include %s, got %q", MediaTypeOCIIndex, r.Header.Get("Accept"))
+		}
+
+		switch r.URL.Path {
+		case "/v2/myapp/manifests/1h":
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			w.Header().Set("Content-Type", MediaTypeOCIIndex)
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIIndex,
+				Manifests: []ManifestDescriptor{
+					{MediaType: MediaTypeOCIManifest, Digest: "sha256:amd64", Size: 400},
+					{MediaType: MediaTypeOCIManifest, Digest: "sha256:arm64", Size: 400},
+				},
+			})
+		case "/v2/myapp/manifests/sha256:amd64":
+			w.Header().Set("Docker-Content-Digest", "sha256:amd64")
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIManifest,
+				Config:        ManifestConfig{Size: 100},
+				Layers:        []ManifestLayer{{Size: 1000}},
+			})
+		case "/v2/myapp/manifests/sha256:arm64":
+			w.Header().Set("Docker-Content-Digest", "sha256:arm64")
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIManifest,
+				Config:        ManifestConfig{Size: 200},
+				Layers:        []ManifestLayer{{Size: 2000}, {Size: 3000}},
+			})
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	info, err := c.GetImageManifestInfo(context.Background(), "myapp", "1h")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.Digest != "sha256:index" {
+		t.Fatalf("expected index digest, got %s", info.Digest)
+	}
+	if info.MediaType != MediaTypeOCIIndex {
+		t.Fatalf("expected media type %s, got %s", MediaTypeOCIIndex, info.MediaType)
+	}
+	expectedSize := int64(100 + 1000 + 200 + 2000 + 3000)
+	if info.SizeBytes != expectedSize {
+		t.Fatalf("expected size %d, got %d", expectedSize, info.SizeBytes)
+	}
+}
+
+func TestGetImageManifestInfo_DockerManifestListFromContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myapp/manifests/multi":
+			w.Header().Set("Docker-Content-Digest", "sha256:list")
+			w.Header().Set("Content-Type", MediaTypeDockerManifestList)
+			_, _ = w.Write([]byte(`{"schemaVersion":2,"manifests":[{"digest":"sha256:child","size":300}]}`))
+		case "/v2/myapp/manifests/sha256:child":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			_, _ = w.Write([]byte(`{"schemaVersion":2,"config":{"size":10},"layers":[{"size":90}]}`))
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	info, err := c.GetImageManifestInfo(context.Background(), "myapp", "multi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Digest != "sha256:list" {
+		t.Fatalf("expected list digest, got %s", info.Digest)
+	}
+	if info.SizeBytes != 100 {
+		t.Fatalf("expected size 100, got %d", info.SizeBytes)
+	}
+}
+
+func TestGetImageManifestInfo_IndexChildMissing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/myapp/manifests/1h" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ManifestV2{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeOCIIndex,
+			Manifests:     []ManifestDescriptor{{Digest: "sha256:gone"}},
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	if _, err := c.GetImageManifestInfo(context.Background(), "myapp", "1h"); err == nil {
+		t.Fatal("expected error for missing child manifest, got nil")
+	}
+}
+
+func TestGetImageAnnotations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myapp/manifests/latest":
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIManifest,
+				Config:        ManifestConfig{Digest: "sha256:config", Size: 100},
+				Annotations: map[string]string{
+					"wf.meh.ephemeron.ttl": "2h",
+				},
+			})
+		case "/v2/myapp/blobs/sha256:config":
+			_, _ = w.Write([]byte(`{"config":{"Labels":{"wf.meh.ephemeron.ttl":"5h","maintainer":"ops"}}}`))
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	annotations, err := c.GetImageAnnotations(context.Background(), "myapp", "latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if annotations["wf.meh.ephemeron.ttl"] != "2h" {
+		t.Errorf("expected manifest annotation to win over label, got %q", annotations["wf.meh.ephemeron.ttl"])
+	}
+	if annotations["maintainer"] != "ops" {
+		t.Errorf("expected config label to be included, got %q", annotations["maintainer"])
+	}
+}
+
+func TestGetImageAnnotations_Index(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myapp/manifests/latest":
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIIndex,
+				Manifests: []ManifestDescriptor{
+					{MediaType: MediaTypeOCIManifest, Digest: "sha256:amd64", Size: 400},
+				},
+				Annotations: map[string]string{"org.opencontainers.image.ttl": "keep"},
+			})
+		case "/v2/myapp/manifests/sha256:amd64":
+			_ = json.NewEncoder(w).Encode(ManifestV2{
+				SchemaVersion: 2,
+				MediaType:     MediaTypeOCIManifest,
+				Config:        ManifestConfig{Digest: "sha256:config", Size: 100},
+			})
+		case "/v2/myapp/blobs/sha256:config":
+			_, _ = w.Write([]byte(`{"config":{"Labels":{"wf.meh.ephemeron.ttl":"3h"}}}`))
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	annotations, err := c.GetImageAnnotations(context.Background(), "myapp", "latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if annotations["org.opencontainers.image.ttl"] != "keep" {
+		t.Errorf("expected index annotation, got %q", annotations["org.opencontainers.image.ttl"])
+	}
+	if annotations["wf.meh.ephemeron.ttl"] != "3h" {
+		t.Errorf("expected child config label, got %q", annotations["wf.meh.ephemeron.ttl"])
+	}
+}
+
+func TestGetImageManifestInfo_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	_, err := c.GetImageManifestInfo(context.Background(), "myapp", "1h")
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Fatalf("expected ErrManifestNotFound, got %v", err)
+	}
+}
+
+func TestRestoreTag(t *testing.T) {
+	const manifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"sha256:config","size":7}}`
+	var put []byte
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/myapp/manifests/sha256:old":
+			w.Header().Set("Content-Type", MediaTypeOCIManifest)
+			_, _ = w.Write([]byte(manifest))
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/myapp/manifests/v1":
+			put, _ = io.ReadAll(r.Body)
+			contentType = r.Header.Get("Content-Type")
+			w.Header().Set("Docker-Content-Digest", "sha256:old")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	if err := c.RestoreTag(context.Background(), "myapp", "v1", "sha256:old"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(put) != manifest {
+		t.Errorf("manifest was not re-PUT byte for byte: %s", put)
+	}
+	if contentType != MediaTypeOCIManifest {
+		t.Errorf("Content-Type = %q, want %q", contentType, MediaTypeOCIManifest)
+	}
+}
+
+func TestRestoreTag_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		getStatus int
+		putStatus int
+		notFound  bool
+	}{
+		{name: "old manifest gone", getStatus: http.StatusNotFound, notFound: true},
+		{name: "put rejected", getStatus: http.StatusOK, putStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					w.WriteHeader(tt.getStatus)
+					_, _ = w.Write([]byte(`{"schemaVersion":2}`))
+					return
+				}
+				w.WriteHeader(tt.putStatus)
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL).RestoreTag(context.Background(), "myapp", "v1", "sha256:old")
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := errors.Is(err, ErrManifestNotFound); got != tt.notFound {
+				t.Errorf("errors.Is(err, ErrManifestNotFound) = %v, want %v (%v)", got, tt.notFound, err)
+			}
+		})
+	}
+}
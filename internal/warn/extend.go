@@ -0,0 +1,116 @@
+package warn
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/audit"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// ExtendHandler serves the one-click extend links sent with warnings. The
+// signature is the only authentication, so links are only valid until the
+// image was due to expire when the warning went out.
+type ExtendHandler struct {
+	redis    redisclient.Store
+	links    *Links
+	defaults policy.Defaults
+	policy   *policy.Source
+	history  *audit.Recorder
+	logger   *slog.Logger
+}
+
+// NewExtendHandler creates the handler for links signed by links. The
+// extension is capped at the max_ttl that src or defaults give the image,
+// and recorded in history, which may be nil.
+func NewExtendHandler(
+	redis redisclient.Store,
+	links *Links,
+	defaults policy.Defaults,
+	src *policy.Source,
+	history *audit.Recorder,
+	logger *slog.Logger,
+) *ExtendHandler {
+	return &ExtendHandler{
+		redis:    redis,
+		links:    links,
+		defaults: defaults,
+		policy:   src,
+		history:  history,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP handles GET /v1/extend?image=&exp=&sig=. It only ever moves the
+// expiry later.
+func (h *ExtendHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	image, err := h.links.verify(r.URL.Query(), now)
+	switch {
+	case errors.Is(err, errLinkExpired):
+		writeText(w, http.StatusGone, "This link has expired.")
+		return
+	case err != nil:
+		h.logger.Warn("invalid extend link", "remote_addr", r.RemoteAddr)
+		writeText(w, http.StatusForbidden, "This link is not valid.")
+		return
+	}
+
+	img, err := h.redis.GetImage(r.Context(), image)
+	if errors.Is(err, redisclient.ErrNotTracked) {
+		writeText(w, http.StatusNotFound, image+" is no longer tracked; it may already have been deleted.")
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to read image for extend link", "image", image, "error", err)
+		writeText(w, http.StatusInternalServerError, "Internal error, please try again.")
+		return
+	}
+
+	repo, tag, _ := strings.Cut(image, ":")
+	ttl := min(h.links.TTL(), h.policy.Policy().Resolve(repo, tag, h.defaults).MaxTTL)
+	expiresAt := now.Add(ttl)
+	if !expiresAt.After(img.Expires) {
+		writeText(w, http.StatusOK, fmt.Sprintf("%s already expires at %s.", image, img.Expires.UTC().Format(time.RFC1123)))
+		return
+	}
+
+	if err := h.redis.SetExpiry(r.Context(), image, expiresAt); err != nil {
+		if errors.Is(err, redisclient.ErrNotTracked) {
+			writeText(w, http.StatusNotFound, image+" is no longer tracked; it may already have been deleted.")
+			return
+		}
+		h.logger.Error("failed to extend image", "image", image, "error", err)
+		writeText(w, http.StatusInternalServerError, "Internal error, please try again.")
+		return
+	}
+
+	h.logger.Info("extended image via link",
+		"image", image,
+		"ttl", ttl,
+		"expires", expiresAt,
+		"remote_addr", r.RemoteAddr,
+	)
+	h.history.Record(r.Context(), audit.Entry{
+		Action:    audit.ActionExtended,
+		Image:     image,
+		Digest:    img.Digest,
+		SizeBytes: img.SizeBytes,
+		ExpiresAt: expiresAt,
+		Actor:     audit.ActorExtendLink,
+		Addr:      r.RemoteAddr,
+	})
+	writeText(w, http.StatusOK, fmt.Sprintf("%s now expires at %s.", image, expiresAt.UTC().Format(time.RFC1123)))
+}
+
+func writeText(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintln(w, msg)
+}
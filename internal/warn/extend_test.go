@@ -0,0 +1,144 @@
+package warn
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/policy"
+)
+
+func TestExtendHandler(t *testing.T) {
+	links := NewLinks("https://registry.example.com", "secret", 4*time.Hour)
+	valid := time.Now().Add(10 * time.Minute)
+
+	tests := []struct {
+		name       string
+		url        func() string
+		expires    time.Duration
+		wantStatus int
+		// wantTTL is the remaining lifetime of check afterwards.
+		check   string
+		wantTTL time.Duration
+	}{
+		{
+			name:       "extends by the link ttl",
+			url:        func() string { return links.URL("myapp:1h", valid) },
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusOK,
+			check:      "myapp:1h",
+			wantTTL:    4 * time.Hour,
+		},
+		{
+			name:       "capped by the policy max_ttl",
+			url:        func() string { return links.URL("ci/app:1h", valid) },
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusOK,
+			check:      "ci/app:1h",
+			wantTTL:    2 * time.Hour,
+		},
+		{
+			name:       "never shortens",
+			url:        func() string { return links.URL("myapp:1h", valid) },
+			expires:    6 * time.Hour,
+			wantStatus: http.StatusOK,
+			check:      "myapp:1h",
+			wantTTL:    6 * time.Hour,
+		},
+		{
+			name: "tampered image",
+			url: func() string {
+				return strings.Replace(links.URL("myapp:1h", valid), "myapp", "other", 1)
+			},
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusForbidden,
+			check:      "myapp:1h",
+			wantTTL:    10 * time.Minute,
+		},
+		{
+			name: "signed with another secret",
+			url: func() string {
+				return NewLinks("https://registry.example.com", "other", time.Hour).URL("myapp:1h", valid)
+			},
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusForbidden,
+			check:      "myapp:1h",
+			wantTTL:    10 * time.Minute,
+		},
+		{
+			name:       "expired link",
+			url:        func() string { return links.URL("myapp:1h", time.Now().Add(-time.Minute)) },
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusGone,
+			check:      "myapp:1h",
+			wantTTL:    10 * time.Minute,
+		},
+		{
+			name:       "not tracked",
+			url:        func() string { return links.URL("gone:1h", valid) },
+			expires:    10 * time.Minute,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - repository: \"ci/*\"\n    max_ttl: 2h\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := policy.NewSource(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			store.add("myapp:1h", time.Now().Add(tt.expires))
+			store.add("ci/app:1h", time.Now().Add(tt.expires))
+			h := NewExtendHandler(store, links,
+				policy.Defaults{DefaultTTL: time.Hour, MaxTTL: 24 * time.Hour}, src, nil, slog.Default())
+
+			u, err := url.Parse(tt.url())
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantTTL == 0 {
+				return
+			}
+			got := time.Until(store.images[tt.check].Expires)
+			if got < tt.wantTTL-time.Minute || got > tt.wantTTL {
+				t.Errorf("remaining = %s, want about %s", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := string(formatMessage("ephemeron@example.com", []string{"a@example.com", "b@example.com"},
+		"myapp:1h expires in 10m0s", "line one\nline two\n", date))
+
+	for _, want := range []string{
+		"From: ephemeron@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: myapp:1h expires in 10m0s\r\n",
+		"Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package warn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidLink = errors.New("invalid link")
+	errLinkExpired = errors.New("link expired")
+)
+
+// Links signs and verifies one-click extend links. A link names the image
+// and when it stops being valid; the lifetime it grants is configured on the
+// server.
+type Links struct {
+	baseURL string
+	secret  []byte
+	ttl     time.Duration
+}
+
+// NewLinks creates links under baseURL that extend images by ttl.
+func NewLinks(baseURL, secret string, ttl time.Duration) *Links {
+	return &Links{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  []byte(secret),
+		ttl:     ttl,
+	}
+}
+
+// TTL is the lifetime from now that following a link gives an image.
+func (l *Links) TTL() time.Duration {
+	return l.ttl
+}
+
+// URL returns a link extending image that is valid until validUntil. It
+// returns "" on a nil Links.
+func (l *Links) URL(image string, validUntil time.Time) string {
+	if l == nil {
+		return ""
+	}
+	exp := strconv.FormatInt(validUntil.Unix(), 10)
+	q := url.Values{
+		"image": {image},
+		"exp":   {exp},
+		"sig":   {l.sign(image, exp)},
+	}
+	return l.baseURL + "/v1/extend?" + q.Encode()
+}
+
+// verify checks the signature and validity of a link's query and returns the
+// image it extends.
+func (l *Links) verify(q url.Values, now time.Time) (string, error) {
+	image, exp := q.Get("image"), q.Get("exp")
+	sig, err := hex.DecodeString(q.Get("sig"))
+	if err != nil || image == "" || exp == "" {
+		return "", errInvalidLink
+	}
+	want, _ := hex.DecodeString(l.sign(image, exp))
+	if !hmac.Equal(sig, want) {
+		return "", errInvalidLink
+	}
+	until, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", errInvalidLink
+	}
+	if now.Unix() > until {
+		return "", errLinkExpired
+	}
+	return image, nil
+}
+
+func (l *Links) sign(image, exp string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(image + "\n" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
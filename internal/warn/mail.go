@@ -0,0 +1,93 @@
+package warn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends a plain-text mail to a fixed set of recipients.
+type Mailer interface {
+	Send(ctx context.Context, subject, body string) error
+}
+
+// defaultSMTPTimeout bounds sending one mail when SMTPMailer.Timeout is
+// unset.
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPMailer sends mail through an unauthenticated relay, such as a local
+// MTA or cluster mail relay.
+type SMTPMailer struct {
+	Addr string
+	From string
+	To   []string
+	// Timeout bounds sending one mail, from dialing to QUIT, unless ctx
+	// has an earlier deadline. Zero means defaultSMTPTimeout.
+	Timeout time.Duration
+}
+
+// Send delivers one message to every recipient.
+func (m *SMTPMailer) Send(ctx context.Context, subject, body string) error {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", m.Addr, err)
+	}
+	// net/smtp ignores ctx, so a stalled relay is cut off by the deadline.
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(m.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(formatMessage(m.From, m.To, subject, body, time.Now())); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// formatMessage renders an RFC 5322 message with CRLF line endings.
+func formatMessage(from string, to []string, subject, body string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
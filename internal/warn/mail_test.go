@@ -0,0 +1,38 @@
+package warn
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailer_StalledRelayTimesOut(t *testing.T) {
+	// The relay accepts the connection but never sends its greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		time.Sleep(2 * time.Second)
+	}()
+
+	m := &SMTPMailer{
+		Addr:    ln.Addr().String(),
+		From:    "ephemeron@localhost",
+		To:      []string{"ops@localhost"},
+		Timeout: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	if err := m.Send(t.Context(), "subject", "body"); err == nil {
+		t.Fatal("expected an error from the stalled relay")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Send took %s, want it cut off after the timeout", elapsed)
+	}
+}
@@ -0,0 +1,211 @@
+// Package warn tells developers shortly before their images are reaped and
+// lets them extend the images with a signed link.
+package warn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tamcore/ephemeron/internal/metrics"
+	"github.com/tamcore/ephemeron/internal/notify"
+	"github.com/tamcore/ephemeron/internal/policy"
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// defaultBatchSize is the number of index entries read per round trip.
+const defaultBatchSize = 500
+
+// Warner sends one "expiring soon" warning per image and expiry when the
+// image enters the warning window. Every replica may run it; the warning
+// state recorded on the image keeps them from sending duplicates.
+type Warner struct {
+	redis     redisclient.Store
+	window    time.Duration
+	logger    *slog.Logger
+	batchSize int64
+	policy    *policy.Source
+	notifier  *notify.Dispatcher
+	mailer    Mailer
+	links     *Links
+}
+
+// Option configures a Warner.
+type Option func(*Warner)
+
+// WithPolicy skips images that a never_reap rule exempts.
+func WithPolicy(src *policy.Source) Option {
+	return func(w *Warner) {
+		w.policy = src
+	}
+}
+
+// WithNotifier sends warnings as expiring events.
+func WithNotifier(n *notify.Dispatcher) Option {
+	return func(w *Warner) {
+		w.notifier = n
+	}
+}
+
+// WithMailer also sends warnings by mail.
+func WithMailer(m Mailer) Option {
+	return func(w *Warner) {
+		w.mailer = m
+	}
+}
+
+// WithLinks adds a one-click extend link to every warning.
+func WithLinks(l *Links) Option {
+	return func(w *Warner) {
+		w.links = l
+	}
+}
+
+// New creates a Warner for images expiring within window. Warnings are
+// always logged.
+func New(redis redisclient.Store, window time.Duration, logger *slog.Logger, opts ...Option) *Warner {
+	w := &Warner{
+		redis:     redis,
+		window:    window,
+		logger:    logger,
+		batchSize: defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// RunLoop checks for expiring images at the given interval until the
+// context is cancelled.
+func (w *Warner) RunLoop(ctx context.Context, interval time.Duration) {
+	w.logger.Info("starting expiry warnings", "window", w.window.String(), "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.WarnOnce(ctx); err != nil {
+				w.logger.Error("expiry warning pass failed", "error", err)
+			}
+		}
+	}
+}
+
+// WarnOnce warns about every image expiring within the window that has not
+// been warned about for its current expiry. Images that are already due,
+// pinned or exempt by policy are skipped.
+func (w *Warner) WarnOnce(ctx context.Context) error {
+	now := time.Now()
+	var offset int64
+	for {
+		batch, err := w.redis.ListImagesExpiringBetween(ctx, now, now.Add(w.window), offset, w.batchSize)
+		if err != nil {
+			return fmt.Errorf("listing expiring images: %w", err)
+		}
+		offset += int64(len(batch))
+
+		for _, image := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := w.check(ctx, image, now); err != nil {
+				w.logger.Warn("failed to check image for expiry warning", "image", image, "error", err)
+			}
+		}
+
+		if int64(len(batch)) < w.batchSize {
+			return nil
+		}
+	}
+}
+
+// check warns about image unless it does not need a warning or another
+// replica already sent it.
+func (w *Warner) check(ctx context.Context, image string, now time.Time) error {
+	img, err := w.redis.GetImage(ctx, image)
+	if errors.Is(err, redisclient.ErrNotTracked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !img.Expires.After(now) || img.PinnedAt(now) || w.exempt(image) {
+		return nil
+	}
+
+	claimed, err := w.redis.ClaimExpiryWarning(ctx, image, img.Expires)
+	if err != nil {
+		return ignoreNotTracked(err)
+	}
+	if !claimed {
+		return nil
+	}
+	w.send(ctx, img, now)
+	return nil
+}
+
+// send delivers the warning on every configured channel. Failures are
+// logged; the warning is not retried.
+func (w *Warner) send(ctx context.Context, img redisclient.Image, now time.Time) {
+	remaining := img.Expires.Sub(now).Round(time.Minute)
+	link := w.links.URL(img.Name, img.Expires)
+
+	metrics.ExpiryWarnings.Inc()
+	w.logger.Info("image expiring soon",
+		"image", img.Name,
+		"expires_at", img.Expires.Format(time.RFC3339),
+		"remaining", remaining.String(),
+		"extend_url", link,
+	)
+
+	w.notifier.Emit(notify.Event{
+		Type:      notify.EventExpiring,
+		Image:     img.Name,
+		Digest:    img.Digest,
+		SizeBytes: img.SizeBytes,
+		ExpiresAt: img.Expires,
+		ExtendURL: link,
+	})
+
+	if w.mailer != nil {
+		subject := fmt.Sprintf("%s expires in %s", img.Name, remaining)
+		if err := w.mailer.Send(ctx, subject, w.mailBody(img, remaining, link)); err != nil {
+			metrics.ExpiryWarningMailErrors.Inc()
+			w.logger.Error("failed to mail expiry warning", "image", img.Name, "error", err)
+		}
+	}
+}
+
+func (w *Warner) mailBody(img redisclient.Image, remaining time.Duration, link string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The image %s will be deleted at %s, in about %s.\n",
+		img.Name, img.Expires.UTC().Format(time.RFC1123), remaining)
+	if link != "" {
+		fmt.Fprintf(&b, "\nTo keep it for another %s, open:\n\n%s\n", w.links.TTL(), link)
+	} else {
+		fmt.Fprintf(&b, "\nTo keep it, push it again, extend it with `ephemeron images extend %s <ttl>` or pin it.\n", img.Name)
+	}
+	return b.String()
+}
+
+// exempt reports whether a never_reap policy rule matches the image.
+func (w *Warner) exempt(imageWithTag string) bool {
+	repo, tag, _ := strings.Cut(imageWithTag, ":")
+	rule := w.policy.Policy().Match(repo, tag)
+	return rule != nil && rule.NeverReap
+}
+
+func ignoreNotTracked(err error) error {
+	if errors.Is(err, redisclient.ErrNotTracked) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package warn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redisclient "github.com/tamcore/ephemeron/internal/redis"
+)
+
+// mockStore implements the store methods the warner and the extend handler
+// use. Calling any other method panics on the nil embedded Store.
+type mockStore struct {
+	redisclient.Store
+	mu     sync.Mutex
+	images map[string]redisclient.Image
+	warned map[string]int64
+	reads  int // GetImage calls
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{
+		images: make(map[string]redisclient.Image),
+		warned: make(map[string]int64),
+	}
+}
+
+func (m *mockStore) add(image string, expires time.Time) {
+	m.images[image] = redisclient.Image{Name: image, Expires: expires, SizeBytes: 1024}
+}
+
+func (m *mockStore) ListImagesExpiringBetween(_ context.Context, from, to time.Time, offset, limit int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, img := range m.images {
+		if img.Expires.After(from) && !img.Expires.After(to) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return m.images[names[i]].Expires.Before(m.images[names[j]].Expires)
+	})
+	if offset >= int64(len(names)) {
+		return nil, nil
+	}
+	return names[offset:min(offset+limit, int64(len(names)))], nil
+}
+
+func (m *mockStore) GetImage(_ context.Context, imageWithTag string) (redisclient.Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.Image{}, redisclient.ErrNotTracked
+	}
+	return img, nil
+}
+
+func (m *mockStore) SetExpiry(_ context.Context, imageWithTag string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	img, ok := m.images[imageWithTag]
+	if !ok {
+		return redisclient.ErrNotTracked
+	}
+	img.Expires = expiresAt
+	m.images[imageWithTag] = img
+	return nil
+}
+
+func (m *mockStore) ClaimExpiryWarning(_ context.Context, imageWithTag string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.images[imageWithTag]; !ok {
+		return false, redisclient.ErrNotTracked
+	}
+	if m.warned[imageWithTag] == expiresAt.UnixMilli() {
+		return false, nil
+	}
+	m.warned[imageWithTag] = expiresAt.UnixMilli()
+	return true, nil
+}
+
+type mail struct{ subject, body string }
+
+type mockMailer struct {
+	mu   sync.Mutex
+	sent []mail
+}
+
+func (m *mockMailer) Send(_ context.Context, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, mail{subject, body})
+	return nil
+}
+
+func (m *mockMailer) subjects() []string {
+	out := make([]string, 0, len(m.sent))
+	for _, s := range m.sent {
+		out = append(out, s.subject)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestWarnOnce(t *testing.T) {
+	store := newMockStore()
+	now := time.Now()
+	store.add("soon:1h", now.Add(10*time.Minute))
+	store.add("later:1h", now.Add(time.Hour))
+	store.add("due:1h", now.Add(-time.Minute))
+	store.add("pinned:1h", now.Add(5*time.Minute))
+	img := store.images["pinned:1h"]
+	img.Pinned = true
+	store.images["pinned:1h"] = img
+
+	mailer := &mockMailer{}
+	w := New(store, 15*time.Minute, slog.Default(), WithMailer(mailer))
+
+	if err := w.WarnOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := mailer.subjects(); len(got) != 1 || !strings.HasPrefix(got[0], "soon:1h expires in") {
+		t.Fatalf("expected a single warning for soon:1h, got %v", got)
+	}
+
+	// A second pass does not warn again for the same expiry.
+	if err := w.WarnOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("expected no duplicate warning, got %d mails", len(mailer.sent))
+	}
+
+	// Extending the image re-arms the warning for its new expiry.
+	_ = store.SetExpiry(t.Context(), "soon:1h", now.Add(12*time.Minute))
+	if err := w.WarnOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mailer.sent) != 2 {
+		t.Fatalf("expected a warning for the new expiry, got %d mails", len(mailer.sent))
+	}
+}
+
+func TestWarnOnce_SkipsDueImagesInTheQuery(t *testing.T) {
+	store := newMockStore()
+	now := time.Now()
+	for i := range 50 {
+		store.add(fmt.Sprintf("due:%d", i), now.Add(-time.Duration(i+1)*time.Minute))
+	}
+	store.add("soon:1h", now.Add(10*time.Minute))
+
+	w := New(store, 15*time.Minute, slog.Default(), WithMailer(&mockMailer{}))
+	if err := w.WarnOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.reads != 1 {
+		t.Errorf("expected only the image inside the window to be read, got %d reads", store.reads)
+	}
+}
+
+func TestWarnOnce_ReplicasDoNotDuplicate(t *testing.T) {
+	store := newMockStore()
+	store.add("soon:1h", time.Now().Add(10*time.Minute))
+
+	mailer := &mockMailer{}
+	var wg sync.WaitGroup
+	for range 5 {
+		w := New(store, 15*time.Minute, slog.Default(), WithMailer(mailer))
+		wg.Go(func() {
+			_ = w.WarnOnce(context.Background())
+		})
+	}
+	wg.Wait()
+
+	if len(mailer.sent) != 1 {
+		t.Errorf("expected exactly one warning across replicas, got %d", len(mailer.sent))
+	}
+}
+
+func TestWarnOnce_MailIncludesExtendLink(t *testing.T) {
+	store := newMockStore()
+	store.add("soon:1h", time.Now().Add(10*time.Minute))
+
+	mailer := &mockMailer{}
+	links := NewLinks("https://registry.example.com/", "secret", 2*time.Hour)
+	w := New(store, 15*time.Minute, slog.Default(), WithMailer(mailer), WithLinks(links))
+	if err := w.WarnOnce(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mailer.sent) != 1 {
+		t.Fatalf("expected 1 mail, got %d", len(mailer.sent))
+	}
+	body := mailer.sent[0].body
+	if !strings.Contains(body, "https://registry.example.com/v1/extend?") || !strings.Contains(body, "another 2h0m0s") {
+		t.Errorf("expected extend link in mail body, got:\n%s", body)
+	}
+}